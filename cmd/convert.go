@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/otis-co-ltd/aihub-recorder/internal/audio"
+)
+
+// runConvert converts one audio file to another format, bit depth,
+// channel count or sample rate. It returns the exit status.
+func runConvert(args []string) int {
+	flags := flag.NewFlagSet("convert", flag.ExitOnError)
+	var opts audio.ConvertOptions
+	flags.StringVar(&opts.Format, "format", "", "output format: aiff, wav, flac or raw (default from the output extension)")
+	flags.IntVar(&opts.BitsPerSample, "bits", 0, "output bits per sample: 8, 16, 24 or 32 (default as the input)")
+	flags.IntVar(&opts.Channels, "channels", 0, "1 to mix down to mono (default as the input)")
+	flags.Float64Var(&opts.SampleRate, "rate", 0, "output sample rate in Hz (default as the input)")
+	flags.BoolVar(&opts.NoDither, "no-dither", false, "round without dither when reducing the bit depth")
+	asJSON := flags.Bool("json", false, "print the result as JSON")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: pi-client convert [flags] input output")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+
+	result, err := audio.Convert(flags.Arg(0), flags.Arg(1), opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "convert: %v\n", err)
+		return 1
+	}
+	if *asJSON {
+		printJSON(result)
+		return 0
+	}
+	dither := ""
+	if result.Dithered {
+		dither = ", dithered"
+	}
+	fmt.Printf("%s -> %s (%s, %d ch, %d-bit, %g Hz, %d frames%s)\n", result.Input, result.Output,
+		result.Format, result.Channels, result.BitsPerSample, result.SampleRate, result.Frames, dither)
+	return 0
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/otis-co-ltd/aihub-recorder/internal/audio"
+)
+
+// denoiseResult is the JSON output of the denoise command for one file.
+type denoiseResult struct {
+	Input  string `json:"input"`
+	Output string `json:"output,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// runDenoise runs RNNoise over each file named in args and writes the
+// result next to it as <name>_denoised.aiff, or .wav for a WAV file.
+func runDenoise(args []string) int {
+	flags := flag.NewFlagSet("denoise", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print one JSON object per file")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: pi-client denoise [-json] file...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	if err := audio.CheckRNNoiseAvailable(); err != nil {
+		fmt.Fprintf(os.Stderr, "denoise: %v\n", err)
+		return 1
+	}
+
+	status := 0
+	for _, path := range flags.Args() {
+		result := denoiseResult{Input: path}
+		output, err := audio.DenoiseAudioFile(path)
+		if err != nil {
+			status = 1
+			result.Error = err.Error()
+		}
+		result.Output = output
+
+		switch {
+		case *asJSON:
+			printJSON(result)
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		default:
+			fmt.Printf("%s -> %s\n", path, output)
+		}
+	}
+	return status
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/otis-co-ltd/aihub-recorder/internal/audio"
+)
+
+// runDevices lists the input devices of the configured capture backend.
+func runDevices(args []string) int {
+	flags := flag.NewFlagSet("devices", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print the devices as a JSON array")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: pi-client devices [-json]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+
+	devices, err := audio.ListDevices()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "devices: %v\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		printJSON(devices)
+		return 0
+	}
+	fmt.Printf("%d input devices on %s\n", len(devices), audio.GetCaptureBackend().Name())
+	for _, device := range devices {
+		name := device.Name
+		if device.Alias != "" {
+			name = fmt.Sprintf("%s (%s)", device.Alias, device.Name)
+		}
+		fmt.Printf("%3d  %s, %d ch, %g Hz, %s\n", device.Index, name, device.MaxInputChannels, device.DefaultSampleRate, device.HostAPI)
+		if device.ID != "" {
+			fmt.Printf("     id %s\n", device.ID)
+		}
+	}
+	return 0
+}
@@ -1,15 +1,87 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
+	"os"
 
 	"github.com/otis-co-ltd/aihub-recorder/internal/pi"
 	"github.com/otis-co-ltd/aihub-recorder/internal/wsclient"
 )
 
+// command is a pi-client subcommand. run gets the arguments after the
+// command name and returns the exit status: 0 on success, 1 on failure
+// and 2 for a usage error.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+// commands lists the subcommands. They share the SYS_* configuration the
+// recorder package loads when it is initialized, including the capture
+// backend and device aliases. All but run take -json to print machine-readable
+// output on stdout; logs go to stderr.
+var commands = []command{
+	{"run", "connect to the backend and record on its commands (default)", runAgent},
+	{"devices", "list the input devices", runDevices},
+	{"record", "record from one device", runRecord},
+	{"denoise", "denoise recordings with RNNoise", runDenoise},
+	{"convert", "convert an audio file to another format", runConvert},
+	{"verify", "check the structure of audio files", runVerify},
+	{"upload", "upload audio files to the backend", runUpload},
+	{"sessions", "list the sessions in the recording directory", runSessions},
+}
+
 func main() {
+	if len(os.Args) < 2 {
+		os.Exit(runAgent(nil))
+	}
+
+	name := os.Args[1]
+	if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+		usage()
+		return
+	}
+	for _, cmd := range commands {
+		if cmd.name == name {
+			os.Exit(cmd.run(os.Args[2:]))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "pi-client: unknown command %q\n", name)
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: pi-client [command] [flags]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(os.Stderr, "\nRun \"pi-client <command> -h\" for the flags of a command.")
+}
+
+// runAgent runs the WebSocket client until the process is killed.
+func runAgent(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "usage: pi-client run")
+		return 2
+	}
 	piID := pi.GetPiId()
 	log.Println("Starting AIHub recorder WebSocket client with Pi ID:", piID)
 
 	wsclient.Start(piID)
+	return 0
+}
+
+// printJSON writes v as one line of JSON to stdout.
+func printJSON(v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Failed to marshal output to JSON: %v", err)
+		return
+	}
+	fmt.Println(string(data))
 }
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/otis-co-ltd/aihub-recorder/internal/audio"
+)
+
+// writeTestFile writes frames of 16-bit mono silence at 8 kHz to path,
+// converting it to AIFF when the extension asks for it.
+func writeTestFile(t *testing.T, path string, frames int) {
+	t.Helper()
+	if filepath.Ext(path) != ".wav" {
+		wav := filepath.Join(t.TempDir(), "source.wav")
+		writeTestFile(t, wav, frames)
+		if _, err := audio.Convert(wav, path, audio.ConvertOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	dataBytes := uint32(2 * frames)
+	header := []byte("RIFF")
+	header = binary.LittleEndian.AppendUint32(header, 36+dataBytes)
+	header = append(header, "WAVEfmt "...)
+	header = binary.LittleEndian.AppendUint32(header, 16)
+	header = binary.LittleEndian.AppendUint16(header, 1)
+	header = binary.LittleEndian.AppendUint16(header, 1)
+	header = binary.LittleEndian.AppendUint32(header, 8000)
+	header = binary.LittleEndian.AppendUint32(header, 16000)
+	header = binary.LittleEndian.AppendUint16(header, 2)
+	header = binary.LittleEndian.AppendUint16(header, 16)
+	header = append(header, "data"...)
+	header = binary.LittleEndian.AppendUint32(header, dataBytes)
+	if err := os.WriteFile(path, append(header, make([]byte, dataBytes)...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// captureStdout returns what fn prints on stdout.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		output <- data
+	}()
+	fn()
+	w.Close()
+	return string(<-output)
+}
+
+// TestUsageErrors checks that each command refuses arguments it cannot
+// use with exit status 2 before it touches a device or file.
+func TestUsageErrors(t *testing.T) {
+	run := map[string]func([]string) int{}
+	for _, cmd := range commands {
+		run[cmd.name] = cmd.run
+	}
+	for _, test := range []struct {
+		command string
+		args    []string
+	}{
+		{"run", []string{"extra"}},
+		{"devices", []string{"extra"}},
+		{"record", []string{"extra"}},
+		{"record", []string{"-duration", "-1s"}},
+		{"denoise", nil},
+		{"convert", nil},
+		{"convert", []string{"in.aiff"}},
+		{"convert", []string{"in.aiff", "out.wav", "extra"}},
+		{"verify", nil},
+		{"verify", []string{"-json"}},
+		{"upload", []string{"-session", "s1"}},
+		{"sessions", []string{"extra"}},
+	} {
+		if status := run[test.command](test.args); status != 2 {
+			t.Errorf("%s %q: exit status %d, want 2", test.command, test.args, status)
+		}
+	}
+}
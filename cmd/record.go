@@ -0,0 +1,167 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/otis-co-ltd/aihub-recorder/internal/audio"
+	"github.com/otis-co-ltd/aihub-recorder/internal/recorder"
+)
+
+// runRecord records one session from a device like a start and stop
+// command from the backend would, without uploading it. The session is
+// stopped after -duration or on SIGINT or SIGTERM, post-processed as
+// configured and optionally moved to -out.
+func runRecord(args []string) int {
+	flags := flag.NewFlagSet("record", flag.ExitOnError)
+	device := flags.String("device", "", "device index, ID, alias or part of its name (default input device if empty)")
+	duration := flags.Duration("duration", 10*time.Second, "how long to record, 0 records until interrupted")
+	out := flags.String("out", "", "move the finished recording to this path, converting it if the extension differs")
+	sessionID := flags.String("session", "", "session ID (default cli_<date>_<time>)")
+	raw := flags.Bool("raw", false, "skip post-processing and keep the file as recorded")
+	asJSON := flags.Bool("json", false, "print the session report as JSON")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: pi-client record [flags]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 0 || *duration < 0 {
+		flags.Usage()
+		return 2
+	}
+	if *sessionID == "" {
+		*sessionID = "cli_" + time.Now().Format("20060102_150405")
+	}
+
+	deviceIndex, err := resolveDevice(*device)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "record: %v\n", err)
+		return 1
+	}
+
+	// A session that ends by itself is reported through these handlers
+	// instead of StopSession.
+	ended := make(chan *recorder.SessionReport, 1)
+	notify := func(report *recorder.SessionReport) { ended <- report }
+	recorder.SetInterruptHandler(notify)
+	recorder.SetFailureHandler(notify)
+	recorder.SetAutoStopHandler(notify)
+
+	if err := recorder.StartSession(*sessionID, deviceIndex, recorder.SessionOptions{}); err != nil {
+		fmt.Fprintf(os.Stderr, "record: %v\n", err)
+		return 1
+	}
+	log.Printf("🎙️ Recording session %s from device %d", *sessionID, deviceIndex)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	var timeout <-chan time.Time
+	if *duration > 0 {
+		timeout = time.After(*duration)
+	}
+
+	var report *recorder.SessionReport
+	select {
+	case report = <-ended:
+	case <-timeout:
+	case <-signals:
+	}
+	if report == nil {
+		if report, err = recorder.StopSession(*sessionID); err != nil {
+			// The session ended by itself at the same moment.
+			report = <-ended
+		}
+	}
+
+	if !*raw {
+		recorder.PostProcess(report, func(step string, err error) {
+			log.Printf("%s failed: %v", step, err)
+		})
+	}
+	status := 0
+	if *out != "" {
+		if err := moveRecording(report, *out); err != nil {
+			fmt.Fprintf(os.Stderr, "record: %v\n", err)
+			status = 1
+		}
+	}
+	if report.Interrupted || report.Error != "" {
+		status = 1
+	}
+
+	if *asJSON {
+		printJSON(report)
+		return status
+	}
+	switch {
+	case report.Interrupted:
+		fmt.Printf("Interrupted: %s\n", report.InterruptReason)
+	case report.Error != "":
+		fmt.Printf("Failed: %s\n", report.Error)
+	}
+	fmt.Printf("%s (%.2f s)\n", report.FilePath, report.StopTime.Sub(report.StartTime).Seconds())
+	for _, track := range report.Tracks {
+		fmt.Printf("  channel %d: %s\n", track.Channel, track.FilePath)
+	}
+	if len(report.Segments) > 1 {
+		for _, segment := range report.Segments {
+			fmt.Printf("  segment %d: %s\n", segment.Index, segment.FilePath)
+		}
+	}
+	return status
+}
+
+// resolveDevice returns the index of the device named by a -device flag:
+// an index, a device ID or alias, or part of a device name. Empty selects
+// the default input device.
+func resolveDevice(name string) (int, error) {
+	if name == "" {
+		device, err := audio.GetDefaultInputDevice()
+		if err != nil {
+			return -1, err
+		}
+		return device.Index, nil
+	}
+	if index, err := strconv.Atoi(name); err == nil {
+		return index, nil
+	}
+	return audio.GetDeviceIndexByName(name)
+}
+
+// moveRecording moves the single file of a session to path, converting
+// it when the extension asks for another format, and points the report
+// at it.
+func moveRecording(report *recorder.SessionReport, path string) error {
+	if len(report.Tracks) > 0 || len(report.Segments) > 1 {
+		return fmt.Errorf("session %s produced several files, -out needs one", report.SessionID)
+	}
+	if report.FilePath == "" {
+		return fmt.Errorf("no file produced for session %s", report.SessionID)
+	}
+
+	if filepath.Ext(path) == filepath.Ext(report.FilePath) {
+		if err := os.Rename(report.FilePath, path); err != nil {
+			return err
+		}
+	} else {
+		if _, err := audio.Convert(report.FilePath, path, audio.ConvertOptions{}); err != nil {
+			return err
+		}
+		os.Remove(report.FilePath)
+	}
+	// Leaves the session directory alone unless it is empty now.
+	os.Remove(filepath.Dir(report.FilePath))
+	report.FilePath = path
+	if len(report.Segments) == 1 {
+		report.Segments[0].FilePath = path
+	}
+	return nil
+}
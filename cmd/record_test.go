@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/otis-co-ltd/aihub-recorder/internal/audio"
+	"github.com/otis-co-ltd/aihub-recorder/internal/recorder"
+)
+
+func TestMoveRecording(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		out    string
+		tracks int
+		// segments is the number of files of a segmented recording.
+		segments int
+		format   string
+		fail     bool
+	}{
+		{name: "rename", out: "out.aiff", format: "aiff"},
+		{name: "convert", out: "out.wav", format: "wav"},
+		{name: "one segment", out: "out.aiff", segments: 1, format: "aiff"},
+		{name: "tracks", out: "out.aiff", tracks: 2, fail: true},
+		{name: "segments", out: "out.aiff", segments: 2, fail: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			sessionDir := filepath.Join(dir, "s1")
+			if err := os.Mkdir(sessionDir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			recorded := filepath.Join(sessionDir, "s1.aiff")
+			writeTestFile(t, recorded, 800)
+
+			report := &recorder.SessionReport{SessionID: "s1"}
+			report.FilePath = recorded
+			for i := 0; i < test.tracks; i++ {
+				report.Tracks = append(report.Tracks, &recorder.TrackReport{})
+			}
+			for i := 0; i < test.segments; i++ {
+				report.Segments = append(report.Segments, audio.Segment{Index: i + 1, FilePath: recorded})
+			}
+
+			out := filepath.Join(dir, test.out)
+			err := moveRecording(report, out)
+			if test.fail {
+				if err == nil {
+					t.Fatal("moveRecording succeeded")
+				}
+				if report.FilePath != recorded {
+					t.Errorf("report points at %s after a failed move", report.FilePath)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if report.FilePath != out || (test.segments == 1 && report.Segments[0].FilePath != out) {
+				t.Errorf("report points at %s and segments %+v, want %s", report.FilePath, report.Segments, out)
+			}
+			info, err := audio.Verify(out)
+			if err != nil || info.Format != test.format || info.Frames != 800 {
+				t.Errorf("Verify %s: %+v, %v", out, info, err)
+			}
+			// The recording is gone, and with it the empty session directory.
+			if _, err := os.Stat(sessionDir); !os.IsNotExist(err) {
+				t.Errorf("session directory left behind: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/otis-co-ltd/aihub-recorder/internal/audio"
+	"github.com/otis-co-ltd/aihub-recorder/internal/recorder"
+)
+
+// sessionSummary is the JSON output of the sessions command for one
+// session directory.
+type sessionSummary struct {
+	SessionID string    `json:"session_id"`
+	Path      string    `json:"path"`
+	Modified  time.Time `json:"modified"`
+	Size      int64     `json:"size"`
+	// Files lists the recordings in the directory as Verify read them,
+	// including the outputs of post-processing; a file that is still
+	// being recorded shows up with problems.
+	Files []*audio.FileInfo `json:"files"`
+}
+
+// runSessions lists the sessions in SYS_RECORD_PATH. Every session
+// records into a directory named after it, so this shows what was
+// recorded on this Pi, including files whose upload failed.
+func runSessions(args []string) int {
+	flags := flag.NewFlagSet("sessions", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print the sessions as a JSON array")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: pi-client sessions [-json]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+
+	root := recorder.GetConfig().SYS_RECORD_PATH
+	entries, err := os.ReadDir(root)
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "sessions: %v\n", err)
+		return 1
+	}
+
+	sessions := []*sessionSummary{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		session, err := readSession(filepath.Join(root, entry.Name()))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "sessions: %v\n", err)
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+
+	if *asJSON {
+		printJSON(sessions)
+		return 0
+	}
+	for _, session := range sessions {
+		fmt.Printf("%-32s %s  %3d files  %7.1f MB\n", session.SessionID, session.Modified.Format("2006-01-02 15:04"),
+			len(session.Files), float64(session.Size)/(1<<20))
+		for _, file := range session.Files {
+			if len(file.Problems) > 0 {
+				fmt.Printf("    FAIL  %s: %s\n", filepath.Base(file.Path), file.Problems[0])
+			}
+		}
+	}
+	return 0
+}
+
+// readSession describes the audio files in one session directory.
+func readSession(dir string) (*sessionSummary, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &sessionSummary{
+		SessionID: filepath.Base(dir),
+		Path:      dir,
+		Files:     []*audio.FileInfo{},
+	}
+	for _, entry := range entries {
+		switch filepath.Ext(entry.Name()) {
+		case ".aiff", ".aif", ".wav":
+		default:
+			continue
+		}
+		if stat, err := entry.Info(); err == nil && stat.ModTime().After(session.Modified) {
+			session.Modified = stat.ModTime()
+		}
+
+		info, _ := audio.Verify(filepath.Join(dir, entry.Name()))
+		if info == nil {
+			continue
+		}
+		session.Files = append(session.Files, info)
+		session.Size += info.Size
+	}
+	return session, nil
+}
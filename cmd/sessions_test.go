@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/otis-co-ltd/aihub-recorder/internal/recorder"
+)
+
+func TestSessions(t *testing.T) {
+	root := t.TempDir()
+	cfg := recorder.GetConfig()
+	recordPath := cfg.SYS_RECORD_PATH
+	cfg.SYS_RECORD_PATH = root
+	t.Cleanup(func() { cfg.SYS_RECORD_PATH = recordPath })
+
+	for _, dir := range []string{"s1", "s2", "empty"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeTestFile(t, filepath.Join(root, "s1", "s1.aiff"), 800)
+	writeTestFile(t, filepath.Join(root, "s1", "s1_denoised.wav"), 800)
+	// Files that are not recordings are left out.
+	for _, name := range []string{"s1/report.json", "stray.aiff"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte("{}"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A file still being recorded has an incomplete header.
+	if err := os.WriteFile(filepath.Join(root, "s2", "s2.aiff"), []byte("FORM\x00\x00\x00\x00AIFF"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var status int
+	output := captureStdout(t, func() { status = runSessions([]string{"-json"}) })
+	if status != 0 {
+		t.Fatalf("exit status %d", status)
+	}
+	var sessions []sessionSummary
+	if err := json.Unmarshal([]byte(output), &sessions); err != nil {
+		t.Fatalf("%v in %s", err, output)
+	}
+
+	want := []struct {
+		id       string
+		files    int
+		problems []bool
+	}{
+		{"empty", 0, nil},
+		{"s1", 2, []bool{false, false}},
+		{"s2", 1, []bool{true}},
+	}
+	if len(sessions) != len(want) {
+		t.Fatalf("%d sessions, want %d: %s", len(sessions), len(want), output)
+	}
+	for i, w := range want {
+		session := sessions[i]
+		if session.SessionID != w.id || len(session.Files) != w.files {
+			t.Errorf("session %d: %s with %d files, want %s with %d", i, session.SessionID, len(session.Files), w.id, w.files)
+			continue
+		}
+		var size int64
+		for j, file := range session.Files {
+			if (len(file.Problems) > 0) != w.problems[j] {
+				t.Errorf("%s: problems %q", file.Path, file.Problems)
+			}
+			size += file.Size
+		}
+		if session.Size != size {
+			t.Errorf("%s: size %d, want %d", session.SessionID, session.Size, size)
+		}
+	}
+}
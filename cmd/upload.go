@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/otis-co-ltd/aihub-recorder/internal/audio"
+	"github.com/otis-co-ltd/aihub-recorder/internal/config"
+	"github.com/otis-co-ltd/aihub-recorder/internal/wsclient"
+)
+
+// uploadResult is the JSON output of the upload command for one file.
+type uploadResult struct {
+	Path      string `json:"path"`
+	SessionID string `json:"session_id"`
+	Uploaded  bool   `json:"uploaded"`
+	Error     string `json:"error,omitempty"`
+}
+
+// runUpload uploads each file named in args to the backend, for example
+// a recording whose upload failed. The manifest describes the file as
+// verified. Without -session, the session ID is taken from the file's
+// own metadata or else from the session directory it is in.
+func runUpload(args []string) int {
+	flags := flag.NewFlagSet("upload", flag.ExitOnError)
+	sessionID := flags.String("session", "", "session ID to upload the files under")
+	asJSON := flags.Bool("json", false, "print one JSON object per file")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: pi-client upload [-session id] [-json] file...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	status := 0
+	for _, path := range flags.Args() {
+		result := uploadResult{Path: path, SessionID: *sessionID}
+		if result.SessionID == "" {
+			result.SessionID = fileSessionID(path)
+		}
+
+		info, err := audio.Verify(path)
+		if err == nil {
+			fields := map[string]string{"session_id": result.SessionID}
+			err = wsclient.UploadFile(path, fields, info)
+		}
+		if err != nil {
+			status = 1
+			result.Error = err.Error()
+		}
+		result.Uploaded = err == nil
+
+		switch {
+		case *asJSON:
+			printJSON(result)
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		default:
+			fmt.Printf("%s -> %s (session %s)\n", path, config.UploadURL, result.SessionID)
+		}
+	}
+	return status
+}
+
+// fileSessionID returns the session a recording belongs to: the one in
+// its AIFF or WAV metadata, or else the name of its directory, since
+// sessions record into SYS_RECORD_PATH/<session id>.
+func fileSessionID(path string) string {
+	if filepath.Ext(path) == ".wav" {
+		// INAM holds the session ID, with or without Broadcast Wave chunks.
+		if meta, err := audio.ReadWAVMetadata(path); err == nil && meta.Name != "" {
+			return meta.Name
+		}
+	} else if meta, err := audio.ReadAIFFMetadata(path); err == nil && meta.Recording != nil && meta.Recording.SessionID != "" {
+		return meta.Recording.SessionID
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(filepath.Dir(abs))
+}
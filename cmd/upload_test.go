@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/otis-co-ltd/aihub-recorder/internal/audio"
+)
+
+func TestFileSessionID(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		file string
+		meta *audio.FileMetadata
+		want string
+	}{
+		{"aiff metadata", "take.aiff", &audio.FileMetadata{SessionID: "from-appl", PiID: "pi07"}, "from-appl"},
+		{"wav metadata", "take.wav", &audio.FileMetadata{SessionID: "from-inam", PiID: "pi07"}, "from-inam"},
+		{"aiff directory", "take.aiff", nil, "session-dir"},
+		{"wav directory", "take.wav", nil, "session-dir"},
+		{"unreadable", "notes.txt", nil, "session-dir"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "session-dir")
+			if err := os.Mkdir(dir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(dir, test.file)
+			if filepath.Ext(path) == ".txt" {
+				if err := os.WriteFile(path, []byte("not audio"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				writeTestFile(t, path, 800)
+			}
+			if test.meta != nil {
+				if err := audio.WriteFileMetadata(path, *test.meta); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got := fileSessionID(path); got != test.want {
+				t.Errorf("fileSessionID = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
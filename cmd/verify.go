@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/otis-co-ltd/aihub-recorder/internal/audio"
+)
+
+// runVerify checks the structure of each AIFF or WAV file named in args
+// and prints the result. It returns the exit status, 1 if any file is
+// invalid or unreadable.
+func runVerify(args []string) int {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print one JSON object per file")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: pi-client verify [-json] file...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	status := 0
+	for _, path := range flags.Args() {
+		info, err := audio.Verify(path)
+		if err != nil {
+			status = 1
+		}
+		if info == nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			continue
+		}
+
+		if *asJSON {
+			printJSON(info)
+			continue
+		}
+		if err == nil {
+			fmt.Printf("ok    %s (%s, %d ch, %d-bit, %g Hz, %.2f s)\n", path, info.Format, info.Channels, info.BitsPerSample, info.SampleRate, info.Seconds)
+			continue
+		}
+		fmt.Printf("FAIL  %s\n", path)
+		for _, problem := range info.Problems {
+			fmt.Printf("      %s\n", problem)
+		}
+	}
+	return status
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/otis-co-ltd/aihub-recorder/internal/audio"
+)
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	aiff := filepath.Join(dir, "take.aiff")
+	wav := filepath.Join(dir, "take.wav")
+	writeTestFile(t, aiff, 800)
+	writeTestFile(t, wav, 800)
+	// A recording cut off before its header was completed.
+	truncated := filepath.Join(dir, "truncated.aiff")
+	data, err := os.ReadFile(aiff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(truncated, data[:len(data)-100], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name     string
+		files    []string
+		status   int
+		problems []bool
+	}{
+		{"valid", []string{aiff, wav}, 0, []bool{false, false}},
+		{"truncated", []string{aiff, truncated}, 1, []bool{false, true}},
+		// A missing file prints nothing on stdout.
+		{"missing", []string{filepath.Join(dir, "missing.aiff"), wav}, 1, []bool{false}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var status int
+			output := captureStdout(t, func() { status = runVerify(append([]string{"-json"}, test.files...)) })
+			if status != test.status {
+				t.Errorf("exit status %d, want %d", status, test.status)
+			}
+
+			lines := strings.Split(strings.TrimSpace(output), "\n")
+			if len(lines) != len(test.problems) {
+				t.Fatalf("%d lines of output, want %d:\n%s", len(lines), len(test.problems), output)
+			}
+			for i, line := range lines {
+				var info audio.FileInfo
+				if err := json.Unmarshal([]byte(line), &info); err != nil {
+					t.Fatalf("line %d: %v", i, err)
+				}
+				if (len(info.Problems) > 0) != test.problems[i] {
+					t.Errorf("%s: problems %q", info.Path, info.Problems)
+				}
+				if !test.problems[i] && (info.Channels != 1 || info.SampleRate != 8000 || info.Frames != 800) {
+					t.Errorf("%s: %d channels at %g Hz, %d frames; want 1 at 8000 Hz, 800", info.Path, info.Channels, info.SampleRate, info.Frames)
+				}
+			}
+		})
+	}
+}
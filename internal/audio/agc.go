@@ -0,0 +1,271 @@
+package audio
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// agcCeiling is the highest peak the AGC lets through, just under
+	// full scale so the gained signal never clips.
+	agcCeiling = 0.98
+	// agcCurveToleranceDB is how far the curve may stray from the gain
+	// that was applied. Points a straight line replaces within it are
+	// left out.
+	agcCurveToleranceDB = 0.01
+	// agcMaxCurvePoints bounds the gain curve held in memory. Segmented
+	// recordings hand their curve to each segment and start over.
+	agcMaxCurvePoints = 1 << 20
+	// agcDetector is the time constant of the RMS level detector.
+	agcDetector = 100 * time.Millisecond
+	// agcHold is how long the gain is not raised again after a peak
+	// forced it down, so a burst of peaks costs one step rather than
+	// one per buffer.
+	agcHold = 100 * time.Millisecond
+)
+
+// AGCConfig holds the tuning of the automatic gain control.
+type AGCConfig struct {
+	TargetDBFS float64
+	MaxGainDB  float64
+	Attack     time.Duration
+	Release    time.Duration
+}
+
+// AGCPoint is one point of the applied gain curve. Gain moves linearly in
+// dB between points; two points on the same frame mark an instant step.
+type AGCPoint struct {
+	Frame  int64   `json:"frame"`
+	GainDB float64 `json:"gain_db"`
+}
+
+// AGCReport is the metadata needed to undo the AGC: dividing each frame by
+// the gain in effect at that frame restores the raw device level.
+type AGCReport struct {
+	TargetDBFS float64 `json:"target_dbfs"`
+	MaxGainDB  float64 `json:"max_gain_db"`
+	AttackMs   int64   `json:"attack_ms"`
+	ReleaseMs  int64   `json:"release_ms"`
+	// Curve is the gain of the whole recording. A segmented recording
+	// reports it with each segment instead.
+	Curve []AGCPoint `json:"curve,omitempty"`
+	// CurveTruncatedAt is the frame at which the curve reached
+	// agcMaxCurvePoints points; the gain after it is not recorded.
+	CurveTruncatedAt int64 `json:"curve_truncated_at,omitempty"`
+}
+
+// AutoGainControl raises quiet input towards a target RMS level. Gain
+// follows the level with separate attack and release times and is capped
+// at MaxGainDB; a buffer whose peak would clip is gained down instantly.
+type AutoGainControl struct {
+	config   AGCConfig
+	channels int
+	rate     float64
+	target   float64
+	maxGain  float64
+	levelSq  float64
+	gain     float64
+	frame    int64
+	// holdLeft is the time left in which the gain is not raised.
+	holdLeft float64
+
+	// curve is read by the disk writer at segment boundaries. Its last
+	// point is always at frame with gain, unless it was truncated. While
+	// pending, the last point may still move on along the line from the
+	// one before; slopeLo and slopeHi bound the slopes of that line that
+	// stay within tolerance of the points it replaced.
+	mu          sync.Mutex
+	curve       []AGCPoint
+	pending     bool
+	slopeLo     float64
+	slopeHi     float64
+	segmented   bool
+	truncatedAt int64
+}
+
+func NewAutoGainControl(config AGCConfig, channels int, sampleRate float64) *AutoGainControl {
+	target := math.Pow(10, config.TargetDBFS/20)
+	return &AutoGainControl{
+		config:   config,
+		channels: channels,
+		rate:     sampleRate,
+		target:   target,
+		maxGain:  math.Pow(10, config.MaxGainDB/20),
+		levelSq:  target * target,
+		gain:     1,
+		curve:    []AGCPoint{{Frame: 0, GainDB: 0}},
+	}
+}
+
+// Process applies the gain in place to a buffer of interleaved samples.
+func (a *AutoGainControl) Process(samples []int32) {
+	frames := len(samples) / a.channels
+	if frames == 0 {
+		return
+	}
+
+	sum, peak := 0.0, 0.0
+	for _, s := range samples {
+		x := float64(s) / (1 << 31)
+		sum += x * x
+		peak = math.Max(peak, math.Abs(x))
+	}
+	meanSq := sum / float64(len(samples))
+
+	blockTime := float64(frames) / a.rate
+	a.levelSq += (meanSq - a.levelSq) * (1 - math.Exp(-blockTime/agcDetector.Seconds()))
+
+	desired := a.maxGain
+	if a.levelSq > 0 {
+		desired = math.Min(a.target/math.Sqrt(a.levelSq), a.maxGain)
+	}
+	desired = math.Max(desired, 1)
+
+	timeConstant := a.config.Release
+	if desired < a.gain {
+		timeConstant = a.config.Attack
+	}
+	next := desired
+	if timeConstant > 0 {
+		next = desired + (a.gain-desired)*math.Exp(-blockTime/timeConstant.Seconds())
+	}
+
+	if a.holdLeft > 0 {
+		a.holdLeft -= blockTime
+		next = math.Min(next, a.gain)
+	}
+
+	start := a.gain
+	if peak > 0 && next*peak > agcCeiling {
+		next = agcCeiling / peak
+		a.holdLeft = agcHold.Seconds()
+		if start*peak > agcCeiling {
+			// Ramping down would let the first samples clip, drop at
+			// once.
+			start = next
+		}
+	}
+
+	// The gain moves from start to next in equal dB steps, as the curve
+	// describes it.
+	g, step := start, math.Pow(next/start, 1/float64(frames))
+	for f := 0; f < frames; f++ {
+		for c := 0; c < a.channels; c++ {
+			i := f*a.channels + c
+			samples[i] = floatToInt32(float64(samples[i]) / (1 << 31) * g)
+		}
+		g *= step
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if start != a.gain {
+		a.addPoint(a.frame, start)
+	}
+	a.gain = next
+	a.frame += int64(frames)
+	a.addPoint(a.frame, next)
+}
+
+// addPoint adds the gain at frame to the curve. A point after the last
+// one replaces it when the line from the point before still passes all
+// the gains in between within agcCurveToleranceDB. a.mu must be held.
+func (a *AutoGainControl) addPoint(frame int64, gain float64) {
+	if a.truncatedAt > 0 {
+		return
+	}
+	point := AGCPoint{Frame: frame, GainDB: 20 * math.Log10(gain)}
+	n := len(a.curve)
+	if n > 0 && a.curve[n-1] == point {
+		return
+	}
+	if a.pending && frame > a.curve[n-1].Frame {
+		anchor := a.curve[n-2]
+		span := float64(frame - anchor.Frame)
+		if slope := (point.GainDB - anchor.GainDB) / span; slope >= a.slopeLo && slope <= a.slopeHi {
+			a.curve[n-1] = point
+			a.slopeLo = max(a.slopeLo, (point.GainDB-agcCurveToleranceDB-anchor.GainDB)/span)
+			a.slopeHi = min(a.slopeHi, (point.GainDB+agcCurveToleranceDB-anchor.GainDB)/span)
+			return
+		}
+	}
+	if n >= agcMaxCurvePoints {
+		a.truncatedAt = a.curve[n-1].Frame
+		return
+	}
+
+	a.curve = append(a.curve, point)
+	// A step, two points on one frame, is kept as it is.
+	a.pending = n > 0 && frame > a.curve[n-1].Frame
+	if a.pending {
+		anchor := a.curve[n-1]
+		span := float64(frame - anchor.Frame)
+		a.slopeLo = (point.GainDB - agcCurveToleranceDB - anchor.GainDB) / span
+		a.slopeHi = (point.GainDB + agcCurveToleranceDB - anchor.GainDB) / span
+	}
+}
+
+// skip advances past frames written without gain, such as the silence
+// filling a device outage, holding the gain across them.
+// It must be called before the frames are queued to the writer.
+func (a *AutoGainControl) skip(frames int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.frame += frames
+	a.addPoint(a.frame, a.gain)
+}
+
+// takeCurve removes the curve of a segment from frame start up to end
+// and returns it relative to start. The gain at end stays behind as the
+// first point of the next segment.
+func (a *AutoGainControl) takeCurve(start, end int64) []AGCPoint {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.segmented = true
+
+	n := 0
+	for n < len(a.curve) && a.curve[n].Frame <= end {
+		n++
+	}
+	curve := make([]AGCPoint, 0, n+1)
+	for _, point := range a.curve[:n] {
+		curve = append(curve, AGCPoint{Frame: point.Frame - start, GainDB: point.GainDB})
+	}
+	if n == 0 {
+		return curve
+	}
+
+	anchor := a.curve[n-1]
+	if anchor.Frame < end && n < len(a.curve) {
+		// end falls between two points.
+		next := a.curve[n]
+		anchor = AGCPoint{
+			Frame:  end,
+			GainDB: anchor.GainDB + (next.GainDB-anchor.GainDB)*float64(end-anchor.Frame)/float64(next.Frame-anchor.Frame),
+		}
+		curve = append(curve, AGCPoint{Frame: end - start, GainDB: anchor.GainDB})
+	}
+	a.curve = append([]AGCPoint{anchor}, a.curve[n:]...)
+	a.pending = false
+	return curve
+}
+
+// Report returns the settings and gain curve. It must only be called once
+// recording has stopped.
+func (a *AutoGainControl) Report() *AGCReport {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	report := &AGCReport{
+		TargetDBFS:       a.config.TargetDBFS,
+		MaxGainDB:        a.config.MaxGainDB,
+		AttackMs:         a.config.Attack.Milliseconds(),
+		ReleaseMs:        a.config.Release.Milliseconds(),
+		CurveTruncatedAt: a.truncatedAt,
+	}
+	if !a.segmented {
+		report.Curve = append([]AGCPoint(nil), a.curve...)
+	}
+	return report
+}
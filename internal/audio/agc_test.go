@@ -0,0 +1,180 @@
+package audio
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// gainAt returns the gain in dB the curve gives for frame.
+func gainAt(curve []AGCPoint, frame int64) float64 {
+	i := 0
+	for i+1 < len(curve) && curve[i+1].Frame <= frame {
+		i++
+	}
+	if i+1 == len(curve) {
+		return curve[i].GainDB
+	}
+	p0, p1 := curve[i], curve[i+1]
+	return p0.GainDB + (p1.GainDB-p0.GainDB)*float64(frame-p0.Frame)/float64(p1.Frame-p0.Frame)
+}
+
+// agcInput returns noise that is quiet, then loud enough to make the AGC
+// clamp, then quiet again, in blocks of uneven size.
+func agcInput() [][]int32 {
+	rng := rand.New(rand.NewSource(1))
+	var blocks [][]int32
+	for i := 0; i < 600; i++ {
+		level := 0.01
+		if i >= 200 && i < 260 {
+			level = 0.5
+		}
+		block := make([]int32, 2*(32+rng.Intn(96)))
+		for j := range block {
+			block[j] = int32(level * (2*rng.Float64() - 1) * (1 << 31))
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+func newTestAGC() *AutoGainControl {
+	return NewAutoGainControl(AGCConfig{TargetDBFS: -20, MaxGainDB: 30, Attack: 10 * time.Millisecond, Release: 200 * time.Millisecond}, 2, 48000)
+}
+
+// agcRestoreTolerance is the relative error in a sample restored from the
+// curve: agcCurveToleranceDB, plus rounding to int32.
+var agcRestoreTolerance = math.Pow(10, agcCurveToleranceDB/20) - 1 + 1e-6
+
+func TestAGCCurveUndo(t *testing.T) {
+	agc := newTestAGC()
+	var raw, gained []int32
+	for _, block := range agcInput() {
+		raw = append(raw, block...)
+		agc.Process(block)
+		gained = append(gained, block...)
+	}
+
+	report := agc.Report()
+	frames := int64(len(raw) / 2)
+	if last := report.Curve[len(report.Curve)-1]; last.Frame != frames {
+		t.Errorf("curve ends at frame %d, recording at %d", last.Frame, frames)
+	}
+	checkRestore(t, report.Curve, 0, raw, gained)
+}
+
+// checkRestore divides the gained samples, starting at frame offset of
+// the recording, by the curve's gain and compares them with the raw ones.
+func checkRestore(t *testing.T, curve []AGCPoint, offset int64, raw, gained []int32) {
+	t.Helper()
+	for i := range gained {
+		frame := int64(i / 2)
+		gain := math.Pow(10, gainAt(curve, frame)/20)
+		restored := float64(gained[i]) / gain
+		if math.Abs(restored-float64(raw[i])) > agcRestoreTolerance*math.Abs(float64(raw[i]))+2 {
+			t.Fatalf("frame %d: restored %.0f, recorded %d", offset+frame, restored, raw[i])
+		}
+	}
+}
+
+func TestAGCCurveSegments(t *testing.T) {
+	agc := newTestAGC()
+	const segmentFrames = 5000
+
+	var raw, gained []int32
+	var frame, start int64
+	var curves [][]AGCPoint
+	for _, block := range agcInput() {
+		raw = append(raw, block...)
+		agc.Process(block)
+		gained = append(gained, block...)
+		frame += int64(len(block) / 2)
+		// The writer closes a segment some time after its end was
+		// captured.
+		if frame-start > segmentFrames+1000 {
+			curves = append(curves, agc.takeCurve(start, start+segmentFrames))
+			start += segmentFrames
+		}
+	}
+	curves = append(curves, agc.takeCurve(start, frame))
+
+	if agc.Report().Curve != nil {
+		t.Error("segmented recording reports a whole curve")
+	}
+	for i, curve := range curves {
+		offset := int64(i) * segmentFrames
+		end := min(offset+segmentFrames, frame)
+		checkRestore(t, curve, offset, raw[2*offset:2*end], gained[2*offset:2*end])
+	}
+}
+
+// TestAGCCurveLong records an hour of speech-like input in 64-frame
+// buffers, the default, and checks that the curve stays small and still
+// matches the applied gain at every buffer boundary.
+func TestAGCCurveLong(t *testing.T) {
+	if testing.Short() {
+		t.Skip("records an hour of audio")
+	}
+	const (
+		rate      = 48000
+		blockSize = 64
+		// maxPerHour is 50 points a second.
+		maxPerHour = 50 * 3600
+	)
+	agc := NewAutoGainControl(AGCConfig{TargetDBFS: -20, MaxGainDB: 30, Attack: 10 * time.Millisecond, Release: 1000 * time.Millisecond}, 1, rate)
+
+	// Syllables of 100 to 400 ms between -50 and -15 dBFS, one in four
+	// of them a pause.
+	rng := rand.New(rand.NewSource(1))
+	noise := uint32(1)
+	block := make([]int32, blockSize)
+	var gains []float64
+	level, left := 0.0, 0
+	for frame := 0; frame < 3600*rate; frame += blockSize {
+		if left <= 0 {
+			left = rate/10 + rng.Intn(rate*3/10)
+			level = math.Pow(10, (-50+35*rng.Float64())/20)
+			if rng.Intn(4) == 0 {
+				level = 0
+			}
+		}
+		left -= blockSize
+		for i := range block {
+			noise ^= noise << 13
+			noise ^= noise >> 17
+			noise ^= noise << 5
+			block[i] = int32(level * float64(int32(noise)))
+		}
+		agc.Process(block)
+		gains = append(gains, 20*math.Log10(agc.gain))
+	}
+
+	report := agc.Report()
+	if report.CurveTruncatedAt != 0 {
+		t.Fatalf("curve truncated at frame %d", report.CurveTruncatedAt)
+	}
+	if n := len(report.Curve); n > maxPerHour {
+		t.Errorf("curve has %d points for an hour, want at most %d", n, maxPerHour)
+	}
+	t.Logf("%d points, %.1f per second", len(report.Curve), float64(len(report.Curve))/3600)
+
+	// The gain moves linearly in dB within a buffer, so the curve is
+	// furthest from it at buffer boundaries. A step at a boundary comes
+	// after the gain the buffer ended with.
+	point := 0
+	for i, want := range gains {
+		frame := int64(i+1) * blockSize
+		for point+1 < len(report.Curve) && report.Curve[point+1].Frame < frame {
+			point++
+		}
+		p0, p1 := report.Curve[point], report.Curve[min(point+1, len(report.Curve)-1)]
+		got := p0.GainDB
+		if p1.Frame > p0.Frame {
+			got += (p1.GainDB - p0.GainDB) * float64(frame-p0.Frame) / float64(p1.Frame-p0.Frame)
+		}
+		if math.Abs(got-want) > agcCurveToleranceDB+1e-9 {
+			t.Fatalf("frame %d: curve gives %.4f dB, applied %.4f dB", frame, got, want)
+		}
+	}
+}
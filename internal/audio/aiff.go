@@ -2,196 +2,468 @@ package audio
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
-	"sync"
-
-	"github.com/gordonklaus/portaudio"
+	"sync/atomic"
+	"time"
 )
 
+const defaultWriteBuffer = 10 * time.Second
+
 var lastRecordedFile string
-var portaudioInitialized bool
-var portaudioMutex sync.Mutex
 
 type AIFFAudioFormat struct {
-	AudioFile       *os.File
 	Channel         int16
 	BitsPerSample   int16
 	SampleRate      float64
-	NumberOfSamples int32
 	InputBufferSize int
 	RecControlSig   *RecondControlSignal
 	DeviceIndex     int
+	AGC             *AutoGainControl
+	ChannelMap      []int
+	Backend         CaptureBackend
+	Recovery        *RecoveryPolicy
+	// WriteBuffer is how much audio may queue up for the disk before
+	// captured blocks are dropped.
+	WriteBuffer time.Duration
+	// Segmenting splits the recording into several files. Without it a
+	// recording is one file, unless it outgrows the AIFF size limit.
+	Segmenting *SegmentPolicy
+	// Metadata is written into each file once it is complete.
+	Metadata *FileMetadata
+	// CaptureRate is the rate the device is opened at, when it differs
+	// from SampleRate; the audio is resampled before it is written.
+	CaptureRate float64
+
+	format    fileFormat
+	output    *segmenter
+	writer    *blockWriter
+	counter   captureCounter
+	resampler *Resampler
+	// resampled takes the resampler output while no block is free.
+	resampled []int32
+
+	// pauseRequest is set by SetPaused; paused is the state the capture
+	// loop acts on.
+	pauseRequest atomic.Bool
+	paused       bool
+	pauses       pauseLog
+	markers      markerLog
 }
 
 func NewAIFFAudioFormat() *AIFFAudioFormat {
 	return &AIFFAudioFormat{
 		DeviceIndex: -1,
+		Backend:     GetCaptureBackend(),
+		format:      aiffFormat{},
 	}
 }
 
-func InitPortAudio() error {
-	portaudioMutex.Lock()
-	defer portaudioMutex.Unlock()
-
-	if !portaudioInitialized {
-		if err := portaudio.Initialize(); err != nil {
-			return err
-		}
-		portaudioInitialized = true
-		log.Println("? PortAudio initialized globally")
-	}
-	return nil
-}
-
 func (af *AIFFAudioFormat) CreateFilePath(sysPath, filename string) string {
-	return filepath.Join(sysPath, fmt.Sprintf("%s.%s", filename, af.GetFileType()))
+	return filepath.Join(sysPath, fmt.Sprintf("%s.%s", filename, af.format.ext()))
 }
 
-func (af *AIFFAudioFormat) Init(recordControlSig *RecondControlSignal, sysPath, filename string, channel int16, sampleRate float64, inputBufSize int) {
+func (af *AIFFAudioFormat) Init(recordControlSig *RecondControlSignal, sysPath, filename string, channel int16, sampleRate float64, inputBufSize int) error {
+	if channel < 1 || sampleRate <= 0 || inputBufSize < 1 {
+		return fmt.Errorf("invalid format: %d channels, %g Hz, %d frames per buffer", channel, sampleRate, inputBufSize)
+	}
+
 	af.RecControlSig = recordControlSig
 	af.Channel = channel
 	af.SampleRate = sampleRate
 	af.BitsPerSample = 32
 	af.InputBufferSize = inputBufSize
-	af.NumberOfSamples = 0
 
-	filePath := af.CreateFilePath(sysPath, filename)
-	lastRecordedFile = filePath
 	if sysPath != "" {
-		os.MkdirAll(sysPath, os.ModePerm)
+		if err := os.MkdirAll(sysPath, os.ModePerm); err != nil {
+			return err
+		}
+	}
+
+	output, err := newSegmenter(sysPath, filename, af.format, af.Channel, af.SampleRate, af.Segmenting, af.Metadata, &af.markers, af.AGC)
+	if err != nil {
+		return err
+	}
+	af.output = output
+	lastRecordedFile = output.path()
+	return nil
+}
+
+// writeAIFFHeader writes the FORM, COMM and SSND headers for a file with
+// numFrames frames. Sizes are left at zero when numFrames is unknown and
+// patched later by WrapUp.
+func writeAIFFHeader(w io.Writer, channel int16, numFrames int32, bitsPerSample int16, sampleRate float64) error {
+	bytesPerSample := int32(bitsPerSample / 8)
+	dataBytes := numFrames * int32(channel) * bytesPerSample
+	formSize := int32(0)
+	ssndSize := int32(0)
+	if numFrames > 0 {
+		formSize = 4 + 8 + 18 + 8 + 8 + dataBytes
+		ssndSize = dataBytes + 8
+	}
+
+	header := []interface{}{
+		[]byte("FORM"), formSize, []byte("AIFF"),
+		[]byte("COMM"), int32(18), channel, numFrames, bitsPerSample, SampleRateToByte(sampleRate),
+		[]byte("SSND"), ssndSize, int32(0), int32(0),
 	}
+	for _, v := range header {
+		if err := binary.Write(w, binary.BigEndian, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// aiffMaxDataBytes caps the sound data of one file below the signed
+// 32-bit FORM size, leaving room for the header, metadata and a MARK
+// chunk.
+const aiffMaxDataBytes = 1<<31 - 1 - 16<<20
+
+// maxAIFFFrames is the most frames whose size still fits the signed
+// 32-bit FORM size of a 32-bit AIFF file.
+func maxAIFFFrames(channel int16) int64 {
+	return (1<<31 - 1 - 54) / int64(4*channel)
+}
+
+// aiffFormat writes recordings as 32-bit AIFF files.
+type aiffFormat struct{}
+
+func (aiffFormat) ext() string { return "aiff" }
+
+func (aiffFormat) encode(dst []byte, samples []int32) []byte {
+	return encodeSamples(dst, samples)
+}
+
+func (aiffFormat) maxDataBytes() int64 { return aiffMaxDataBytes }
+
+func (aiffFormat) writeHeader(w io.Writer, channel int16, sampleRate float64, meta *FileMetadata, startFrame int64) (int64, error) {
+	return 54, writeAIFFHeader(w, channel, 0, 32, sampleRate)
+}
 
-	file, err := os.Create(filePath)
-	must(err)
+func (aiffFormat) complete(file *os.File, dataOffset, frames int64, channel int16) error {
+	if frames > maxAIFFFrames(channel) {
+		return fmt.Errorf("%d frames do not fit in an AIFF header", frames)
+	}
+	dataBytes := 4 * int32(frames) * int32(channel)
+	patches := []struct {
+		offset int64
+		value  int32
+	}{
+		{4, int32(dataOffset) - 8 + dataBytes},
+		{22, int32(frames)},
+		{42, dataBytes + 8},
+	}
+	for _, p := range patches {
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], uint32(p.value))
+		if _, err := file.WriteAt(b[:], p.offset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	file.WriteString("FORM")
-	must(binary.Write(file, binary.BigEndian, int32(0)))
-	file.WriteString(strings.ToUpper(af.GetFileType()))
-	file.WriteString("COMM")
-	must(binary.Write(file, binary.BigEndian, int32(18)))
-	must(binary.Write(file, binary.BigEndian, af.Channel))
-	must(binary.Write(file, binary.BigEndian, af.NumberOfSamples))
-	must(binary.Write(file, binary.BigEndian, af.BitsPerSample))
-	file.Write(SampleRateToByte(af.SampleRate))
-	file.WriteString("SSND")
-	must(binary.Write(file, binary.BigEndian, int32(0)))
-	must(binary.Write(file, binary.BigEndian, int32(0)))
-	must(binary.Write(file, binary.BigEndian, int32(0)))
+func (aiffFormat) writeMetadata(path string, meta FileMetadata) error {
+	return WriteAIFFMetadata(path, meta)
+}
 
-	af.AudioFile = file
+func (aiffFormat) writeMarkers(path string, markers []Marker) error {
+	return WriteAIFFMarkers(path, markers)
 }
 
 func (af *AIFFAudioFormat) SetDeviceIndex(deviceIndex int) {
 	af.DeviceIndex = deviceIndex
 }
 
+func (af *AIFFAudioFormat) SetGainControl(agc *AutoGainControl) {
+	af.AGC = agc
+}
+
+func (af *AIFFAudioFormat) SetChannelMap(channelMap []int) {
+	af.ChannelMap = channelMap
+}
+
+func (af *AIFFAudioFormat) SetCaptureRate(rate float64) {
+	af.CaptureRate = rate
+}
+
 func (af *AIFFAudioFormat) GetFileType() string { return "aiff" }
 
-func (af *AIFFAudioFormat) Record() {
-	if af.AudioFile == nil {
-		panic("audio file not initialized")
+// ErrDeviceLost ends a recording whose device stopped delivering audio,
+// for example because it was unplugged. The file up to that point is
+// complete.
+var ErrDeviceLost = errors.New("capture device lost")
+
+// deviceLost finalizes the file after the stream failed.
+func (af *AIFFAudioFormat) deviceLost(cause error) error {
+	log.Printf("⚠️ Recording interrupted after %d frames: %v", af.counter.snapshot().Frames, cause)
+	if err := af.finalize(); err != nil {
+		return fmt.Errorf("finalize after %v: %w", cause, err)
 	}
+	return fmt.Errorf("%w: %v", ErrDeviceLost, cause)
+}
 
-	log.Printf("🔧 DEBUG: Starting recording with DeviceIndex=%d", af.DeviceIndex)
+// finish finalizes the file on a stop or grace-kill signal and
+// acknowledges it. The acknowledgement is sent even when finalizing
+// failed, since the sender is waiting for it.
+func (af *AIFFAudioFormat) finish(ctl int) error {
+	err := af.finalize()
+	af.acknowledge(ctl)
+	return err
+}
 
-	fmt.Println("Starting AIFF recording...")
-	defer af.WrapUp()
+func (af *AIFFAudioFormat) acknowledge(ctl int) {
+	if ctl == AUDIO_GRACE_KILL_SIG_REQ {
+		af.RecControlSig.Sig <- AUDIO_GRACE_KILL_SIG_PROC
+	} else {
+		af.RecControlSig.Sig <- AUDIO_CTL_REC_FULLY_STOPPED
+	}
+}
 
-	if err := portaudio.Initialize(); err != nil {
-		panic(err)
+// Record captures until it receives a stop signal and returns nil once
+// the file is finalized and the signal acknowledged. Any other end of the
+// recording is returned as an error, wrapping ErrDeviceLost when the
+// device went away; the file is still finalized where possible.
+func (af *AIFFAudioFormat) Record() error {
+	if af.output == nil {
+		return fmt.Errorf("audio file not initialized")
 	}
 
-	in := make([]int32, af.InputBufferSize)
+	log.Printf("🔧 DEBUG: Starting recording with DeviceIndex=%d", af.DeviceIndex)
 
-	var inputDevice *portaudio.DeviceInfo
-	var err error
+	log.Printf("Starting %s recording...", strings.ToUpper(af.format.ext()))
 
-	// Select input device based on DeviceIndex
-	if af.DeviceIndex >= 0 {
-		devices, err := portaudio.Devices()
+	// Streams deliver the first N channels of a device, so with a channel
+	// map the stream is opened up to the highest mapped channel and only
+	// the mapped ones are copied into the file buffer.
+	streamChannels := int(af.Channel)
+	if len(af.ChannelMap) > 0 {
+		streamChannels = slices.Max(af.ChannelMap)
+	}
+	frames := af.InputBufferSize
+	raw := make([]int32, frames*streamChannels)
+	var mapped []int32
+	if len(af.ChannelMap) > 0 {
+		mapped = make([]int32, frames*int(af.Channel))
+	}
+
+	captureRate := af.SampleRate
+	blockFrames := frames
+	af.resampler = nil
+	if af.CaptureRate > 0 && af.CaptureRate != af.SampleRate {
+		resampler, err := NewResampler(af.CaptureRate, af.SampleRate, int(af.Channel))
 		if err != nil {
-			panic("failed to get devices: " + err.Error())
+			return errors.Join(err, af.finalize())
 		}
+		log.Printf("🔧 Capturing at %g Hz, writing at %g Hz", af.CaptureRate, af.SampleRate)
+		captureRate = af.CaptureRate
+		blockFrames = resampler.MaxOutput(frames)
+		af.resampler = resampler
+		af.resampled = make([]int32, blockFrames*int(af.Channel))
+	}
 
-		if af.DeviceIndex >= len(devices) {
-			panic(fmt.Sprintf("device index %d out of range (max %d)", af.DeviceIndex, len(devices)-1))
+	writeBuffer := af.WriteBuffer
+	if writeBuffer <= 0 {
+		writeBuffer = defaultWriteBuffer
+	}
+	blocks := max(2, int(writeBuffer.Seconds()*af.SampleRate)/blockFrames)
+	af.writer = newBlockWriter(af.output, af.format.encode, int(af.Channel), blockFrames*int(af.Channel), blocks)
+
+	params := CaptureParams{
+		DeviceIndex:     af.DeviceIndex,
+		Channels:        streamChannels,
+		SampleRate:      captureRate,
+		FramesPerBuffer: frames,
+	}
+	stream, err := af.Backend.Open(params)
+	if err != nil {
+		return errors.Join(fmt.Errorf("open device %d: %w", af.DeviceIndex, err), af.finalize())
+	}
+	defer func() {
+		if stream != nil {
+			stream.Close()
 		}
+	}()
+	if err := stream.Start(); err != nil {
+		return errors.Join(fmt.Errorf("start device %d: %w", af.DeviceIndex, err), af.finalize())
+	}
 
-		inputDevice = devices[af.DeviceIndex]
-		fmt.Printf("Using input device [%d]: %s\n", af.DeviceIndex, inputDevice.Name)
+	for {
+		err := stream.Read(raw)
+		overflow := errors.Is(err, ErrOverflow)
+		if err != nil && !overflow {
+			stream.Stop()
+			stream.Close()
+			stream = nil
+			if af.Recovery == nil {
+				return af.deviceLost(err)
+			}
 
-		// If DeviceIndex is not set, use default input device
-	} else {
-		inputDevice, err = portaudio.DefaultInputDevice()
-		if err != nil {
-			panic("no input device found: " + err.Error())
+			var done bool
+			stream, done, err = af.reconnect(params, err)
+			if done {
+				return err
+			}
+			if err != nil {
+				return af.deviceLost(err)
+			}
+			continue
 		}
-		fmt.Println("Using default input device:", inputDevice.Name)
-	}
 
-	// Open stream with specific device
-	streamParams := portaudio.StreamParameters{
-		Input: portaudio.StreamDeviceParameters{
-			Device:   inputDevice,
-			Channels: int(af.Channel),
-			Latency:  inputDevice.DefaultLowInputLatency,
-		},
-		SampleRate:      af.SampleRate,
-		FramesPerBuffer: len(in),
-	}
-
-	stream, err := portaudio.OpenStream(streamParams, in)
-	must(err)
-	defer stream.Close()
-	must(stream.Start())
+		// While paused the device is still read, but the audio is
+		// discarded.
+		af.updatePause()
+		if !af.paused {
+			if overflow {
+				af.counter.overflow()
+			}
+			samples := raw
+			if len(af.ChannelMap) > 0 {
+				selectChannels(mapped, raw, af.ChannelMap, streamChannels)
+				samples = mapped
+			}
+			af.capture(samples)
+		}
 
-	for {
-		must(stream.Read())
-		must(binary.Write(af.AudioFile, binary.BigEndian, in))
-		af.NumberOfSamples += int32(len(in))
+		if af.writer.Err() != nil {
+			stream.Stop()
+			return fmt.Errorf("write audio: %w", af.finalize())
+		}
 
 		select {
 		case ctl := <-af.RecControlSig.Sig:
-			if ctl == AUDIO_CTL_STOP_REC {
-				must(stream.Stop())
-				af.RecControlSig.Sig <- AUDIO_CTL_REC_FULLY_STOPPED
-				return
-			}
-			if ctl == AUDIO_GRACE_KILL_SIG_REQ {
-				must(stream.Stop())
-				af.WrapUp()
-				af.RecControlSig.Sig <- AUDIO_GRACE_KILL_SIG_PROC
-				return
+			if ctl == AUDIO_CTL_STOP_REC || ctl == AUDIO_GRACE_KILL_SIG_REQ {
+				if err := stream.Stop(); err != nil {
+					log.Printf("Failed to stop stream: %v", err)
+				}
+				return af.finish(ctl)
 			}
 		default:
 		}
 	}
 }
 
-func (af *AIFFAudioFormat) WrapUp() {
-	if af.AudioFile == nil {
-		log.Fatal("audio file empty")
+// capture queues one buffer of samples in the file's channel layout for
+// the disk, resampled to the file's rate if needed.
+func (af *AIFFAudioFormat) capture(samples []int32) {
+	block := af.writer.get()
+	switch {
+	case af.resampler != nil:
+		// The resampler also runs for a dropped block, so the audio
+		// around the gap stays continuous.
+		dst := block
+		if dst == nil {
+			dst = af.resampled
+		}
+		af.queue(block, dst[:af.resampler.Process(dst, samples)])
+	case block != nil:
+		af.queue(block, block[:copy(block, samples)])
+	default:
+		af.queue(nil, samples)
 	}
+}
 
-	totalBytes := 4 + 8 + 18 + 8 + 8 + 4*af.NumberOfSamples
-	_, err := af.AudioFile.Seek(4, 0)
-	must(err)
-	must(binary.Write(af.AudioFile, binary.BigEndian, totalBytes))
+// queue passes samples, held in block, through the gain control to the
+// writer. Without a block the samples are counted as dropped.
+func (af *AIFFAudioFormat) queue(block, samples []int32) {
+	frames := int64(len(samples) / int(af.Channel))
+	if block == nil {
+		af.counter.dropped(frames)
+		return
+	}
+	if af.AGC != nil {
+		af.AGC.Process(samples)
+	}
+	af.writer.put(samples)
+	af.counter.captured(frames)
+}
+
+// flushResampler queues the audio the resampler still holds back and
+// resets it, before the input stops or jumps.
+func (af *AIFFAudioFormat) flushResampler() {
+	if af.resampler == nil || af.writer == nil {
+		return
+	}
+	for {
+		block := af.writer.get()
+		dst := block
+		if dst == nil {
+			dst = af.resampled
+		}
+		n := af.resampler.Flush(dst)
+		af.queue(block, dst[:n])
+		if n == 0 {
+			break
+		}
+	}
+	af.resampler.Reset()
+}
 
-	_, err = af.AudioFile.Seek(22, 0)
-	must(err)
-	must(binary.Write(af.AudioFile, binary.BigEndian, af.NumberOfSamples))
+// finalize waits for queued blocks to reach the disk and closes the file.
+func (af *AIFFAudioFormat) finalize() error {
+	af.pauses.end(false)
 
-	_, err = af.AudioFile.Seek(42, 0)
-	must(err)
-	must(binary.Write(af.AudioFile, binary.BigEndian, int32(4*af.NumberOfSamples+8)))
+	var writeErr error
+	if af.writer != nil {
+		af.flushResampler()
+		writeErr = af.writer.Close()
+		af.writer = nil
+	}
+	return errors.Join(writeErr, af.WrapUp())
+}
 
-	must(af.AudioFile.Close())
-	fmt.Println("AIFF recording finished")
+// Stats reports the frames captured and lost so far. It may be called
+// while recording.
+func (af *AIFFAudioFormat) Stats() CaptureStats {
+	return af.counter.snapshot()
+}
+
+func (af *AIFFAudioFormat) SetWriteBuffer(d time.Duration) {
+	af.WriteBuffer = d
+}
+
+// selectChannels copies the 1-based channels of channelMap out of the
+// interleaved stream buffer raw into dst.
+func selectChannels(dst, raw []int32, channelMap []int, streamChannels int) {
+	frames := len(raw) / streamChannels
+	for f := 0; f < frames; f++ {
+		for i, ch := range channelMap {
+			dst[f*len(channelMap)+i] = raw[f*streamChannels+ch-1]
+		}
+	}
+}
+
+// WrapUp patches the header sizes of the last file for the frames
+// written to it and closes it.
+func (af *AIFFAudioFormat) WrapUp() error {
+	if af.output == nil {
+		return fmt.Errorf("audio file not initialized")
+	}
+	if err := af.output.Close(); err != nil {
+		return err
+	}
+	log.Printf("%s recording finished", strings.ToUpper(af.format.ext()))
+	return nil
+}
+
+func (af *AIFFAudioFormat) SetSegmenting(policy *SegmentPolicy) {
+	af.Segmenting = policy
+}
+
+// Segments lists the segments completed so far; it is empty unless the
+// recording is segmented.
+func (af *AIFFAudioFormat) Segments() []Segment {
+	if af.output == nil {
+		return nil
+	}
+	return af.output.list()
 }
 
 func GetLastFilePath() string {
@@ -0,0 +1,139 @@
+package audio
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+// BenchmarkRecordFourDevices records from four fake devices at once at
+// 48 kHz, two channels each, with the default 64-frame device buffer.
+// One op is one second of audio on every device, so ns/op below 1e9
+// means the four devices keep up with real time; x-realtime reports the
+// margin. The fake streams deliver frames as fast as they are read. The
+// samples carry 24 bits of signal in 32-bit words, which is how every
+// backend hands 24-bit capture to the recorder.
+func BenchmarkRecordFourDevices(b *testing.B) {
+	const devices, channels, rate = 4, 2, 48000
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	sources := make([]FakeSource, devices)
+	for i := range sources {
+		sources[i] = FakeSource{Signal: "sine", Frequency: 440 * float64(i+1), LevelDBFS: -12}
+	}
+	backend := NewFakeBackend(sources...)
+	backend.Realtime = false
+	dir := b.TempDir()
+
+	recorders := make([]*AIFFAudioFormat, devices)
+	done := make(chan error, devices)
+	for i := range recorders {
+		af := NewAIFFAudioFormat()
+		af.Backend = backend
+		af.SetDeviceIndex(i)
+		if err := af.Init(NewRecControlSig(), dir, fmt.Sprintf("device_%d", i), channels, rate, 64); err != nil {
+			b.Fatal(err)
+		}
+		recorders[i] = af
+	}
+
+	b.SetBytes(devices * rate * channels * 4)
+	b.ResetTimer()
+	for _, af := range recorders {
+		go func() { done <- af.Record() }()
+	}
+	for _, af := range recorders {
+		for af.Stats().Frames < int64(b.N)*rate {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	for _, af := range recorders {
+		af.RecControlSig.Sig <- AUDIO_CTL_STOP_REC
+		<-af.RecControlSig.Sig
+	}
+	for range recorders {
+		if err := <-done; err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(b.N)*float64(time.Second)/float64(b.Elapsed()), "x-realtime")
+}
+
+// newTestRecorder returns an initialized recorder that writes dir/take
+// from an unpaced fake sine device with two channels at 48 kHz. setup,
+// if not nil, configures it before Init.
+func newTestRecorder(t testing.TB, wav bool, setup func(af *AIFFAudioFormat)) (*AIFFAudioFormat, string) {
+	t.Helper()
+	backend := NewFakeBackend(FakeSource{Signal: "sine", Frequency: 1000, LevelDBFS: -12})
+	backend.Realtime = false
+
+	af := NewAIFFAudioFormat()
+	if wav {
+		wf := NewWAVAudioFormat()
+		wf.SetBroadcastWave(true)
+		af = &wf.AIFFAudioFormat
+	}
+	af.Backend = backend
+	af.SetDeviceIndex(0)
+	if setup != nil {
+		setup(af)
+	}
+	dir := t.TempDir()
+	if err := af.Init(NewRecControlSig(), dir, "take", 2, 48000, 64); err != nil {
+		t.Fatal(err)
+	}
+	return af, af.CreateFilePath(dir, "take")
+}
+
+// startRecording runs af.Record until the returned function is called,
+// which stops it and returns Record's result.
+func startRecording(af *AIFFAudioFormat) func() error {
+	done := make(chan error, 1)
+	go func() { done <- af.Record() }()
+	return func() error {
+		af.RecControlSig.Sig <- AUDIO_CTL_STOP_REC
+		<-af.RecControlSig.Sig
+		return <-done
+	}
+}
+
+// waitFrames waits until af has captured at least frames frames.
+func waitFrames(t testing.TB, af *AIFFAudioFormat, frames int64) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for af.Stats().Frames < frames {
+		if time.Now().After(deadline) {
+			t.Fatalf("captured %d frames, waiting for %d", af.Stats().Frames, frames)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSelectChannels(t *testing.T) {
+	// Three frames of a four channel stream; sample = 10*frame + channel.
+	raw := []int32{1, 2, 3, 4, 11, 12, 13, 14, 21, 22, 23, 24}
+	for _, test := range []struct {
+		channelMap []int
+		want       []int32
+	}{
+		{[]int{1, 2, 3, 4}, raw},
+		{[]int{1}, []int32{1, 11, 21}},
+		{[]int{4}, []int32{4, 14, 24}},
+		{[]int{2, 1}, []int32{2, 1, 12, 11, 22, 21}},
+		{[]int{3, 1, 4}, []int32{3, 1, 4, 13, 11, 14, 23, 21, 24}},
+	} {
+		dst := make([]int32, len(raw)/4*len(test.channelMap))
+		selectChannels(dst, raw, test.channelMap, 4)
+		if !slices.Equal(dst, test.want) {
+			t.Errorf("channel map %v selected %v, want %v", test.channelMap, dst, test.want)
+		}
+	}
+}
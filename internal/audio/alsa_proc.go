@@ -0,0 +1,148 @@
+package audio
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ALSA lists its cards and PCMs under /proc/asound. Reading it needs no
+// device access, so it also works while devices are busy recording.
+
+// procASound is where ALSA's /proc files are read; tests point it at a
+// copy.
+var procASound = "/proc/asound"
+
+type alsaCaps struct {
+	maxChannels int
+	rate        float64
+}
+
+// alsaPCM is one capture PCM found under /proc/asound.
+type alsaPCM struct {
+	card     int
+	device   int
+	cardID   string
+	cardName string
+	pcmName  string
+}
+
+func (pcm alsaPCM) path() string {
+	return fmt.Sprintf("/dev/snd/pcmC%dD%dc", pcm.card, pcm.device)
+}
+
+// stableName addresses the PCM by card id, which survives card
+// renumbering when USB devices are plugged in a different order.
+func (pcm alsaPCM) stableName() string {
+	return fmt.Sprintf("hw:CARD=%s,DEV=%d", pcm.cardID, pcm.device)
+}
+
+var procChannelsLine = regexp.MustCompile(`Channels:\s*(\d+)`)
+
+// procALSACaps reads the stream description USB audio cards publish.
+func procALSACaps(pcm alsaPCM) alsaCaps {
+	caps := alsaCaps{maxChannels: 1, rate: 48000}
+	data, err := os.ReadFile(filepath.Join(procASound, fmt.Sprintf("card%d/stream%d", pcm.card, pcm.device)))
+	if err != nil {
+		return caps
+	}
+
+	// The capture section follows the playback one when both exist.
+	text := string(data)
+	if i := strings.Index(text, "Capture:"); i >= 0 {
+		text = text[i:]
+	}
+	for _, m := range procChannelsLine.FindAllStringSubmatch(text, -1) {
+		if n, err := strconv.Atoi(m[1]); err == nil && n > caps.maxChannels {
+			caps.maxChannels = n
+		}
+	}
+	return caps
+}
+
+var procCardLine = regexp.MustCompile(`^\s*(\d+)\s+\[(\S+)\s*\]:\s+\S+\s+-\s+(.*)$`)
+
+func listALSACapturePCMs() ([]alsaPCM, error) {
+	file, err := os.Open(filepath.Join(procASound, "cards"))
+	if err != nil {
+		return nil, fmt.Errorf("ALSA not available: %w", err)
+	}
+	defer file.Close()
+
+	var pcms []alsaPCM
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		m := procCardLine.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		card, _ := strconv.Atoi(m[1])
+
+		dirs, _ := filepath.Glob(filepath.Join(procASound, fmt.Sprintf("card%d/pcm*c", card)))
+		for _, dir := range dirs {
+			device, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(dir), "pcm"), "c"))
+			if err != nil {
+				continue
+			}
+			pcms = append(pcms, alsaPCM{
+				card:     card,
+				device:   device,
+				cardID:   m[2],
+				cardName: strings.TrimSpace(m[3]),
+				pcmName:  readPCMName(dir),
+			})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(pcms, func(i, j int) bool {
+		if pcms[i].card != pcms[j].card {
+			return pcms[i].card < pcms[j].card
+		}
+		return pcms[i].device < pcms[j].device
+	})
+	return pcms, nil
+}
+
+func readPCMName(dir string) string {
+	data, err := os.ReadFile(filepath.Join(dir, "info"))
+	if err != nil {
+		return "PCM"
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if name, ok := strings.CutPrefix(line, "name: "); ok {
+			return strings.TrimSpace(name)
+		}
+	}
+	return "PCM"
+}
+
+// procCaptureDevices describes the capture PCMs from /proc alone,
+// indexed like the ALSA backend lists them.
+func procCaptureDevices() ([]AudioDevice, error) {
+	pcms, err := listALSACapturePCMs()
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]AudioDevice, 0, len(pcms))
+	for i, pcm := range pcms {
+		caps := procALSACaps(pcm)
+		devices = append(devices, AudioDevice{
+			Index:             i,
+			Name:              fmt.Sprintf("%s: %s (hw:%d,%d)", pcm.cardName, pcm.pcmName, pcm.card, pcm.device),
+			MaxInputChannels:  caps.maxChannels,
+			DefaultSampleRate: caps.rate,
+			HostAPI:           "ALSA",
+			ID:                stableDeviceID(pcm.card, pcm.device),
+		})
+	}
+	return devices, nil
+}
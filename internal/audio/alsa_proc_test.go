@@ -0,0 +1,109 @@
+package audio
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTree creates files under root, creating directories as needed.
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// fakeProcASound points procASound and sysfs at a tree holding files
+// and an empty sysfs for the rest of the test.
+func fakeProcASound(t *testing.T, files map[string]string) {
+	t.Helper()
+	root := t.TempDir()
+	writeTree(t, filepath.Join(root, "proc"), files)
+	procDir, sysDir := procASound, sysfs
+	procASound, sysfs = filepath.Join(root, "proc"), filepath.Join(root, "sys")
+	t.Cleanup(func() { procASound, sysfs = procDir, sysDir })
+}
+
+func TestProcCaptureDevices(t *testing.T) {
+	fakeProcASound(t, map[string]string{
+		"cards": ` 0 [vc4hdmi        ]: vc4-hdmi - vc4-hdmi
+                      vc4-hdmi
+ 1 [Device         ]: USB-Audio - USB Audio Device
+                      C-Media Electronics Inc. USB Audio Device at usb-3f980000.usb-1.2, full speed
+ 2 [Scarlett4i4USB ]: USB-Audio - Scarlett 4i4 USB
+                      Focusrite Scarlett 4i4 USB at usb-3f980000.usb-1.3, high speed
+`,
+		// The HDMI card only plays.
+		"card0/id":          "vc4hdmi\n",
+		"card0/pcm0p/info":  "card: 0\ndevice: 0\nname: MAI PCM i2s-hifi-0\n",
+		"card1/id":          "Device\n",
+		"card1/pcm0p/info":  "name: USB Audio\n",
+		"card1/pcm0c/info":  "card: 1\ndevice: 0\nsubdevice: 0\nstream: CAPTURE\nid: USB Audio\nname: USB Audio\n",
+		"card1/stream0":     "C-Media USB Audio Device\n\nPlayback:\n  Status: Stop\n  Interface 1\n    Altset 1\n    Format: S16_LE\n    Channels: 2\n\nCapture:\n  Status: Stop\n  Interface 2\n    Altset 1\n    Format: S16_LE\n    Channels: 1\n",
+		"card2/id":          "Scarlett4i4USB\n",
+		"card2/pcm0c/info":  "name: USB Audio\n",
+		"card2/stream0":     "Capture:\n  Interface 2\n    Altset 1\n    Channels: 2\n  Interface 2\n    Altset 2\n    Channels: 4\n",
+		"card2/pcm1c/dummy": "",
+	})
+
+	devices, err := procCaptureDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []AudioDevice{
+		{Index: 0, Name: "USB Audio Device: USB Audio (hw:1,0)", MaxInputChannels: 1, ID: "hw:CARD=Device,DEV=0"},
+		{Index: 1, Name: "Scarlett 4i4 USB: USB Audio (hw:2,0)", MaxInputChannels: 4, ID: "hw:CARD=Scarlett4i4USB,DEV=0"},
+		{Index: 2, Name: "Scarlett 4i4 USB: PCM (hw:2,1)", MaxInputChannels: 1, ID: "hw:CARD=Scarlett4i4USB,DEV=1"},
+	}
+	if len(devices) != len(want) {
+		t.Fatalf("found %+v", devices)
+	}
+	for i, d := range devices {
+		w := want[i]
+		if d.Index != w.Index || d.Name != w.Name || d.MaxInputChannels != w.MaxInputChannels || d.ID != w.ID {
+			t.Errorf("device %d = %q, %d channels, id %q; want %q, %d channels, id %q",
+				i, d.Name, d.MaxInputChannels, d.ID, w.Name, w.MaxInputChannels, w.ID)
+		}
+		if d.DefaultSampleRate != 48000 || d.HostAPI != "ALSA" {
+			t.Errorf("device %d at %g Hz on %s", i, d.DefaultSampleRate, d.HostAPI)
+		}
+	}
+}
+
+func TestProcCaptureDevicesWithoutALSA(t *testing.T) {
+	fakeProcASound(t, nil)
+	if _, err := procCaptureDevices(); err == nil {
+		t.Error("listed devices without /proc/asound/cards")
+	}
+}
+
+func TestProcCardLine(t *testing.T) {
+	for _, test := range []struct {
+		line     string
+		card, id string
+		name     string
+		matches  bool
+	}{
+		{" 1 [Device         ]: USB-Audio - USB Audio Device", "1", "Device", "USB Audio Device", true},
+		{"10 [Microphone     ]: USB-Audio - USB PnP Sound Device", "10", "Microphone", "USB PnP Sound Device", true},
+		{" 2 [Scarlett4i4USB ]: USB-Audio - Scarlett 4i4 USB", "2", "Scarlett4i4USB", "Scarlett 4i4 USB", true},
+		{"                      C-Media Electronics Inc. USB Audio Device at usb-3f980000.usb-1.2, full speed", "", "", "", false},
+		{"--- no soundcards ---", "", "", "", false},
+	} {
+		m := procCardLine.FindStringSubmatch(test.line)
+		if (m != nil) != test.matches {
+			t.Errorf("%q matched %v", test.line, m)
+			continue
+		}
+		if m != nil && (m[1] != test.card || m[2] != test.id || m[3] != test.name) {
+			t.Errorf("%q read as card %s id %s name %s", test.line, m[1], m[2], m[3])
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package audio
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Broadcast Wave (EBU Tech 3285) adds a bext chunk to a WAV file, with
+// the originator and the time of day the audio starts; iXML carries the
+// scene, take and track names.
+
+// fileStart returns the wall-clock time of a file's first frame and its
+// offset in frames since the preceding local midnight.
+func fileStart(meta FileMetadata, sampleRate float64, startFrame int64) (time.Time, uint64) {
+	start := meta.StartTime.Add(time.Duration(float64(startFrame) / sampleRate * float64(time.Second)))
+	y, m, d := meta.StartTime.Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, meta.StartTime.Location())
+	return start, uint64(meta.StartTime.Sub(midnight).Seconds()*sampleRate) + uint64(startFrame)
+}
+
+// bextChunk builds the body of a version 1 bext chunk. Text that does
+// not fit a field is cut.
+func bextChunk(meta FileMetadata, channel int16, sampleRate float64, startFrame int64) []byte {
+	start, timeReference := fileStart(meta, sampleRate, startFrame)
+
+	body := make([]byte, 602)
+	copy(body[0:256], meta.annotation())
+	copy(body[256:288], "Pi "+meta.PiID)
+	copy(body[288:320], meta.SessionID)
+	copy(body[320:330], start.Format("2006-01-02"))
+	copy(body[330:338], start.Format("15:04:05"))
+	binary.LittleEndian.PutUint64(body[338:346], timeReference)
+	binary.LittleEndian.PutUint16(body[346:348], 1)
+	// The UMID and the reserved bytes stay zero.
+
+	mode := "multitrack"
+	switch channel {
+	case 1:
+		mode = "mono"
+	case 2:
+		mode = "stereo"
+	}
+	history := fmt.Sprintf("A=PCM,F=%d,W=32,M=%s", int(math.Round(sampleRate)), mode)
+	if meta.Software != "" {
+		history += ",T=" + meta.Software
+	}
+	return append(body, history+"\r\n"...)
+}
+
+type ixmlDocument struct {
+	XMLName xml.Name      `xml:"BWFXML"`
+	Version string        `xml:"IXML_VERSION"`
+	Scene   string        `xml:"SCENE"`
+	Take    int           `xml:"TAKE"`
+	Tape    string        `xml:"TAPE,omitempty"`
+	Note    string        `xml:"NOTE,omitempty"`
+	Speed   ixmlSpeed     `xml:"SPEED"`
+	Tracks  ixmlTrackList `xml:"TRACK_LIST"`
+	// User holds the FileMetadata as JSON.
+	User string `xml:"USER,omitempty"`
+}
+
+type ixmlSpeed struct {
+	FileSampleRate      int    `xml:"FILE_SAMPLE_RATE"`
+	AudioBitDepth       int    `xml:"AUDIO_BIT_DEPTH"`
+	TimestampSampleRate int    `xml:"TIMESTAMP_SAMPLE_RATE"`
+	TimestampHi         uint32 `xml:"TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_HI"`
+	TimestampLo         uint32 `xml:"TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_LO"`
+}
+
+type ixmlTrackList struct {
+	Count  int         `xml:"TRACK_COUNT"`
+	Tracks []ixmlTrack `xml:"TRACK"`
+}
+
+type ixmlTrack struct {
+	ChannelIndex    int    `xml:"CHANNEL_INDEX"`
+	InterleaveIndex int    `xml:"INTERLEAVE_INDEX"`
+	Name            string `xml:"NAME,omitempty"`
+}
+
+// ixmlChunk builds the body of an iXML chunk: the session is the scene,
+// the segment the take and the Pi the tape, and each channel is a track
+// named by its label.
+func ixmlChunk(meta FileMetadata, channel int16, sampleRate float64, startFrame int64) ([]byte, error) {
+	_, timeReference := fileStart(meta, sampleRate, startFrame)
+	user, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := ixmlDocument{
+		Version: "1.61",
+		Scene:   meta.SessionID,
+		Take:    max(meta.Segment, 1),
+		Tape:    meta.PiID,
+		Note:    meta.annotation(),
+		Speed: ixmlSpeed{
+			FileSampleRate:      int(math.Round(sampleRate)),
+			AudioBitDepth:       32,
+			TimestampSampleRate: int(math.Round(sampleRate)),
+			TimestampHi:         uint32(timeReference >> 32),
+			TimestampLo:         uint32(timeReference),
+		},
+		Tracks: ixmlTrackList{Count: int(channel)},
+		User:   string(user),
+	}
+	for c := 1; c <= int(channel); c++ {
+		track := ixmlTrack{ChannelIndex: c, InterleaveIndex: c}
+		if c <= len(meta.ChannelLabels) {
+			track.Name = meta.ChannelLabels[c-1]
+		}
+		doc.Tracks.Tracks = append(doc.Tracks.Tracks, track)
+	}
+
+	body, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// WriteBroadcastWave appends bext and iXML chunks describing meta to a
+// WAV file that has neither, such as the output of a processing step.
+// offset is the time of the file's first frame after meta.StartTime.
+func WriteBroadcastWave(path string, meta FileMetadata, offset time.Duration) error {
+	ar, err := OpenReader(path)
+	if err != nil {
+		return err
+	}
+	channel, sampleRate := ar.Channel, ar.SampleRate
+	ar.Close()
+
+	startFrame := int64(math.Round(offset.Seconds() * sampleRate))
+	ixml, err := ixmlChunk(meta, channel, sampleRate, startFrame)
+	if err != nil {
+		return err
+	}
+	return wavLayout.append(path,
+		wavLayout.chunk("bext", bextChunk(meta, channel, sampleRate, startFrame)),
+		wavLayout.chunk("iXML", ixml),
+	)
+}
+
+// BroadcastExtension is the content of a bext chunk.
+type BroadcastExtension struct {
+	Description         string `json:"description,omitempty"`
+	Originator          string `json:"originator,omitempty"`
+	OriginatorReference string `json:"originator_reference,omitempty"`
+	OriginationDate     string `json:"origination_date,omitempty"`
+	OriginationTime     string `json:"origination_time,omitempty"`
+	// TimeReference is the position of the first frame in frames since
+	// midnight.
+	TimeReference uint64 `json:"time_reference"`
+	Version       uint16 `json:"version"`
+	CodingHistory string `json:"coding_history,omitempty"`
+}
+
+func parseBextChunk(body []byte) (*BroadcastExtension, error) {
+	if len(body) < 602 {
+		return nil, fmt.Errorf("short bext chunk")
+	}
+	text := func(b []byte) string {
+		return strings.TrimRight(string(b), "\x00")
+	}
+	return &BroadcastExtension{
+		Description:         text(body[0:256]),
+		Originator:          text(body[256:288]),
+		OriginatorReference: text(body[288:320]),
+		OriginationDate:     text(body[320:330]),
+		OriginationTime:     text(body[330:338]),
+		TimeReference:       binary.LittleEndian.Uint64(body[338:346]),
+		Version:             binary.LittleEndian.Uint16(body[346:348]),
+		CodingHistory:       strings.TrimRight(text(body[602:]), "\r\n"),
+	}, nil
+}
@@ -0,0 +1,90 @@
+package audio
+
+import (
+	"fmt"
+	"sync"
+)
+
+// CaptureBackend enumerates input devices and opens capture streams on
+// them. Device indexes are only meaningful within the backend that
+// returned them.
+type CaptureBackend interface {
+	Name() string
+	// Devices lists the input devices sessions may record from.
+	Devices() ([]AudioDevice, error)
+	// Device returns the device with the given index, or the default
+	// input device when index is negative.
+	Device(index int) (*AudioDevice, error)
+	Open(params CaptureParams) (CaptureStream, error)
+}
+
+// CaptureParams describes the stream a recorder wants to open.
+type CaptureParams struct {
+	DeviceIndex     int
+	Channels        int
+	SampleRate      float64
+	FramesPerBuffer int
+}
+
+// CaptureStream delivers interleaved 32-bit frames from a device.
+type CaptureStream interface {
+	Start() error
+	// Read blocks until buf, FramesPerBuffer frames of Channels samples,
+	// has been filled. ErrOverflow means buf was filled but input was
+	// lost before it.
+	Read(buf []int32) error
+	Stop() error
+	Close() error
+}
+
+var captureBackend CaptureBackend = &portAudioBackend{}
+var captureBackendMutex sync.RWMutex
+
+// BackendOptions holds the backend specific settings.
+type BackendOptions struct {
+	// FakeSources lists the devices of the fake backend, see ParseFakeSources.
+	FakeSources string
+	// ALSAPeriodFrames and ALSAPeriods request the period size and count
+	// of the ALSA ring buffer.
+	ALSAPeriodFrames int
+	ALSAPeriods      int
+}
+
+// NewCaptureBackend creates a capture backend by name.
+func NewCaptureBackend(name string, opts BackendOptions) (CaptureBackend, error) {
+	switch name {
+	case "", "portaudio":
+		return &portAudioBackend{}, nil
+
+	case "pulse", "pipewire":
+		return newPulseBackend()
+
+	case "alsa":
+		return newALSABackend(opts.ALSAPeriodFrames, opts.ALSAPeriods)
+
+	case "fake":
+		sources, err := ParseFakeSources(opts.FakeSources)
+		if err != nil {
+			return nil, err
+		}
+		return NewFakeBackend(sources...), nil
+
+	default:
+		return nil, fmt.Errorf("unknown capture backend %q", name)
+	}
+}
+
+// SetCaptureBackend selects the backend used for device lookups and by
+// recorders created afterwards.
+func SetCaptureBackend(backend CaptureBackend) {
+	captureBackendMutex.Lock()
+	defer captureBackendMutex.Unlock()
+	captureBackend = backend
+}
+
+// GetCaptureBackend returns the backend currently in use.
+func GetCaptureBackend() CaptureBackend {
+	captureBackendMutex.RLock()
+	defer captureBackendMutex.RUnlock()
+	return captureBackend
+}
@@ -0,0 +1,432 @@
+//go:build linux
+
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"runtime"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// The ALSA backend drives the kernel PCM interface (/dev/snd/pcmC*D*c)
+// directly, without alsa-lib or PortAudio. Only hw devices are exposed,
+// matching what isHardwareDevice lets through for PortAudio.
+
+// Kernel PCM ABI, from include/uapi/sound/asound.h.
+const (
+	sndrvPCMAccessRWInterleaved = 3
+	sndrvPCMSubformatStd        = 0
+
+	sndrvPCMFormatS16LE  = 2
+	sndrvPCMFormatS24LE  = 6
+	sndrvPCMFormatS32LE  = 10
+	sndrvPCMFormatS243LE = 32
+
+	sndrvPCMHwParamAccess    = 0
+	sndrvPCMHwParamFormat    = 1
+	sndrvPCMHwParamSubformat = 2
+	sndrvPCMHwParamChannels  = 10
+	sndrvPCMHwParamRate      = 11
+	sndrvPCMHwParamPeriod    = 13
+	sndrvPCMHwParamPeriods   = 15
+	sndrvPCMHwParamBuffer    = 17
+	sndrvPCMHwParamFirstIntv = 8
+
+	sndIntervalInteger = 1 << 2
+)
+
+type sndMask struct {
+	Bits [8]uint32
+}
+
+type sndInterval struct {
+	Min, Max uint32
+	Flags    uint32
+}
+
+type sndPCMHwParams struct {
+	Flags     uint32
+	Masks     [3]sndMask
+	Mres      [5]sndMask
+	Intervals [12]sndInterval
+	Ires      [9]sndInterval
+	Rmask     uint32
+	Cmask     uint32
+	Info      uint32
+	Msbits    uint32
+	RateNum   uint32
+	RateDen   uint32
+	FifoSize  uint
+	Reserved  [64]byte
+}
+
+type sndXferi struct {
+	Result int
+	Buf    uintptr
+	Frames uint
+}
+
+func alsaIoc(dir, nr, size uintptr) uintptr {
+	return dir<<30 | size<<16 | 'A'<<8 | nr
+}
+
+var (
+	sndrvPCMIoctlHwRefine   = alsaIoc(3, 0x10, unsafe.Sizeof(sndPCMHwParams{}))
+	sndrvPCMIoctlHwParams   = alsaIoc(3, 0x11, unsafe.Sizeof(sndPCMHwParams{}))
+	sndrvPCMIoctlHwFree     = alsaIoc(0, 0x12, 0)
+	sndrvPCMIoctlPrepare    = alsaIoc(0, 0x40, 0)
+	sndrvPCMIoctlDrop       = alsaIoc(0, 0x43, 0)
+	sndrvPCMIoctlResume     = alsaIoc(0, 0x47, 0)
+	sndrvPCMIoctlReadiFrame = alsaIoc(2, 0x51, unsafe.Sizeof(sndXferi{}))
+)
+
+// alsaFormats lists the sample formats we accept, best first, with the
+// number of bytes each sample takes in the buffer.
+var alsaFormats = []struct {
+	format int
+	bytes  int
+}{
+	{sndrvPCMFormatS32LE, 4},
+	{sndrvPCMFormatS24LE, 4},
+	{sndrvPCMFormatS243LE, 3},
+	{sndrvPCMFormatS16LE, 2},
+}
+
+func alsaIoctl(fd int, req uintptr, arg unsafe.Pointer) error {
+	for {
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req, uintptr(arg))
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return errno
+		}
+		return nil
+	}
+}
+
+func newHwParams() *sndPCMHwParams {
+	p := &sndPCMHwParams{Rmask: ^uint32(0), Info: ^uint32(0)}
+	for i := range p.Masks {
+		for j := range p.Masks[i].Bits {
+			p.Masks[i].Bits[j] = ^uint32(0)
+		}
+	}
+	for i := range p.Intervals {
+		p.Intervals[i] = sndInterval{Min: 0, Max: ^uint32(0)}
+	}
+	return p
+}
+
+func (p *sndPCMHwParams) setMask(param, value int) {
+	p.Masks[param] = sndMask{}
+	p.Masks[param].Bits[value/32] = 1 << (value % 32)
+}
+
+func (p *sndPCMHwParams) interval(param int) *sndInterval {
+	return &p.Intervals[param-sndrvPCMHwParamFirstIntv]
+}
+
+func (p *sndPCMHwParams) setInterval(param int, value uint32) {
+	*p.interval(param) = sndInterval{Min: value, Max: value, Flags: sndIntervalInteger}
+}
+
+// ALSABackend captures from ALSA hw PCM devices. Device indexes are the
+// position in the card/device ordered list of capture PCMs.
+type ALSABackend struct {
+	// PeriodFrames and Periods size the hardware ring buffer. They are
+	// a request; the driver may round them.
+	PeriodFrames int
+	Periods      int
+
+	mu   sync.Mutex
+	caps map[string]alsaCaps
+}
+
+func newALSABackend(periodFrames, periods int) (CaptureBackend, error) {
+	return &ALSABackend{
+		PeriodFrames: periodFrames,
+		Periods:      periods,
+		caps:         make(map[string]alsaCaps),
+	}, nil
+}
+
+func (b *ALSABackend) Name() string { return "alsa" }
+
+func (b *ALSABackend) Devices() ([]AudioDevice, error) {
+	pcms, err := listALSACapturePCMs()
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]AudioDevice, 0, len(pcms))
+	for i, pcm := range pcms {
+		devices = append(devices, b.device(i, pcm))
+	}
+	return devices, nil
+}
+
+func (b *ALSABackend) Device(index int) (*AudioDevice, error) {
+	pcms, err := listALSACapturePCMs()
+	if err != nil {
+		return nil, err
+	}
+	if len(pcms) == 0 {
+		return nil, fmt.Errorf("no ALSA capture devices found")
+	}
+	if index < 0 {
+		// ALSA has no default hw device; use the first one like "hw:0".
+		index = 0
+	}
+	if index >= len(pcms) {
+		return nil, fmt.Errorf("device index %d out of range", index)
+	}
+
+	d := b.device(index, pcms[index])
+	return &d, nil
+}
+
+func (b *ALSABackend) device(index int, pcm alsaPCM) AudioDevice {
+	caps := b.capabilities(pcm)
+	return AudioDevice{
+		Index:             index,
+		Name:              fmt.Sprintf("%s: %s (hw:%d,%d)", pcm.cardName, pcm.pcmName, pcm.card, pcm.device),
+		MaxInputChannels:  caps.maxChannels,
+		DefaultSampleRate: caps.rate,
+		HostAPI:           "ALSA",
+		ID:                stableDeviceID(pcm.card, pcm.device),
+	}
+}
+
+// capabilities asks the driver for the channel and rate range. A device
+// that is busy recording cannot be queried, so the last answer is kept
+// and /proc is used before the device was ever seen idle.
+func (b *ALSABackend) capabilities(pcm alsaPCM) alsaCaps {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := pcm.stableName()
+	if caps, err := queryALSACaps(pcm); err == nil {
+		b.caps[key] = caps
+		return caps
+	}
+	if caps, ok := b.caps[key]; ok {
+		return caps
+	}
+	return procALSACaps(pcm)
+}
+
+func queryALSACaps(pcm alsaPCM) (alsaCaps, error) {
+	fd, err := syscall.Open(pcm.path(), syscall.O_RDWR|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return alsaCaps{}, err
+	}
+	defer syscall.Close(fd)
+
+	params := newHwParams()
+	if err := alsaIoctl(fd, sndrvPCMIoctlHwRefine, unsafe.Pointer(params)); err != nil {
+		return alsaCaps{}, err
+	}
+
+	rates := params.interval(sndrvPCMHwParamRate)
+	rate := float64(48000)
+	if rate < float64(rates.Min) || rate > float64(rates.Max) {
+		rate = float64(rates.Min)
+	}
+	return alsaCaps{
+		maxChannels: int(params.interval(sndrvPCMHwParamChannels).Max),
+		rate:        rate,
+	}, nil
+}
+
+func (b *ALSABackend) Open(params CaptureParams) (CaptureStream, error) {
+	pcms, err := listALSACapturePCMs()
+	if err != nil {
+		return nil, err
+	}
+	index := params.DeviceIndex
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(pcms) {
+		return nil, fmt.Errorf("device index %d out of range", params.DeviceIndex)
+	}
+	pcm := pcms[index]
+
+	// Open without blocking so a busy device fails instead of waiting,
+	// then switch to blocking reads.
+	fd, err := syscall.Open(pcm.path(), syscall.O_RDWR|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", pcm.stableName(), err)
+	}
+	if err := syscall.SetNonblock(fd, false); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	stream := &alsaStream{fd: fd, pcm: pcm, channels: params.Channels}
+	if err := stream.configure(params, b.PeriodFrames, b.Periods); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("configure %s: %w", pcm.stableName(), err)
+	}
+
+	log.Printf("Using ALSA device %s (hw:%d,%d): %d bit, period %d frames, buffer %d frames",
+		pcm.stableName(), pcm.card, pcm.device, stream.sampleBytes*8, stream.periodFrames, stream.bufferFrames)
+	return stream, nil
+}
+
+// alsaStream is a blocking interleaved capture stream on one hw PCM.
+type alsaStream struct {
+	fd           int
+	pcm          alsaPCM
+	channels     int
+	format       int
+	sampleBytes  int
+	periodFrames int
+	bufferFrames int
+	raw          []byte
+	xruns        int
+}
+
+// configure picks the best supported sample format and sets rate,
+// channels and period/buffer sizes. When the driver cannot honour the
+// requested period layout, it falls back to the driver's own choice.
+func (s *alsaStream) configure(params CaptureParams, periodFrames, periods int) error {
+	var lastErr error
+	for _, f := range alsaFormats {
+		for _, sized := range []bool{true, false} {
+			hw := newHwParams()
+			hw.setMask(sndrvPCMHwParamAccess, sndrvPCMAccessRWInterleaved)
+			hw.setMask(sndrvPCMHwParamFormat, f.format)
+			hw.setMask(sndrvPCMHwParamSubformat, sndrvPCMSubformatStd)
+			hw.setInterval(sndrvPCMHwParamChannels, uint32(params.Channels))
+			hw.setInterval(sndrvPCMHwParamRate, uint32(params.SampleRate))
+			if sized && periodFrames > 0 && periods > 0 {
+				hw.setInterval(sndrvPCMHwParamPeriod, uint32(periodFrames))
+				hw.setInterval(sndrvPCMHwParamPeriods, uint32(periods))
+			}
+
+			if err := alsaIoctl(s.fd, sndrvPCMIoctlHwRefine, unsafe.Pointer(hw)); err != nil {
+				lastErr = err
+				continue
+			}
+			if err := alsaIoctl(s.fd, sndrvPCMIoctlHwParams, unsafe.Pointer(hw)); err != nil {
+				lastErr = err
+				continue
+			}
+
+			s.format = f.format
+			s.sampleBytes = f.bytes
+			s.periodFrames = int(hw.interval(sndrvPCMHwParamPeriod).Min)
+			s.bufferFrames = int(hw.interval(sndrvPCMHwParamBuffer).Min)
+			return alsaIoctl(s.fd, sndrvPCMIoctlPrepare, nil)
+		}
+	}
+	if lastErr == syscall.EINVAL {
+		return fmt.Errorf("%d channels at %g Hz not supported", params.Channels, params.SampleRate)
+	}
+	return lastErr
+}
+
+// Start is a no-op: with the default start threshold the first read
+// starts the stream.
+func (s *alsaStream) Start() error { return nil }
+
+// Read fills buf with frames, recovering from overruns and suspends by
+// re-preparing the device. Frames lost in an overrun are not replaced;
+// ErrOverflow tells the caller they are missing.
+func (s *alsaStream) Read(buf []int32) error {
+	overrun := false
+	frames := len(buf) / s.channels
+	need := frames * s.channels * s.sampleBytes
+	if cap(s.raw) < need {
+		s.raw = make([]byte, need)
+	}
+	raw := s.raw[:need]
+
+	for done := 0; done < frames; {
+		offset := done * s.channels * s.sampleBytes
+		xfer := sndXferi{
+			Buf:    uintptr(unsafe.Pointer(&raw[offset])),
+			Frames: uint(frames - done),
+		}
+		err := alsaIoctl(s.fd, sndrvPCMIoctlReadiFrame, unsafe.Pointer(&xfer))
+		runtime.KeepAlive(raw)
+
+		switch {
+		case err == nil:
+			done += xfer.Result
+		case errors.Is(err, syscall.EPIPE):
+			s.xruns++
+			overrun = true
+			log.Printf("ALSA overrun on %s (%d so far), recovering", s.pcm.stableName(), s.xruns)
+			if err := alsaIoctl(s.fd, sndrvPCMIoctlPrepare, nil); err != nil {
+				return fmt.Errorf("recover from overrun: %w", err)
+			}
+		case errors.Is(err, syscall.ESTRPIPE):
+			if err := s.resume(); err != nil {
+				return err
+			}
+		case errors.Is(err, syscall.EAGAIN):
+			continue
+		default:
+			return fmt.Errorf("read %s: %w", s.pcm.stableName(), err)
+		}
+	}
+
+	s.decode(buf, raw)
+	if overrun {
+		return ErrOverflow
+	}
+	return nil
+}
+
+func (s *alsaStream) resume() error {
+	for {
+		err := alsaIoctl(s.fd, sndrvPCMIoctlResume, nil)
+		if err == nil {
+			return nil
+		}
+		if errors.Is(err, syscall.EAGAIN) {
+			continue
+		}
+		// The driver cannot resume, start over from a prepared state.
+		return alsaIoctl(s.fd, sndrvPCMIoctlPrepare, nil)
+	}
+}
+
+// decode converts little-endian device samples to full-range int32.
+func (s *alsaStream) decode(buf []int32, raw []byte) {
+	for i := range buf {
+		b := raw[i*s.sampleBytes:]
+		switch s.format {
+		case sndrvPCMFormatS32LE:
+			buf[i] = int32(binary.LittleEndian.Uint32(b))
+		case sndrvPCMFormatS24LE:
+			buf[i] = int32(binary.LittleEndian.Uint32(b) << 8)
+		case sndrvPCMFormatS243LE:
+			buf[i] = int32(uint32(b[0])<<8 | uint32(b[1])<<16 | uint32(b[2])<<24)
+		case sndrvPCMFormatS16LE:
+			buf[i] = int32(binary.LittleEndian.Uint16(b)) << 16
+		}
+	}
+}
+
+func (s *alsaStream) Stop() error {
+	return alsaIoctl(s.fd, sndrvPCMIoctlDrop, nil)
+}
+
+func (s *alsaStream) Close() error {
+	alsaIoctl(s.fd, sndrvPCMIoctlHwFree, nil)
+	return syscall.Close(s.fd)
+}
+
+// hotplugDevices avoids opening every device on each poll.
+func (b *ALSABackend) hotplugDevices() ([]AudioDevice, error) {
+	return procCaptureDevices()
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package audio
+
+import "fmt"
+
+func newALSABackend(periodFrames, periods int) (CaptureBackend, error) {
+	return nil, fmt.Errorf("the alsa capture backend is only available on Linux")
+}
@@ -0,0 +1,279 @@
+package audio
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	fakeDefaultChannels   = 8
+	fakeDefaultSampleRate = 48000
+	fakeDefaultLevelDBFS  = -20
+)
+
+// FakeSource describes one device of the fake backend.
+type FakeSource struct {
+	// Signal is "sine", "noise", "silence" or "file".
+	Signal string
+	// Frequency of the sine on channel 1; channel n carries n times it,
+	// so channel selection and splitting can be told apart in the output.
+	Frequency float64
+	LevelDBFS float64
+	// Path of the AIFF or WAV file replayed, in a loop, by a "file" source.
+	Path string
+}
+
+// ParseFakeSources reads a list of fake devices such as
+// "sine:440;noise:-30;silence;file:/tmp/consult.aiff". The argument is the
+// frequency for a sine, the level in dBFS for noise and the path for a file.
+func ParseFakeSources(spec string) ([]FakeSource, error) {
+	var sources []FakeSource
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		kind, arg, _ := strings.Cut(entry, ":")
+		source := FakeSource{Signal: kind, Frequency: 440, LevelDBFS: fakeDefaultLevelDBFS}
+		switch kind {
+		case "sine", "noise":
+			if arg == "" {
+				break
+			}
+			v, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return nil, fmt.Errorf("fake source %q: %w", entry, err)
+			}
+			if kind == "sine" {
+				source.Frequency = v
+			} else {
+				source.LevelDBFS = v
+			}
+		case "silence":
+		case "file":
+			if arg == "" {
+				return nil, fmt.Errorf("fake source %q: missing file path", entry)
+			}
+			source.Path = arg
+		default:
+			return nil, fmt.Errorf("fake source %q: unknown signal %q", entry, kind)
+		}
+		sources = append(sources, source)
+	}
+
+	if len(sources) == 0 {
+		sources = append(sources, FakeSource{Signal: "sine", Frequency: 440, LevelDBFS: fakeDefaultLevelDBFS})
+	}
+	return sources, nil
+}
+
+// FakeBackend is a capture backend without hardware. Every source is a
+// device whose index is its position in the list. Output is deterministic:
+// the same source always produces the same samples.
+type FakeBackend struct {
+	sources []FakeSource
+	// Realtime paces reads to the sample rate like a sound card does.
+	// Without it streams deliver frames as fast as they are read.
+	Realtime bool
+}
+
+func NewFakeBackend(sources ...FakeSource) *FakeBackend {
+	return &FakeBackend{sources: sources, Realtime: true}
+}
+
+func (b *FakeBackend) Name() string { return "fake" }
+
+func (b *FakeBackend) Devices() ([]AudioDevice, error) {
+	devices := make([]AudioDevice, 0, len(b.sources))
+	for i := range b.sources {
+		devices = append(devices, b.device(i))
+	}
+	return devices, nil
+}
+
+func (b *FakeBackend) Device(index int) (*AudioDevice, error) {
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(b.sources) {
+		return nil, fmt.Errorf("device index %d out of range", index)
+	}
+	d := b.device(index)
+	return &d, nil
+}
+
+func (b *FakeBackend) device(index int) AudioDevice {
+	source := b.sources[index]
+	name := fmt.Sprintf("Fake %s", source.Signal)
+	switch source.Signal {
+	case "sine":
+		name = fmt.Sprintf("Fake sine %g Hz", source.Frequency)
+	case "file":
+		name = fmt.Sprintf("Fake file %s", source.Path)
+	}
+
+	return AudioDevice{
+		Index:             index,
+		Name:              fmt.Sprintf("%s (fake:%d)", name, index),
+		MaxInputChannels:  fakeDefaultChannels,
+		DefaultSampleRate: fakeDefaultSampleRate,
+		HostAPI:           "Fake",
+	}
+}
+
+func (b *FakeBackend) Open(params CaptureParams) (CaptureStream, error) {
+	device, err := b.Device(params.DeviceIndex)
+	if err != nil {
+		return nil, err
+	}
+	if params.Channels < 1 || params.Channels > device.MaxInputChannels {
+		return nil, fmt.Errorf("device %d supports 1-%d channels, %d requested", device.Index, device.MaxInputChannels, params.Channels)
+	}
+
+	stream := &fakeStream{
+		source:   b.sources[device.Index],
+		params:   params,
+		realtime: b.Realtime,
+		level:    math.Pow(10, b.sources[device.Index].LevelDBFS/20),
+		rng:      rand.New(rand.NewSource(int64(device.Index) + 1)),
+	}
+	if stream.source.Signal == "file" {
+		if err := stream.rewind(); err != nil {
+			return nil, err
+		}
+	}
+	return stream, nil
+}
+
+// fakeStream generates the frames of a FakeSource.
+type fakeStream struct {
+	source   FakeSource
+	params   CaptureParams
+	realtime bool
+	level    float64
+	rng      *rand.Rand
+	file     *Reader
+	fileBuf  []int32
+	started  time.Time
+	frame    int64
+	running  bool
+}
+
+func (s *fakeStream) Start() error {
+	s.started = time.Now()
+	s.frame = 0
+	s.running = true
+	return nil
+}
+
+func (s *fakeStream) Read(buf []int32) error {
+	if !s.running {
+		return fmt.Errorf("fake stream is not running")
+	}
+
+	channels := s.params.Channels
+	frames := len(buf) / channels
+	if err := s.generate(buf, frames); err != nil {
+		return err
+	}
+	s.frame += int64(frames)
+
+	if s.realtime {
+		due := s.started.Add(time.Duration(float64(s.frame) / s.params.SampleRate * float64(time.Second)))
+		if wait := time.Until(due); wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+	return nil
+}
+
+func (s *fakeStream) generate(buf []int32, frames int) error {
+	channels := s.params.Channels
+	switch s.source.Signal {
+	case "sine":
+		for f := 0; f < frames; f++ {
+			t := float64(s.frame+int64(f)) / s.params.SampleRate
+			for c := 0; c < channels; c++ {
+				buf[f*channels+c] = floatToInt32(s.level * math.Sin(2*math.Pi*s.source.Frequency*float64(c+1)*t))
+			}
+		}
+
+	case "noise":
+		for i := range buf[:frames*channels] {
+			buf[i] = floatToInt32(s.level * (2*s.rng.Float64() - 1))
+		}
+
+	case "file":
+		return s.readFile(buf, frames)
+
+	default:
+		clear(buf[:frames*channels])
+	}
+	return nil
+}
+
+// readFile replays the source file from the start whenever it runs out.
+// File channels are repeated when the stream has more channels.
+func (s *fakeStream) readFile(buf []int32, frames int) error {
+	channels := s.params.Channels
+	fileChannels := int(s.file.Channel)
+	for done := 0; done < frames; {
+		want := min(frames-done, readChunkFrames)
+		if cap(s.fileBuf) < want*fileChannels {
+			s.fileBuf = make([]int32, want*fileChannels)
+		}
+		n, err := s.file.ReadFrames(s.fileBuf[:want*fileChannels])
+		if err == io.EOF || (err == nil && n == 0) {
+			if err := s.rewind(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		for f := 0; f < n; f++ {
+			for c := 0; c < channels; c++ {
+				buf[(done+f)*channels+c] = s.fileBuf[f*fileChannels+c%fileChannels]
+			}
+		}
+		done += n
+	}
+	return nil
+}
+
+func (s *fakeStream) rewind() error {
+	if s.file != nil {
+		s.file.Close()
+	}
+	file, err := OpenReader(s.source.Path)
+	if err != nil {
+		return err
+	}
+	if file.NumFrames == 0 {
+		file.Close()
+		return fmt.Errorf("%s has no audio to replay", s.source.Path)
+	}
+	s.file = file
+	return nil
+}
+
+func (s *fakeStream) Stop() error {
+	s.running = false
+	return nil
+}
+
+func (s *fakeStream) Close() error {
+	s.running = false
+	if s.file != nil {
+		return s.file.Close()
+	}
+	return nil
+}
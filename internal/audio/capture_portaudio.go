@@ -0,0 +1,232 @@
+package audio
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+var portaudioInitialized bool
+var portaudioMutex sync.Mutex
+
+func InitPortAudio() error {
+	portaudioMutex.Lock()
+	defer portaudioMutex.Unlock()
+
+	if !portaudioInitialized {
+		if err := portaudio.Initialize(); err != nil {
+			return err
+		}
+		portaudioInitialized = true
+		log.Println("? PortAudio initialized globally")
+	}
+	return nil
+}
+
+// portAudioBackend captures through PortAudio. Device indexes are
+// PortAudio's global device indexes.
+type portAudioBackend struct{}
+
+func (b *portAudioBackend) Name() string { return "portaudio" }
+
+func (b *portAudioBackend) Devices() ([]AudioDevice, error) {
+	if err := portaudio.Initialize(); err != nil {
+		return nil, fmt.Errorf("failed to initialize PortAudio: %w", err)
+	}
+	defer portaudio.Terminate()
+
+	devices, err := portaudio.Devices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get devices: %w", err)
+	}
+
+	var audioDevices []AudioDevice
+	for i, device := range devices {
+		if device.MaxInputChannels > 0 && isHardwareDevice(device.Name) {
+			audioDevices = append(audioDevices, newPortAudioDevice(i, device))
+		}
+	}
+	return audioDevices, nil
+}
+
+func (b *portAudioBackend) Device(index int) (*AudioDevice, error) {
+	if err := portaudio.Initialize(); err != nil {
+		return nil, fmt.Errorf("failed to initialize PortAudio: %w", err)
+	}
+	defer portaudio.Terminate()
+
+	devices, err := portaudio.Devices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get devices: %w", err)
+	}
+
+	if index < 0 {
+		defaultDevice, err := portaudio.DefaultInputDevice()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get default input device: %w", err)
+		}
+
+		// Find the index of the default device
+		for i, device := range devices {
+			if device == defaultDevice {
+				d := newPortAudioDevice(i, device)
+				return &d, nil
+			}
+		}
+		return nil, fmt.Errorf("default device not found in device list")
+	}
+
+	if index >= len(devices) {
+		return nil, fmt.Errorf("device index %d out of range", index)
+	}
+
+	device := devices[index]
+	if device.MaxInputChannels == 0 {
+		return nil, fmt.Errorf("device %d has no input channels", index)
+	}
+
+	d := newPortAudioDevice(index, device)
+	return &d, nil
+}
+
+func newPortAudioDevice(index int, device *portaudio.DeviceInfo) AudioDevice {
+	hostAPIName := "Unknown"
+	if device.HostApi != nil {
+		hostAPIName = device.HostApi.Name
+	}
+
+	d := AudioDevice{
+		Index:             index,
+		Name:              device.Name,
+		MaxInputChannels:  device.MaxInputChannels,
+		DefaultSampleRate: device.DefaultSampleRate,
+		HostAPI:           hostAPIName,
+	}
+	if card, dev, ok := cardFromDeviceName(device.Name); ok {
+		d.ID = stableDeviceID(card, dev)
+	}
+	return d
+}
+
+func isHardwareDevice(name string) bool {
+	n := strings.ToLower(name)
+	if strings.Contains(n, "hw:") {
+		return true
+	}
+
+	virtual := []string{"default", "sysdefault", "spdif"}
+	for _, v := range virtual {
+		if n == v || strings.Contains(n, v) {
+			return false
+		}
+	}
+
+	return false
+}
+
+// Open initializes PortAudio for the lifetime of the stream; Close
+// terminates it again so the library's reference count stays balanced.
+func (b *portAudioBackend) Open(params CaptureParams) (CaptureStream, error) {
+	if err := portaudio.Initialize(); err != nil {
+		return nil, err
+	}
+
+	stream, err := b.open(params)
+	if err != nil {
+		portaudio.Terminate()
+		return nil, err
+	}
+	return stream, nil
+}
+
+func (b *portAudioBackend) open(params CaptureParams) (*portAudioStream, error) {
+	var inputDevice *portaudio.DeviceInfo
+	var err error
+
+	// Select input device based on DeviceIndex
+	if params.DeviceIndex >= 0 {
+		devices, err := portaudio.Devices()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get devices: %w", err)
+		}
+
+		if params.DeviceIndex >= len(devices) {
+			return nil, fmt.Errorf("device index %d out of range (max %d)", params.DeviceIndex, len(devices)-1)
+		}
+
+		inputDevice = devices[params.DeviceIndex]
+		log.Printf("Using input device [%d]: %s", params.DeviceIndex, inputDevice.Name)
+
+		// If DeviceIndex is not set, use default input device
+	} else {
+		inputDevice, err = portaudio.DefaultInputDevice()
+		if err != nil {
+			return nil, fmt.Errorf("no input device found: %w", err)
+		}
+		log.Println("Using default input device:", inputDevice.Name)
+	}
+
+	// Open stream with specific device
+	in := make([]int32, params.FramesPerBuffer*params.Channels)
+	streamParams := portaudio.StreamParameters{
+		Input: portaudio.StreamDeviceParameters{
+			Device:   inputDevice,
+			Channels: params.Channels,
+			Latency:  inputDevice.DefaultLowInputLatency,
+		},
+		SampleRate:      params.SampleRate,
+		FramesPerBuffer: params.FramesPerBuffer,
+	}
+
+	stream, err := portaudio.OpenStream(streamParams, in)
+	if err != nil {
+		return nil, err
+	}
+	return &portAudioStream{stream: stream, in: in}, nil
+}
+
+// portAudioStream is a blocking PortAudio input stream. PortAudio reads
+// into the buffer bound at open time, which Read copies out.
+type portAudioStream struct {
+	stream *portaudio.Stream
+	in     []int32
+}
+
+func (s *portAudioStream) Start() error { return s.stream.Start() }
+
+func (s *portAudioStream) Read(buf []int32) error {
+	err := s.stream.Read()
+	if err != nil && err != portaudio.InputOverflowed {
+		return err
+	}
+	copy(buf, s.in)
+	if err != nil {
+		return ErrOverflow
+	}
+	return nil
+}
+
+func (s *portAudioStream) Stop() error { return s.stream.Stop() }
+
+func (s *portAudioStream) Close() error {
+	err := s.stream.Close()
+	portaudio.Terminate()
+	return err
+}
+
+// hotplugDevices reads the ALSA device list from /proc, since PortAudio's
+// own list is frozen while it is initialized. The PortAudio index of a
+// new device is only known after a fresh Devices call, so it is -1.
+func (b *portAudioBackend) hotplugDevices() ([]AudioDevice, error) {
+	devices, err := procCaptureDevices()
+	if err != nil {
+		return nil, err
+	}
+	for i := range devices {
+		devices[i].Index = -1
+	}
+	return devices, nil
+}
@@ -0,0 +1,257 @@
+package audio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PulseBackend records from PulseAudio sources, or PipeWire ones through
+// pipewire-pulse, by running the pactl and parec clients. Going through
+// the sound server keeps working when it holds the ALSA hw devices.
+// Device indexes are positions in the source list; the source name is
+// the stable ID. The server is chosen the usual way, so PULSE_SERVER
+// applies.
+type PulseBackend struct{}
+
+// pulseSource is one entry of "pactl list sources".
+type pulseSource struct {
+	name        string
+	description string
+	channels    int
+	rate        float64
+	monitor     bool
+}
+
+func newPulseBackend() (CaptureBackend, error) {
+	if _, err := exec.LookPath("pactl"); err != nil {
+		return nil, fmt.Errorf("pulse capture backend needs pactl: %w", err)
+	}
+	if _, err := exec.LookPath("parec"); err != nil {
+		return nil, fmt.Errorf("pulse capture backend needs parec: %w", err)
+	}
+	return &PulseBackend{}, nil
+}
+
+func (b *PulseBackend) Name() string { return "pulse" }
+
+func (b *PulseBackend) Devices() ([]AudioDevice, error) {
+	sources, err := b.sources()
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]AudioDevice, 0, len(sources))
+	for i, source := range sources {
+		devices = append(devices, newPulseDevice(i, source))
+	}
+	return devices, nil
+}
+
+func (b *PulseBackend) Device(index int) (*AudioDevice, error) {
+	sources, err := b.sources()
+	if err != nil {
+		return nil, err
+	}
+
+	if index < 0 {
+		name, err := b.defaultSource()
+		if err != nil {
+			return nil, err
+		}
+		for i, source := range sources {
+			if source.name == name {
+				d := newPulseDevice(i, source)
+				return &d, nil
+			}
+		}
+		return nil, fmt.Errorf("default source %q not found in source list", name)
+	}
+
+	if index >= len(sources) {
+		return nil, fmt.Errorf("device index %d out of range", index)
+	}
+	d := newPulseDevice(index, sources[index])
+	return &d, nil
+}
+
+func newPulseDevice(index int, source pulseSource) AudioDevice {
+	return AudioDevice{
+		Index:             index,
+		Name:              source.description,
+		MaxInputChannels:  source.channels,
+		DefaultSampleRate: source.rate,
+		HostAPI:           "PulseAudio",
+		ID:                source.name,
+	}
+}
+
+func (b *PulseBackend) command(name string, args ...string) *exec.Cmd {
+	cmd := exec.Command(name, args...)
+	// pactl output is parsed, so keep it untranslated.
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	return cmd
+}
+
+// sources lists the capture sources, leaving out the monitors of
+// output sinks.
+func (b *PulseBackend) sources() ([]pulseSource, error) {
+	out, err := b.command("pactl", "list", "sources").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sources: %w", err)
+	}
+
+	var sources []pulseSource
+	for _, source := range parsePulseSources(out) {
+		if !source.monitor && source.channels > 0 {
+			sources = append(sources, source)
+		}
+	}
+	return sources, nil
+}
+
+func (b *PulseBackend) defaultSource() (string, error) {
+	out, err := b.command("pactl", "get-default-source").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get default source: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func parsePulseSources(out []byte) []pulseSource {
+	var sources []pulseSource
+	var current *pulseSource
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "Source #") {
+			sources = append(sources, pulseSource{})
+			current = &sources[len(sources)-1]
+			continue
+		}
+		if current == nil {
+			continue
+		}
+
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ": ")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Name":
+			current.name = value
+		case "Description":
+			current.description = value
+		case "Sample Specification":
+			// e.g. "s16le 2ch 48000Hz"
+			for _, field := range strings.Fields(value) {
+				if n, ok := strings.CutSuffix(field, "ch"); ok {
+					current.channels, _ = strconv.Atoi(n)
+				}
+				if n, ok := strings.CutSuffix(field, "Hz"); ok {
+					current.rate, _ = strconv.ParseFloat(n, 64)
+				}
+			}
+		case "Monitor of Sink":
+			current.monitor = value != "n/a"
+		}
+	}
+
+	for i := range sources {
+		if sources[i].description == "" {
+			sources[i].description = sources[i].name
+		}
+	}
+	return sources
+}
+
+// Open resolves the source now so a stream keeps recording the same
+// source even if the list changes before Start.
+func (b *PulseBackend) Open(params CaptureParams) (CaptureStream, error) {
+	device, err := b.Device(params.DeviceIndex)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Using PulseAudio source [%d]: %s (%s)", device.Index, device.Name, device.ID)
+
+	cmd := b.command("parec",
+		"--device="+device.ID,
+		"--raw",
+		"--format=s32le",
+		"--rate="+strconv.Itoa(int(params.SampleRate)),
+		"--channels="+strconv.Itoa(params.Channels),
+		"--latency-msec=100",
+	)
+	return &pulseStream{cmd: cmd, source: device.ID}, nil
+}
+
+// pulseStream reads raw little-endian frames from a parec process.
+type pulseStream struct {
+	cmd    *exec.Cmd
+	source string
+	out    io.ReadCloser
+	stderr bytes.Buffer
+	raw    []byte
+	once   sync.Once
+}
+
+func (s *pulseStream) Start() error {
+	out, err := s.cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	s.cmd.Stderr = &s.stderr
+	if err := s.cmd.Start(); err != nil {
+		return fmt.Errorf("start parec: %w", err)
+	}
+	s.out = out
+	return nil
+}
+
+func (s *pulseStream) Read(buf []int32) error {
+	if s.out == nil {
+		return fmt.Errorf("pulse stream is not running")
+	}
+	if cap(s.raw) < 4*len(buf) {
+		s.raw = make([]byte, 4*len(buf))
+	}
+	raw := s.raw[:4*len(buf)]
+
+	if _, err := io.ReadFull(s.out, raw); err != nil {
+		// stderr is only safe to read once parec has been reaped.
+		s.Close()
+		return fmt.Errorf("parec on %s stopped: %w %s", s.source, err, strings.TrimSpace(s.stderr.String()))
+	}
+	for i := range buf {
+		buf[i] = int32(binary.LittleEndian.Uint32(raw[4*i:]))
+	}
+	return nil
+}
+
+func (s *pulseStream) Stop() error {
+	if s.cmd.Process == nil {
+		return nil
+	}
+	return s.cmd.Process.Kill()
+}
+
+// Close reaps parec. It was killed by Stop, so its exit error is expected.
+func (s *pulseStream) Close() error {
+	if s.cmd.Process == nil {
+		return nil
+	}
+	s.once.Do(func() {
+		s.cmd.Process.Kill()
+		s.cmd.Wait()
+	})
+	return nil
+}
@@ -0,0 +1,139 @@
+package audio
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// pactlSources is "pactl list sources" on a Pi with PipeWire, a USB
+// microphone and HDMI output, trimmed to what matters.
+const pactlSources = `Source #45
+	State: SUSPENDED
+	Name: alsa_output.platform-fef00700.hdmi.hdmi-stereo.monitor
+	Description: Monitor of Built-in Audio Digital Stereo (HDMI)
+	Driver: PipeWire
+	Sample Specification: s32le 2ch 48000Hz
+	Channel Map: front-left,front-right
+	Owner Module: 4294967295
+	Mute: no
+	Monitor of Sink: alsa_output.platform-fef00700.hdmi.hdmi-stereo
+	Properties:
+		device.description = "Monitor of Built-in Audio Digital Stereo (HDMI)"
+	Formats:
+		pcm
+
+Source #46
+	State: RUNNING
+	Name: alsa_input.usb-C-Media_Electronics_Inc._USB_PnP_Sound_Device-00.mono-fallback
+	Description: USB PnP Sound Device Mono
+	Driver: PipeWire
+	Sample Specification: s16le 1ch 44100Hz
+	Channel Map: mono
+	Monitor of Sink: n/a
+	Properties:
+		device.description = "USB PnP Sound Device"
+		api.alsa.path = "front:1"
+	Ports:
+		analog-input-mic: Microphone (type: Mic, priority: 8700, availability unknown)
+	Active Port: analog-input-mic
+
+Source #52
+	State: SUSPENDED
+	Name: alsa_input.usb-Focusrite_Scarlett_4i4_USB-00.multichannel-input
+	Description: Scarlett 4i4 USB Multichannel
+	Sample Specification: s32le 4ch 48000Hz
+	Monitor of Sink: n/a
+
+Source #60
+	Name: virtual-null-source
+	Sample Specification: float32le 2ch 96000Hz
+	Monitor of Sink: n/a
+`
+
+func TestParsePulseSources(t *testing.T) {
+	sources := parsePulseSources([]byte(pactlSources))
+	want := []pulseSource{
+		{"alsa_output.platform-fef00700.hdmi.hdmi-stereo.monitor", "Monitor of Built-in Audio Digital Stereo (HDMI)", 2, 48000, true},
+		{"alsa_input.usb-C-Media_Electronics_Inc._USB_PnP_Sound_Device-00.mono-fallback", "USB PnP Sound Device Mono", 1, 44100, false},
+		{"alsa_input.usb-Focusrite_Scarlett_4i4_USB-00.multichannel-input", "Scarlett 4i4 USB Multichannel", 4, 48000, false},
+		{"virtual-null-source", "virtual-null-source", 2, 96000, false},
+	}
+	if len(sources) != len(want) {
+		t.Fatalf("parsed %+v", sources)
+	}
+	for i := range want {
+		if sources[i] != want[i] {
+			t.Errorf("source %d = %+v, want %+v", i, sources[i], want[i])
+		}
+	}
+
+	for _, out := range []string{"", "Connection failure: Connection refused\n"} {
+		if sources := parsePulseSources([]byte(out)); len(sources) != 0 {
+			t.Errorf("parsed %q into %+v", out, sources)
+		}
+	}
+}
+
+// TestPulseDevices runs the backend against a pactl script printing
+// pactlSources.
+func TestPulseDevices(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "sources"), []byte(pactlSources), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	script := `#!/bin/sh
+case "$*" in
+"list sources") cat "` + filepath.Join(dir, "sources") + `" ;;
+get-default-source) echo alsa_input.usb-Focusrite_Scarlett_4i4_USB-00.multichannel-input ;;
+*) exit 1 ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(dir, "pactl"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	b := &PulseBackend{}
+	devices, err := b.Devices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The monitor of the HDMI sink is left out.
+	want := []AudioDevice{
+		{Index: 0, Name: "USB PnP Sound Device Mono", MaxInputChannels: 1, DefaultSampleRate: 44100, HostAPI: "PulseAudio",
+			ID: "alsa_input.usb-C-Media_Electronics_Inc._USB_PnP_Sound_Device-00.mono-fallback"},
+		{Index: 1, Name: "Scarlett 4i4 USB Multichannel", MaxInputChannels: 4, DefaultSampleRate: 48000, HostAPI: "PulseAudio",
+			ID: "alsa_input.usb-Focusrite_Scarlett_4i4_USB-00.multichannel-input"},
+		{Index: 2, Name: "virtual-null-source", MaxInputChannels: 2, DefaultSampleRate: 96000, HostAPI: "PulseAudio",
+			ID: "virtual-null-source"},
+	}
+	if len(devices) != len(want) {
+		t.Fatalf("listed %+v", devices)
+	}
+	for i := range want {
+		if devices[i].Index != want[i].Index || devices[i].Name != want[i].Name || devices[i].ID != want[i].ID ||
+			devices[i].MaxInputChannels != want[i].MaxInputChannels || devices[i].DefaultSampleRate != want[i].DefaultSampleRate ||
+			devices[i].HostAPI != want[i].HostAPI {
+			t.Errorf("device %d = %+v, want %+v", i, devices[i], want[i])
+		}
+	}
+
+	for _, test := range []struct {
+		index int
+		id    string
+	}{
+		{-1, want[1].ID},
+		{0, want[0].ID},
+		{2, want[2].ID},
+		{3, ""},
+	} {
+		device, err := b.Device(test.index)
+		switch {
+		case test.id == "" && err == nil:
+			t.Errorf("Device(%d) = %+v, want an error", test.index, device)
+		case test.id != "" && (err != nil || device.ID != test.id):
+			t.Errorf("Device(%d) = %+v, %v; want %s", test.index, device, err, test.id)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// chunkLayout describes an IFF-style container: AIFF is big-endian with a
+// signed 32-bit FORM size, WAV little-endian with an unsigned 32-bit RIFF
+// size.
+type chunkLayout struct {
+	order interface {
+		binary.ByteOrder
+		binary.AppendByteOrder
+	}
+	form    string
+	kind    string
+	maxSize int64
+}
+
+var (
+	aiffLayout = chunkLayout{binary.BigEndian, "FORM", "AIFF", math.MaxInt32}
+	wavLayout  = chunkLayout{binary.LittleEndian, "RIFF", "WAVE", math.MaxUint32}
+)
+
+// chunk builds a chunk with its header.
+func (l chunkLayout) chunk(id string, body []byte) []byte {
+	chunk := []byte(id)
+	chunk = l.order.AppendUint32(chunk, uint32(len(body)))
+	return append(chunk, body...)
+}
+
+// walk calls fn with the ID, body offset and body size of each chunk of
+// file, and returns the offset after the last one.
+func (l chunkLayout) walk(file *os.File, fn func(id string, offset, size int64) error) (int64, error) {
+	var form [12]byte
+	if _, err := file.ReadAt(form[:], 0); err != nil {
+		return 0, fmt.Errorf("read %s header: %w", l.form, err)
+	}
+	if string(form[0:4]) != l.form || string(form[8:12]) != l.kind {
+		return 0, fmt.Errorf("not an %s file", l.kind)
+	}
+
+	offset := int64(12)
+	for {
+		var header [8]byte
+		if _, err := file.ReadAt(header[:], offset); err == io.EOF {
+			return offset, nil
+		} else if err != nil {
+			return 0, err
+		}
+		size := int64(l.order.Uint32(header[4:8]))
+		if err := fn(string(header[0:4]), offset+8, size); err != nil {
+			return 0, err
+		}
+		offset += 8 + size + size%2
+	}
+}
+
+// append adds chunks, built by chunk, after the last chunk of a file and
+// updates the container size. It fails if the file already has a chunk
+// like one of them: with the same ID, or for a LIST chunk the same list
+// type.
+func (l chunkLayout) append(path string, chunks ...[]byte) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	kinds := make(map[string]bool, len(chunks))
+	for _, chunk := range chunks {
+		kinds[chunkKind(chunk[:4], chunk[8:])] = true
+	}
+	end, err := l.walk(file, func(id string, offset, size int64) error {
+		var listType [4]byte
+		if id == "LIST" && size >= 4 {
+			if _, err := file.ReadAt(listType[:], offset); err != nil {
+				return err
+			}
+		}
+		if kind := chunkKind([]byte(id), listType[:]); kinds[kind] {
+			return fmt.Errorf("file already has a %s chunk", kind)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	var data []byte
+	if end%2 == 1 {
+		data = append(data, 0)
+	}
+	for _, chunk := range chunks {
+		data = appendPadded(data, chunk)
+	}
+	if end+int64(len(data))-8 > l.maxSize {
+		return fmt.Errorf("%s: no room for more chunks within the %s size limit", path, l.kind)
+	}
+	if _, err := file.WriteAt(data, end); err != nil {
+		return err
+	}
+
+	var size [4]byte
+	l.order.PutUint32(size[:], uint32(end+int64(len(data))-8))
+	if _, err := file.WriteAt(size[:], 4); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// chunkKind names a chunk by its ID, followed by the list type for a LIST
+// chunk, which holds unrelated data depending on that type.
+func chunkKind(id, body []byte) string {
+	if string(id) == "LIST" && len(body) >= 4 {
+		return "LIST " + string(body[:4])
+	}
+	return string(id)
+}
+
+// appendPadded appends chunk to dst with the pad byte that keeps the next
+// chunk at an even offset. The pad byte is not counted in the chunk size.
+func appendPadded(dst, chunk []byte) []byte {
+	dst = append(dst, chunk...)
+	if len(chunk)%2 == 1 {
+		dst = append(dst, 0)
+	}
+	return dst
+}
@@ -0,0 +1,395 @@
+package audio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ConvertOptions describes the output of Convert. Zero values keep the
+// property of the input.
+type ConvertOptions struct {
+	// Format is "aiff", "wav", "flac" or "raw" (headerless little-endian
+	// signed PCM). Empty takes it from the output file's extension.
+	Format        string
+	BitsPerSample int
+	// Channels is the input's channel count or 1, which mixes all
+	// channels down to mono.
+	Channels   int
+	SampleRate float64
+	// NoDither rounds to a lower bit depth without adding TPDF dither
+	// first.
+	NoDither bool
+}
+
+// ConvertResult describes a converted file.
+type ConvertResult struct {
+	Input         string  `json:"input"`
+	Output        string  `json:"output"`
+	Format        string  `json:"format"`
+	Channels      int     `json:"channels"`
+	BitsPerSample int     `json:"bits_per_sample"`
+	SampleRate    float64 `json:"sample_rate"`
+	Frames        int64   `json:"frames"`
+	Dithered      bool    `json:"dithered"`
+}
+
+// frameWriter is where Convert writes full-scale interleaved samples.
+type frameWriter interface {
+	WriteFrames(samples []int32) error
+	Close() error
+}
+
+// Convert reads an AIFF, WAV or FLAC file and writes it to outputPath in
+// the format, bit depth, channel count and sample rate of opts. When the
+// samples change, because they are mixed, resampled or reduced to fewer
+// bits, they are rounded to the output bit depth with TPDF dither. The
+// output is removed again if the conversion fails.
+func Convert(inputPath, outputPath string, opts ConvertOptions) (*ConvertResult, error) {
+	format := opts.Format
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(outputPath)), ".")
+		if format == "aif" {
+			format = "aiff"
+		}
+	}
+	if in, err := filepath.Abs(inputPath); err == nil {
+		if out, err := filepath.Abs(outputPath); err == nil && in == out {
+			return nil, fmt.Errorf("cannot convert %s onto itself", inputPath)
+		}
+	}
+
+	ar, err := OpenReader(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	defer ar.Close()
+
+	result := &ConvertResult{
+		Input:         inputPath,
+		Output:        outputPath,
+		Format:        format,
+		Channels:      opts.Channels,
+		BitsPerSample: opts.BitsPerSample,
+		SampleRate:    opts.SampleRate,
+	}
+	channels := int(ar.Channel)
+	if result.Channels == 0 {
+		result.Channels = channels
+	}
+	if result.Channels != channels && result.Channels != 1 {
+		return nil, fmt.Errorf("cannot mix %d channels to %d, only to 1", channels, result.Channels)
+	}
+	if result.SampleRate == 0 {
+		result.SampleRate = ar.SampleRate
+	}
+	if result.BitsPerSample == 0 {
+		result.BitsPerSample = (int(ar.BitsPerSample) + 7) / 8 * 8
+		if format == "flac" {
+			result.BitsPerSample = min(result.BitsPerSample, flacMaxBitsPerSample)
+		}
+	}
+
+	var resampler *Resampler
+	if result.SampleRate != ar.SampleRate {
+		if resampler, err = NewResampler(ar.SampleRate, result.SampleRate, result.Channels); err != nil {
+			return nil, err
+		}
+	}
+	// Samples that pass through unchanged already fit the output.
+	unchanged := resampler == nil && result.Channels == channels && result.BitsPerSample >= int(ar.BitsPerSample)
+	var quantizer *ditherQuantizer
+	if !unchanged && result.BitsPerSample < 32 {
+		quantizer = newDitherQuantizer(result.BitsPerSample, !opts.NoDither)
+		result.Dithered = !opts.NoDither
+	}
+
+	var out frameWriter
+	switch format {
+	case "aiff", "wav", "raw":
+		out, err = newPCMFileWriter(outputPath, format, int16(result.Channels), result.SampleRate, result.BitsPerSample)
+	case "flac":
+		out, err = newFLACWriter(outputPath, int16(result.Channels), result.SampleRate, result.BitsPerSample)
+	default:
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	frames, err := convertFrames(ar, out, result.Channels, resampler, quantizer)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(outputPath)
+		return nil, err
+	}
+	result.Frames = frames
+	return result, nil
+}
+
+// convertFrames streams the input through the mix, the resampler and
+// the quantizer into out and returns the number of frames written.
+func convertFrames(ar *Reader, out frameWriter, outChannels int, resampler *Resampler, quantizer *ditherQuantizer) (int64, error) {
+	channels := int(ar.Channel)
+	buf := make([]int32, readChunkFrames*channels)
+	mixed := make([]int32, readChunkFrames*outChannels)
+	var resampled []int32
+	if resampler != nil {
+		resampled = make([]int32, resampler.MaxOutput(readChunkFrames)*outChannels)
+	}
+
+	var frames int64
+	write := func(samples []int32) error {
+		if quantizer != nil {
+			quantizer.process(samples)
+		}
+		frames += int64(len(samples) / outChannels)
+		return out.WriteFrames(samples)
+	}
+
+	for {
+		n, err := ar.ReadFrames(buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return frames, err
+		}
+
+		samples := buf[:n*channels]
+		if outChannels != channels {
+			mixDown(mixed, samples, channels)
+			samples = mixed[:n]
+		}
+		if resampler != nil {
+			samples = resampled[:resampler.Process(resampled, samples)]
+		}
+		if err := write(samples); err != nil {
+			return frames, err
+		}
+	}
+
+	if resampler != nil {
+		for {
+			n := resampler.Flush(resampled)
+			if n == 0 {
+				break
+			}
+			if err := write(resampled[:n]); err != nil {
+				return frames, err
+			}
+		}
+	}
+	return frames, nil
+}
+
+// mixDown averages the channels of each interleaved frame of src into
+// one mono sample of dst.
+func mixDown(dst, src []int32, channels int) {
+	for f := 0; f < len(src)/channels; f++ {
+		var sum int64
+		for _, s := range src[f*channels : (f+1)*channels] {
+			sum += int64(s)
+		}
+		dst[f] = int32(sum / int64(channels))
+	}
+}
+
+// ditherQuantizer rounds full-scale samples to a lower bit depth. With
+// dither it first adds triangular noise of ±1 step, which turns the
+// rounding error into a constant noise floor instead of distortion that
+// follows the signal. The noise is seeded, so a conversion is repeatable.
+type ditherQuantizer struct {
+	shift    uint
+	min, max float64
+	rng      *rand.Rand
+}
+
+func newDitherQuantizer(bitsPerSample int, dither bool) *ditherQuantizer {
+	q := &ditherQuantizer{
+		shift: uint(32 - bitsPerSample),
+		min:   -float64(int64(1) << (bitsPerSample - 1)),
+		max:   float64(int64(1)<<(bitsPerSample-1) - 1),
+	}
+	if dither {
+		q.rng = rand.New(rand.NewPCG(1, 2))
+	}
+	return q
+}
+
+func (q *ditherQuantizer) process(samples []int32) {
+	step := float64(int64(1) << q.shift)
+	for i, s := range samples {
+		v := float64(s) / step
+		if q.rng != nil {
+			v += q.rng.Float64() - q.rng.Float64()
+		}
+		v = math.Max(q.min, math.Min(q.max, math.Round(v)))
+		samples[i] = int32(int64(v) << q.shift)
+	}
+}
+
+// pcmFileWriter writes integer PCM as AIFF, WAV or headerless raw data.
+// The header is written with the sizes once the length is known.
+type pcmFileWriter struct {
+	file    *os.File
+	w       *bufio.Writer
+	format  string
+	channel int16
+	bits    int
+	rate    float64
+	frames  int64
+	buf     []byte
+}
+
+func newPCMFileWriter(path, format string, channel int16, sampleRate float64, bitsPerSample int) (*pcmFileWriter, error) {
+	switch bitsPerSample {
+	case 8, 16, 24, 32:
+	default:
+		return nil, fmt.Errorf("cannot write %d-bit %s", bitsPerSample, strings.ToUpper(format))
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	pw := &pcmFileWriter{
+		file:    file,
+		w:       bufio.NewWriterSize(file, diskWriteSize),
+		format:  format,
+		channel: channel,
+		bits:    bitsPerSample,
+		rate:    sampleRate,
+	}
+	header, err := pw.header()
+	if err == nil {
+		_, err = pw.w.Write(header)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return pw, nil
+}
+
+// newStepWriter creates the 32-bit output of a processing step on ar,
+// named after inputPath with suffix appended, see newOutputWriter.
+func newStepWriter(inputPath, suffix string, ar *Reader) (string, *pcmFileWriter, error) {
+	return newOutputWriter(inputPath, suffix, ar.Format, ar.Channel, ar.SampleRate)
+}
+
+// newOutputWriter creates a 32-bit file next to inputPath, named after
+// it with suffix appended. It keeps the input's format and extension for
+// AIFF and WAV, and writes AIFF otherwise.
+func newOutputWriter(inputPath, suffix, format string, channel int16, sampleRate float64) (string, *pcmFileWriter, error) {
+	ext := filepath.Ext(inputPath)
+	if format != "aiff" && format != "wav" {
+		ext, format = ".aiff", "aiff"
+	}
+	path := strings.TrimSuffix(inputPath, filepath.Ext(inputPath)) + suffix + ext
+	out, err := newPCMFileWriter(path, format, channel, sampleRate, 32)
+	return path, out, err
+}
+
+// header returns the file header for the frames written so far.
+func (pw *pcmFileWriter) header() ([]byte, error) {
+	dataBytes := pw.frames * int64(pw.channel) * int64(pw.bits/8)
+	pad := dataBytes % 2
+
+	switch pw.format {
+	case "aiff":
+		if 46+dataBytes+pad > math.MaxInt32 {
+			return nil, fmt.Errorf("%d frames do not fit in an AIFF header", pw.frames)
+		}
+		comm := binary.BigEndian.AppendUint16(nil, uint16(pw.channel))
+		comm = binary.BigEndian.AppendUint32(comm, uint32(pw.frames))
+		comm = binary.BigEndian.AppendUint16(comm, uint16(pw.bits))
+		comm = append(comm, SampleRateToByte(pw.rate)...)
+
+		header := []byte("FORM")
+		header = binary.BigEndian.AppendUint32(header, uint32(46+dataBytes+pad))
+		header = append(header, "AIFF"...)
+		header = append(header, aiffLayout.chunk("COMM", comm)...)
+		header = append(header, "SSND"...)
+		header = binary.BigEndian.AppendUint32(header, uint32(8+dataBytes))
+		return append(header, make([]byte, 8)...), nil
+
+	case "wav":
+		format := wavFmtChunk(pw.channel, pw.rate, pw.bits)
+		if 4+8+int64(len(format))+8+dataBytes+pad > math.MaxUint32 {
+			return nil, fmt.Errorf("%d frames do not fit in a WAV header", pw.frames)
+		}
+		header := []byte("RIFF")
+		header = binary.LittleEndian.AppendUint32(header, uint32(4+8+int64(len(format))+8+dataBytes+pad))
+		header = append(header, "WAVE"...)
+		header = append(header, wavLayout.chunk("fmt ", format)...)
+		header = append(header, "data"...)
+		return binary.LittleEndian.AppendUint32(header, uint32(dataBytes)), nil
+	}
+	return nil, nil
+}
+
+func (pw *pcmFileWriter) WriteFrames(samples []int32) error {
+	bytesPerSample := pw.bits / 8
+	n := len(samples) * bytesPerSample
+	if cap(pw.buf) < n {
+		pw.buf = make([]byte, n)
+	}
+	pw.buf = pw.buf[:n]
+
+	shift := uint(32 - pw.bits)
+	for i, s := range samples {
+		v := uint32(s) >> shift
+		b := pw.buf[i*bytesPerSample : (i+1)*bytesPerSample]
+		for j := range b {
+			if pw.format == "aiff" {
+				b[j] = byte(v >> (8 * (bytesPerSample - 1 - j)))
+			} else {
+				b[j] = byte(v >> (8 * j))
+			}
+		}
+		// 8-bit WAV is unsigned.
+		if bytesPerSample == 1 && pw.format == "wav" {
+			b[0] ^= 0x80
+		}
+	}
+
+	pw.frames += int64(len(samples) / int(pw.channel))
+	if _, err := pw.header(); err != nil {
+		return err
+	}
+	_, err := pw.w.Write(pw.buf)
+	return err
+}
+
+func (pw *pcmFileWriter) Close() error {
+	err := func() error {
+		header, err := pw.header()
+		if err != nil {
+			return err
+		}
+		// Chunks are padded to an even length.
+		if pw.format != "raw" && pw.frames*int64(pw.channel)*int64(pw.bits/8)%2 == 1 {
+			if err := pw.w.WriteByte(0); err != nil {
+				return err
+			}
+		}
+		if err := pw.w.Flush(); err != nil {
+			return err
+		}
+		_, err = pw.file.WriteAt(header, 0)
+		return err
+	}()
+	if closeErr := pw.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,94 @@
+package audio
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+// readAll returns every sample of the file at path.
+func readAll(t *testing.T, path string) []int32 {
+	t.Helper()
+	ar, err := OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ar.Close()
+	var samples []int32
+	buf := make([]int32, readChunkFrames*int(ar.Channel))
+	for {
+		n, err := ar.ReadFrames(buf)
+		if err == io.EOF {
+			return samples
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		samples = append(samples, buf[:n*int(ar.Channel)]...)
+	}
+}
+
+// TestDitherBound converts a 32-bit tone to lower bit depths. Rounding
+// moves a sample by at most half a step and the triangular dither by less
+// than one more, so no output sample may be further than 1.5 steps from
+// its input. Without dither the bound is half a step.
+func TestDitherBound(t *testing.T) {
+	input := writeTestFile(t, "tone", 2, 48000, 1, func(i, c int) float64 {
+		// A quiet tone exercises the lowest bits, a loud one the clamp.
+		if c == 0 {
+			return 1e-4 * math.Sin(2*math.Pi*997*float64(i)/48000)
+		}
+		return 0.9999 * math.Sin(2*math.Pi*31*float64(i)/48000)
+	})
+	in := readAll(t, input)
+
+	for _, test := range []struct {
+		bits     int
+		noDither bool
+		bound    float64
+	}{
+		{8, false, 1.5},
+		{16, false, 1.5},
+		{24, false, 1.5},
+		{16, true, 0.5},
+	} {
+		t.Run(fmt.Sprintf("%dbit_nodither=%v", test.bits, test.noDither), func(t *testing.T) {
+			output := filepath.Join(t.TempDir(), "out.wav")
+			result, err := Convert(input, output, ConvertOptions{BitsPerSample: test.bits, NoDither: test.noDither})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Dithered == test.noDither {
+				t.Errorf("result says dithered %v", result.Dithered)
+			}
+			out := readAll(t, output)
+			if len(out) != len(in) {
+				t.Fatalf("converted %d samples to %d", len(in), len(out))
+			}
+
+			step := float64(int64(1) << (32 - test.bits))
+			var worst, sumSquares float64
+			for i := range in {
+				if int64(out[i])%int64(step) != 0 {
+					t.Fatalf("sample %d = %d is not on a %d-bit step", i, out[i], test.bits)
+				}
+				e := (float64(out[i]) - float64(in[i])) / step
+				worst = math.Max(worst, math.Abs(e))
+				sumSquares += e * e
+			}
+			if worst > test.bound {
+				t.Errorf("error up to %.3f steps, bound %.1f", worst, test.bound)
+			}
+			// Rounding adds 1/12 step² of noise and TPDF dither 1/6.
+			want := 1.0 / 12
+			if !test.noDither {
+				want += 1.0 / 6
+			}
+			if rms := math.Sqrt(sumSquares / float64(len(in))); math.Abs(rms-math.Sqrt(want)) > 0.05 {
+				t.Errorf("error RMS %.3f steps, want %.3f", rms, math.Sqrt(want))
+			}
+		})
+	}
+}
@@ -1,63 +1,102 @@
 package audio
 
 import (
+	"encoding/binary"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 )
 
+// rnnoiseSampleRate is the rate rnnoise_demo expects its 16-bit mono raw
+// input at.
+const rnnoiseSampleRate = 48000
+
+// DenoiseAudioFile runs an audio file through RNNoise and returns the
+// path of the result, a 48 kHz mono file named after the input with
+// _denoised appended, in its format for AIFF and WAV.
 func DenoiseAudioFile(inputPath string) (string, error) {
-	wavPath := inputPath[:len(inputPath)-5] + ".wav"
-	if err := convertAIFFToWAV(inputPath, wavPath); err != nil {
-		return "", fmt.Errorf("AIFF to WAV conversion failed: %w", err)
+	ar, err := OpenReader(inputPath)
+	if err != nil {
+		return "", err
 	}
-	defer os.Remove(wavPath)
+	format := ar.Format
+	ar.Close()
 
-	rawInput := wavPath[:len(wavPath)-4] + "_raw.pcm"
-	cmd := exec.Command("sox", wavPath, "-t", "raw", "-r", "48000", "-b", "16", "-c", "1", "-e", "signed-integer", rawInput)
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("WAV to PCM conversion failed: %w", err)
+	base := strings.TrimSuffix(inputPath, filepath.Ext(inputPath))
+	rawInput := base + "_raw.pcm"
+	_, err = Convert(inputPath, rawInput, ConvertOptions{
+		Format:        "raw",
+		BitsPerSample: 16,
+		Channels:      1,
+		SampleRate:    rnnoiseSampleRate,
+	})
+	if err != nil {
+		return "", fmt.Errorf("conversion to PCM failed: %w", err)
 	}
 	defer os.Remove(rawInput)
 
-	rawOutput := wavPath[:len(wavPath)-4] + "_denoised_raw.pcm"
-	cmd = exec.Command("./rnnoise/examples/.libs/rnnoise_demo", rawInput, rawOutput)
+	rawOutput := base + "_denoised_raw.pcm"
+	cmd := exec.Command("./rnnoise/examples/.libs/rnnoise_demo", rawInput, rawOutput)
 	if err := cmd.Run(); err != nil {
 		return "", fmt.Errorf("RNNoise processing failed: %w", err)
 	}
 	defer os.Remove(rawOutput)
 
-	denoisedWAV := wavPath[:len(wavPath)-4] + "_denoised.wav"
-	cmd = exec.Command("sox", "-t", "raw", "-r", "48000", "-b", "16", "-c", "1", "-e", "signed-integer", rawOutput, denoisedWAV)
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("PCM to WAV conversion failed: %w", err)
+	denoisedPath, err := wrapRaw(rawOutput, inputPath, "_denoised", format, rnnoiseSampleRate)
+	if err != nil {
+		return "", fmt.Errorf("conversion from PCM failed: %w", err)
 	}
-	defer os.Remove(denoisedWAV)
-
-	denoisedPath := inputPath[:len(inputPath)-5] + "_denoised.aiff"
-	if err := convertWAVToAIFF(denoisedWAV, denoisedPath); err != nil {
-		return "", fmt.Errorf("WAV to AIFF conversion failed: %w", err)
-	}
-
 	return denoisedPath, nil
 }
 
-func convertAIFFToWAV(inputPath, outputPath string) error {
-	cmd := exec.Command("sox", inputPath, outputPath)
-	return cmd.Run()
-}
+// wrapRaw wraps 16-bit little-endian mono raw PCM in a file named after
+// inputPath with suffix appended, see newOutputWriter, and returns its
+// path.
+func wrapRaw(rawPath, inputPath, suffix, format string, sampleRate float64) (string, error) {
+	in, err := os.Open(rawPath)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
 
-func convertWAVToAIFF(inputPath, outputPath string) error {
-	cmd := exec.Command("sox", inputPath, outputPath)
-	return cmd.Run()
+	outputPath, out, err := newOutputWriter(inputPath, suffix, format, 1, sampleRate)
+	if err != nil {
+		return "", err
+	}
+	err = func() error {
+		raw := make([]byte, 2*readChunkFrames)
+		samples := make([]int32, readChunkFrames)
+		for {
+			n, err := io.ReadFull(in, raw)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil && err != io.ErrUnexpectedEOF {
+				return err
+			}
+			frames := n / 2
+			for i := 0; i < frames; i++ {
+				samples[i] = int32(int16(binary.LittleEndian.Uint16(raw[2*i:]))) << 16
+			}
+			if err := out.WriteFrames(samples[:frames]); err != nil {
+				return err
+			}
+		}
+	}()
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(outputPath)
+		return "", err
+	}
+	return outputPath, nil
 }
 
 func CheckRNNoiseAvailable() error {
-	// Check sox
-	if err := exec.Command("sox", "--version").Run(); err != nil {
-		return fmt.Errorf("sox not found: %w", err)
-	}
-
 	// Check rnnoise_demo
 	if err := exec.Command("./rnnoise/examples/.libs/rnnoise_demo").Run(); err != nil {
 		return fmt.Errorf("rnnoise_demo not found: %w", err)
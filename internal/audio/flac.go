@@ -0,0 +1,563 @@
+package audio
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"math"
+	"math/bits"
+	"os"
+)
+
+// FLAC files are written with a fixed block size and the fixed
+// polynomial predictors of the format, which keeps the encoder small; the
+// reader also decodes the LPC subframes other encoders produce.
+
+const (
+	flacBlockSize = 4096
+	// flacMaxPartitionOrder is the limit of the streamable subset.
+	flacMaxPartitionOrder = 8
+	flacMaxFixedOrder     = 4
+	flacMaxBitsPerSample  = 24
+)
+
+// Channel assignments of a FLAC frame beyond the independent ones.
+const (
+	flacLeftSide  = 8
+	flacRightSide = 9
+	flacMidSide   = 10
+)
+
+// Subframe types as written in the subframe header.
+const (
+	flacSubframeConstant = 0
+	flacSubframeVerbatim = 1
+	flacSubframeFixed    = 8
+	flacSubframeLPC      = 32
+)
+
+var flacCRC8Table, flacCRC16Table = flacCRCTables()
+
+func flacCRCTables() (crc8 [256]uint8, crc16 [256]uint16) {
+	for i := range crc8 {
+		c8 := uint8(i)
+		c16 := uint16(i) << 8
+		for b := 0; b < 8; b++ {
+			if c8&0x80 != 0 {
+				c8 = c8<<1 ^ 0x07
+			} else {
+				c8 <<= 1
+			}
+			if c16&0x8000 != 0 {
+				c16 = c16<<1 ^ 0x8005
+			} else {
+				c16 <<= 1
+			}
+		}
+		crc8[i], crc16[i] = c8, c16
+	}
+	return crc8, crc16
+}
+
+func flacCRC8(data []byte) uint8 {
+	var crc uint8
+	for _, b := range data {
+		crc = flacCRC8Table[crc^b]
+	}
+	return crc
+}
+
+func flacCRC16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc = crc<<8 ^ flacCRC16Table[byte(crc>>8)^b]
+	}
+	return crc
+}
+
+// flacSampleRates maps the sample rates a frame header can name to their
+// codes; other rates are left to the STREAMINFO block.
+var flacSampleRates = map[float64]uint64{
+	88200: 1, 176400: 2, 192000: 3, 8000: 4, 16000: 5, 22050: 6,
+	24000: 7, 32000: 8, 44100: 9, 48000: 10, 96000: 11,
+}
+
+// flacSampleSizes maps bit depths to their frame header codes.
+var flacSampleSizes = map[int]uint64{8: 1, 12: 2, 16: 4, 20: 5, 24: 6, 32: 7}
+
+// bitWriter packs values MSB first into a byte slice.
+type bitWriter struct {
+	buf []byte
+	acc uint64
+	n   uint
+}
+
+// write appends the low n bits of v; n is at most 32.
+func (bw *bitWriter) write(v uint64, n uint) {
+	bw.acc = bw.acc<<n | v&(1<<n-1)
+	bw.n += n
+	for bw.n >= 8 {
+		bw.n -= 8
+		bw.buf = append(bw.buf, byte(bw.acc>>bw.n))
+	}
+}
+
+// writeUnary writes q zero bits followed by a one.
+func (bw *bitWriter) writeUnary(q uint64) {
+	for ; q >= 32; q -= 32 {
+		bw.write(0, 32)
+	}
+	bw.write(1, uint(q)+1)
+}
+
+// align pads with zero bits up to the next byte.
+func (bw *bitWriter) align() {
+	if bw.n > 0 {
+		bw.write(0, 8-bw.n)
+	}
+}
+
+// flacWriter writes a FLAC file. Samples are passed full-scale like to
+// the other writers and must already be quantized to the bit depth.
+type flacWriter struct {
+	file     *os.File
+	w        *bufio.Writer
+	channels int
+	bits     int
+	rate     float64
+
+	pending  []int64
+	frames   int64
+	number   uint64
+	minFrame int
+	maxFrame int
+	md5      hash.Hash
+	md5buf   []byte
+	bw       bitWriter
+	// channel holds one block of each channel, and of the mid and side
+	// signals of a stereo frame.
+	channel [][]int64
+}
+
+func newFLACWriter(path string, channel int16, sampleRate float64, bitsPerSample int) (*flacWriter, error) {
+	if channel < 1 || channel > 8 {
+		return nil, fmt.Errorf("FLAC holds 1 to 8 channels, not %d", channel)
+	}
+	if bitsPerSample < 4 || bitsPerSample > flacMaxBitsPerSample {
+		return nil, fmt.Errorf("cannot write %d-bit FLAC", bitsPerSample)
+	}
+	if sampleRate != math.Round(sampleRate) || sampleRate < 1 || sampleRate >= 1<<20 {
+		return nil, fmt.Errorf("cannot write FLAC at %g Hz", sampleRate)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	fw := &flacWriter{
+		file:     file,
+		w:        bufio.NewWriterSize(file, diskWriteSize),
+		channels: int(channel),
+		bits:     bitsPerSample,
+		rate:     sampleRate,
+		minFrame: math.MaxInt,
+		md5:      md5.New(),
+	}
+	fw.channel = make([][]int64, max(fw.channels, 4))
+	for i := range fw.channel {
+		fw.channel[i] = make([]int64, flacBlockSize)
+	}
+	// The STREAMINFO block is filled in by Close.
+	if _, err := fw.w.Write(make([]byte, 4+4+34)); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return fw, nil
+}
+
+func (fw *flacWriter) WriteFrames(samples []int32) error {
+	shift := 32 - fw.bits
+	bytesPerSample := (fw.bits + 7) / 8
+	fw.md5buf = fw.md5buf[:0]
+	for _, s := range samples {
+		v := int64(s >> shift)
+		fw.pending = append(fw.pending, v)
+		for b := 0; b < bytesPerSample; b++ {
+			fw.md5buf = append(fw.md5buf, byte(v>>(8*b)))
+		}
+	}
+	fw.md5.Write(fw.md5buf)
+
+	block := flacBlockSize * fw.channels
+	done := 0
+	for len(fw.pending)-done >= block {
+		if err := fw.writeFrame(fw.pending[done : done+block]); err != nil {
+			return err
+		}
+		done += block
+	}
+	fw.pending = fw.pending[:copy(fw.pending, fw.pending[done:])]
+	return nil
+}
+
+func (fw *flacWriter) Close() error {
+	err := func() error {
+		if len(fw.pending) > 0 {
+			if err := fw.writeFrame(fw.pending); err != nil {
+				return err
+			}
+		}
+		if err := fw.w.Flush(); err != nil {
+			return err
+		}
+		_, err := fw.file.WriteAt(fw.streamInfo(), 0)
+		return err
+	}()
+	if closeErr := fw.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// streamInfo returns the file signature and the STREAMINFO block.
+func (fw *flacWriter) streamInfo() []byte {
+	blockSize := uint64(flacBlockSize)
+	if fw.frames < flacBlockSize {
+		blockSize = uint64(max(fw.frames, 16))
+	}
+	minFrame := fw.minFrame
+	if minFrame == math.MaxInt {
+		minFrame = 0
+	}
+
+	var bw bitWriter
+	bw.buf = append(bw.buf, "fLaC"...)
+	bw.write(1, 1) // last metadata block
+	bw.write(0, 7) // STREAMINFO
+	bw.write(34, 24)
+	bw.write(blockSize, 16)
+	bw.write(blockSize, 16)
+	bw.write(uint64(minFrame), 24)
+	bw.write(uint64(fw.maxFrame), 24)
+	bw.write(uint64(fw.rate), 20)
+	bw.write(uint64(fw.channels-1), 3)
+	bw.write(uint64(fw.bits-1), 5)
+	bw.write(uint64(fw.frames)>>32, 4)
+	bw.write(uint64(fw.frames), 32)
+	return append(bw.buf, fw.md5.Sum(nil)...)
+}
+
+// writeFrame encodes one block of interleaved samples as a frame.
+func (fw *flacWriter) writeFrame(samples []int64) error {
+	n := len(samples) / fw.channels
+	bw := &fw.bw
+	bw.buf = bw.buf[:0]
+
+	bw.write(0xfff8, 16) // sync code, fixed block size
+	var blockCode uint64
+	switch {
+	case n == flacBlockSize:
+		blockCode = 12
+	case n <= 256:
+		blockCode = 6
+	default:
+		blockCode = 7
+	}
+	bw.write(blockCode, 4)
+	bw.write(flacSampleRates[fw.rate], 4)
+
+	var plans []*flacSubframe
+	assignment := uint64(fw.channels - 1)
+	if fw.channels == 2 {
+		assignment, plans = fw.planStereo(samples, n)
+	} else {
+		for c := 0; c < fw.channels; c++ {
+			x := fw.channel[c][:n]
+			for i := range x {
+				x[i] = samples[i*fw.channels+c]
+			}
+			plans = append(plans, planFLACSubframe(x, fw.bits))
+		}
+	}
+	bw.write(assignment, 4)
+	bw.write(flacSampleSizes[fw.bits], 3)
+	bw.write(0, 1)
+	writeFLACNumber(bw, fw.number)
+	switch blockCode {
+	case 6:
+		bw.write(uint64(n-1), 8)
+	case 7:
+		bw.write(uint64(n-1), 16)
+	}
+	bw.write(uint64(flacCRC8(bw.buf)), 8)
+
+	for _, plan := range plans {
+		plan.write(bw)
+	}
+	bw.align()
+	bw.write(uint64(flacCRC16(bw.buf)), 16)
+
+	if _, err := fw.w.Write(bw.buf); err != nil {
+		return err
+	}
+	fw.minFrame = min(fw.minFrame, len(bw.buf))
+	fw.maxFrame = max(fw.maxFrame, len(bw.buf))
+	fw.frames += int64(n)
+	fw.number++
+	return nil
+}
+
+// planStereo picks the cheapest of coding left and right, or one of
+// them, or their mean, together with their difference.
+func (fw *flacWriter) planStereo(samples []int64, n int) (uint64, []*flacSubframe) {
+	left, right, mid, side := fw.channel[0][:n], fw.channel[1][:n], fw.channel[2][:n], fw.channel[3][:n]
+	for i := 0; i < n; i++ {
+		l, r := samples[2*i], samples[2*i+1]
+		left[i], right[i] = l, r
+		mid[i], side[i] = (l+r)>>1, l-r
+	}
+	l := planFLACSubframe(left, fw.bits)
+	r := planFLACSubframe(right, fw.bits)
+	m := planFLACSubframe(mid, fw.bits)
+	s := planFLACSubframe(side, fw.bits+1)
+
+	assignment, plans, cost := uint64(1), []*flacSubframe{l, r}, l.bits+r.bits
+	if c := l.bits + s.bits; c < cost {
+		assignment, plans, cost = flacLeftSide, []*flacSubframe{l, s}, c
+	}
+	if c := s.bits + r.bits; c < cost {
+		assignment, plans, cost = flacRightSide, []*flacSubframe{s, r}, c
+	}
+	if c := m.bits + s.bits; c < cost {
+		assignment, plans = flacMidSide, []*flacSubframe{m, s}
+	}
+	return assignment, plans
+}
+
+// writeFLACNumber writes a frame number in the UTF-8-like coding of
+// FLAC frame headers.
+func writeFLACNumber(bw *bitWriter, v uint64) {
+	if v < 0x80 {
+		bw.write(v, 8)
+		return
+	}
+	extra := 1
+	for v >= 1<<(6+5*uint(extra)) {
+		extra++
+	}
+	lead := uint64(0xff00>>(extra+1)) & 0xff
+	bw.write(lead|v>>(6*uint(extra)), 8)
+	for i := extra - 1; i >= 0; i-- {
+		bw.write(0x80|(v>>(6*uint(i)))&0x3f, 8)
+	}
+}
+
+// flacSubframe is the chosen coding of one channel of a frame.
+type flacSubframe struct {
+	kind   int
+	order  int
+	wasted uint
+	bps    uint
+	// samples are shifted right by wasted; residual holds the prediction
+	// errors after the warm-up samples.
+	samples  []int64
+	residual []int64
+	// params holds the Rice parameter of each partition.
+	params         []uint
+	partitionOrder uint
+	bits           int
+}
+
+// planFLACSubframe chooses the smallest coding of x among constant,
+// verbatim and the fixed predictors.
+func planFLACSubframe(x []int64, bps int) *flacSubframe {
+	sf := &flacSubframe{samples: x, bps: uint(bps)}
+
+	constant := true
+	var or int64
+	for _, v := range x {
+		or |= v
+		constant = constant && v == x[0]
+	}
+	if constant {
+		sf.kind = flacSubframeConstant
+		sf.bits = 8 + bps
+		return sf
+	}
+	if or != 0 {
+		if wasted := uint(bits.TrailingZeros64(uint64(or))); wasted > 0 {
+			shifted := make([]int64, len(x))
+			for i, v := range x {
+				shifted[i] = v >> wasted
+			}
+			sf.samples, sf.wasted, sf.bps = shifted, wasted, uint(bps)-wasted
+		}
+	}
+
+	sf.kind = flacSubframeVerbatim
+	sf.bits = 8 + int(sf.wasted) + len(x)*int(sf.bps)
+	for order := 0; order <= flacMaxFixedOrder && order < len(x); order++ {
+		residual := fixedResidual(sf.samples, order)
+		params, partitionOrder, cost := planRice(residual, len(x), order)
+		cost += 8 + int(sf.wasted) + order*int(sf.bps)
+		if cost < sf.bits {
+			sf.kind, sf.order, sf.bits = flacSubframeFixed, order, cost
+			sf.residual, sf.params, sf.partitionOrder = residual, params, partitionOrder
+		}
+	}
+	return sf
+}
+
+// fixedResidual returns the prediction errors of the fixed predictor of
+// the given order for the samples after the first order ones.
+func fixedResidual(x []int64, order int) []int64 {
+	r := make([]int64, len(x)-order)
+	for i := order; i < len(x); i++ {
+		var p int64
+		switch order {
+		case 1:
+			p = x[i-1]
+		case 2:
+			p = 2*x[i-1] - x[i-2]
+		case 3:
+			p = 3*x[i-1] - 3*x[i-2] + x[i-3]
+		case 4:
+			p = 4*x[i-1] - 6*x[i-2] + 4*x[i-3] - x[i-4]
+		}
+		r[i-order] = x[i] - p
+	}
+	return r
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+// planRice splits the residual of a block of n samples into 2^order
+// partitions, each with its own Rice parameter, choosing the order and
+// parameters that give the smallest estimated size in bits.
+func planRice(residual []int64, n, predictorOrder int) ([]uint, uint, int) {
+	maxOrder := uint(0)
+	for o := uint(1); o <= flacMaxPartitionOrder; o++ {
+		if n%(1<<o) != 0 || n>>o <= predictorOrder {
+			break
+		}
+		maxOrder = o
+	}
+
+	// Sums of the coded values over the finest partitions; coarser
+	// partitions add them up.
+	sums := make([]uint64, 1<<maxOrder)
+	counts := make([]int, 1<<maxOrder)
+	size := n >> maxOrder
+	for i, r := range residual {
+		p := (i + predictorOrder) / size
+		sums[p] += zigzag(r)
+		counts[p]++
+	}
+
+	var best []uint
+	var bestOrder uint
+	bestCost := math.MaxInt
+	for order := int(maxOrder); order >= 0; order-- {
+		params := make([]uint, len(sums))
+		cost := 6 // coding method and partition order
+		rice2 := false
+		for p := range sums {
+			k, c := riceParameter(sums[p], counts[p])
+			params[p], cost = k, cost+c
+			rice2 = rice2 || k > 14
+		}
+		if rice2 {
+			cost += len(sums) * 5
+		} else {
+			cost += len(sums) * 4
+		}
+		if cost < bestCost {
+			best, bestOrder, bestCost = params, uint(order), cost
+		}
+		if order > 0 {
+			for p := 0; p < len(sums)/2; p++ {
+				sums[p] = sums[2*p] + sums[2*p+1]
+				counts[p] = counts[2*p] + counts[2*p+1]
+			}
+			sums, counts = sums[:len(sums)/2], counts[:len(counts)/2]
+		}
+	}
+	return best, bestOrder, bestCost
+}
+
+// riceParameter returns the parameter that codes count values summing to
+// sum in the fewest bits, and that estimated size.
+func riceParameter(sum uint64, count int) (uint, int) {
+	best, bestCost := uint(0), math.MaxInt
+	for k := uint(0); k <= 30; k++ {
+		cost := count*int(k+1) + int(sum>>k)
+		if cost < bestCost {
+			best, bestCost = k, cost
+		}
+	}
+	return best, bestCost
+}
+
+func (sf *flacSubframe) write(bw *bitWriter) {
+	bw.write(0, 1)
+	switch sf.kind {
+	case flacSubframeFixed:
+		bw.write(uint64(flacSubframeFixed+sf.order), 6)
+	default:
+		bw.write(uint64(sf.kind), 6)
+	}
+	if sf.wasted > 0 {
+		bw.write(1, 1)
+		bw.writeUnary(uint64(sf.wasted - 1))
+	} else {
+		bw.write(0, 1)
+	}
+
+	switch sf.kind {
+	case flacSubframeConstant:
+		bw.write(uint64(sf.samples[0]), sf.bps)
+	case flacSubframeVerbatim:
+		for _, v := range sf.samples {
+			bw.write(uint64(v), sf.bps)
+		}
+	case flacSubframeFixed:
+		for _, v := range sf.samples[:sf.order] {
+			bw.write(uint64(v), sf.bps)
+		}
+		sf.writeResidual(bw)
+	}
+}
+
+func (sf *flacSubframe) writeResidual(bw *bitWriter) {
+	paramBits := uint(4)
+	for _, k := range sf.params {
+		if k > 14 {
+			paramBits = 5
+		}
+	}
+	bw.write(uint64(paramBits-4), 2)
+	bw.write(uint64(sf.partitionOrder), 4)
+
+	size := len(sf.samples) >> sf.partitionOrder
+	i := 0
+	for p, k := range sf.params {
+		bw.write(uint64(k), paramBits)
+		end := (p+1)*size - sf.order
+		for ; i < end; i++ {
+			u := zigzag(sf.residual[i])
+			bw.writeUnary(u >> k)
+			if k > 0 {
+				bw.write(u, k)
+			}
+		}
+	}
+}
+
+// flacTotalSamples reads the length in frames from a STREAMINFO block.
+func flacTotalSamples(info []byte) int64 {
+	return int64(binary.BigEndian.Uint64(info[10:18]) & (1<<36 - 1))
+}
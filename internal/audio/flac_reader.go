@@ -0,0 +1,460 @@
+package audio
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// bitReader reads values MSB first and keeps the CRCs of the bytes read
+// so far for checking frame headers and frames.
+type bitReader struct {
+	r     io.ByteReader
+	acc   uint64
+	n     uint
+	crc8  uint8
+	crc16 uint16
+}
+
+func (br *bitReader) fill() error {
+	b, err := br.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	br.crc8 = flacCRC8Table[br.crc8^b]
+	br.crc16 = br.crc16<<8 ^ flacCRC16Table[byte(br.crc16>>8)^b]
+	br.acc = br.acc<<8 | uint64(b)
+	br.n += 8
+	return nil
+}
+
+// read returns the next n bits; n is at most 56.
+func (br *bitReader) read(n uint) (uint64, error) {
+	for br.n < n {
+		if err := br.fill(); err != nil {
+			return 0, err
+		}
+	}
+	br.n -= n
+	return br.acc >> br.n & (1<<n - 1), nil
+}
+
+// readSigned returns the next n bits as a two's complement number.
+func (br *bitReader) readSigned(n uint) (int64, error) {
+	if n == 0 {
+		return 0, nil
+	}
+	v, err := br.read(n)
+	return int64(v<<(64-n)) >> (64 - n), err
+}
+
+// readUnary counts zero bits up to the next one bit.
+func (br *bitReader) readUnary() (uint64, error) {
+	var q uint64
+	for {
+		if br.n == 0 {
+			if err := br.fill(); err != nil {
+				return 0, err
+			}
+		}
+		v := br.acc & (1<<br.n - 1)
+		if v == 0 {
+			q += uint64(br.n)
+			br.n = 0
+			continue
+		}
+		zeros := uint(bits.LeadingZeros64(v)) - (64 - br.n)
+		br.n -= zeros + 1
+		return q + uint64(zeros), nil
+	}
+}
+
+// align drops the bits left in the current byte.
+func (br *bitReader) align() {
+	br.n -= br.n % 8
+}
+
+// flacDecoder decodes the frames of a FLAC stream one block at a time.
+type flacDecoder struct {
+	br       bitReader
+	channels int
+	bits     int
+	// block holds the decoded block, one slice per channel, and pos the
+	// next frame of it to return.
+	block [][]int64
+	n     int
+	pos   int
+}
+
+// readFLACHeader reads the metadata blocks of a FLAC file, positioned
+// after its signature, and sets up the decoder for the frames.
+func (ar *Reader) readFLACHeader() error {
+	r := bufio.NewReaderSize(ar.file, 64*1024)
+	for last := false; !last; {
+		var header [4]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return fmt.Errorf("read metadata block: %w", err)
+		}
+		last = header[0]&0x80 != 0
+		size := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		body := make([]byte, size)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return fmt.Errorf("read metadata block: %w", err)
+		}
+		if header[0]&0x7f != 0 {
+			continue
+		}
+		if size < 34 {
+			return fmt.Errorf("short STREAMINFO block")
+		}
+		ar.SampleRate = float64(int(body[10])<<12 | int(body[11])<<4 | int(body[12])>>4)
+		ar.Channel = int16(body[12]>>1&0x07) + 1
+		ar.BitsPerSample = int16((body[12]&0x01)<<4|body[13]>>4) + 1
+		ar.NumFrames = flacTotalSamples(body)
+	}
+	if ar.SampleRate == 0 {
+		return fmt.Errorf("no STREAMINFO block")
+	}
+	if err := ar.checkFormat(); err != nil {
+		return err
+	}
+	if ar.NumFrames == 0 {
+		return fmt.Errorf("FLAC stream of unknown length")
+	}
+
+	ar.remaining = ar.NumFrames
+	ar.flac = &flacDecoder{
+		br:       bitReader{r: r},
+		channels: int(ar.Channel),
+		bits:     int(ar.BitsPerSample),
+		block:    make([][]int64, ar.Channel),
+	}
+	return nil
+}
+
+// readFLACFrames is ReadFrames for a FLAC file.
+func (ar *Reader) readFLACFrames(buf []int32, frames int) (int, error) {
+	d := ar.flac
+	channels := int(ar.Channel)
+	shift := uint(32 - d.bits)
+	for f := 0; f < frames; f++ {
+		if d.pos == d.n {
+			if err := d.decodeFrame(); err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return 0, err
+			}
+		}
+		for c := 0; c < channels; c++ {
+			buf[f*channels+c] = int32(d.block[c][d.pos] << shift)
+		}
+		d.pos++
+	}
+	ar.remaining -= int64(frames)
+	return frames, nil
+}
+
+var flacBlockSizes = [16]int{0, 192, 576, 1152, 2304, 4608, 0, 0, 256, 512, 1024, 2048, 4096, 8192, 16384, 32768}
+
+var flacSampleSizeBits = [8]int{0, 8, 12, 0, 16, 20, 24, 32}
+
+func (d *flacDecoder) decodeFrame() error {
+	br := &d.br
+	br.align()
+	br.crc8, br.crc16 = 0, 0
+
+	sync, err := br.read(15)
+	if err != nil {
+		return err
+	}
+	if sync != 0xfff8>>1 {
+		return fmt.Errorf("lost FLAC frame sync")
+	}
+	fields, err := br.read(17)
+	if err != nil {
+		return err
+	}
+	blockCode := fields >> 12 & 0x0f
+	rateCode := fields >> 8 & 0x0f
+	assignment := int(fields >> 4 & 0x0f)
+	sizeCode := fields >> 1 & 0x07
+
+	// The frame or sample number is not needed for reading in order.
+	first, err := br.read(8)
+	if err != nil {
+		return err
+	}
+	for extra := bits.LeadingZeros8(^uint8(first)) - 1; extra > 0; extra-- {
+		if _, err := br.read(8); err != nil {
+			return err
+		}
+	}
+
+	n := flacBlockSizes[blockCode]
+	switch blockCode {
+	case 6, 7:
+		v, err := br.read(8 * uint(blockCode-5))
+		if err != nil {
+			return err
+		}
+		n = int(v) + 1
+	}
+	if n == 0 {
+		return fmt.Errorf("invalid FLAC block size")
+	}
+	switch rateCode {
+	case 12:
+		_, err = br.read(8)
+	case 13, 14:
+		_, err = br.read(16)
+	}
+	if err != nil {
+		return err
+	}
+	bps := d.bits
+	if sizeCode != 0 {
+		bps = flacSampleSizeBits[sizeCode]
+	}
+	if bps == 0 || bps != d.bits {
+		return fmt.Errorf("FLAC frame has %d bits per sample, stream %d", bps, d.bits)
+	}
+	crc8 := br.crc8
+	if want, err := br.read(8); err != nil {
+		return err
+	} else if uint8(want) != crc8 {
+		return fmt.Errorf("FLAC frame header CRC mismatch")
+	}
+
+	channels := assignment + 1
+	if assignment >= flacLeftSide && assignment <= flacMidSide {
+		channels = 2
+	} else if assignment > flacMidSide {
+		return fmt.Errorf("invalid FLAC channel assignment %d", assignment)
+	}
+	if channels != d.channels {
+		return fmt.Errorf("FLAC frame has %d channels, stream %d", channels, d.channels)
+	}
+
+	for c := 0; c < channels; c++ {
+		if cap(d.block[c]) < n {
+			d.block[c] = make([]int64, n)
+		}
+		d.block[c] = d.block[c][:n]
+		sideBits := 0
+		if (assignment == flacLeftSide || assignment == flacMidSide) && c == 1 ||
+			assignment == flacRightSide && c == 0 {
+			sideBits = 1
+		}
+		if err := d.decodeSubframe(d.block[c], uint(bps+sideBits)); err != nil {
+			return err
+		}
+	}
+
+	left, right := d.block[0], d.block[min(1, channels-1)]
+	switch assignment {
+	case flacLeftSide:
+		for i := range right {
+			right[i] = left[i] - right[i]
+		}
+	case flacRightSide:
+		for i := range left {
+			left[i] += right[i]
+		}
+	case flacMidSide:
+		for i := range left {
+			mid, side := left[i]<<1|right[i]&1, right[i]
+			left[i], right[i] = (mid+side)>>1, (mid-side)>>1
+		}
+	}
+
+	br.align()
+	crc16 := br.crc16
+	if want, err := br.read(16); err != nil {
+		return err
+	} else if uint16(want) != crc16 {
+		return fmt.Errorf("FLAC frame CRC mismatch")
+	}
+	d.n, d.pos = n, 0
+	return nil
+}
+
+func (d *flacDecoder) decodeSubframe(x []int64, bps uint) error {
+	br := &d.br
+	header, err := br.read(8)
+	if err != nil {
+		return err
+	}
+	kind := int(header >> 1 & 0x3f)
+	var wasted uint
+	if header&1 != 0 {
+		k, err := br.readUnary()
+		if err != nil {
+			return err
+		}
+		wasted = uint(k) + 1
+		if wasted >= bps {
+			return fmt.Errorf("invalid FLAC wasted bits")
+		}
+		bps -= wasted
+	}
+
+	switch {
+	case kind == flacSubframeConstant:
+		v, err := br.readSigned(bps)
+		if err != nil {
+			return err
+		}
+		for i := range x {
+			x[i] = v
+		}
+	case kind == flacSubframeVerbatim:
+		for i := range x {
+			if x[i], err = br.readSigned(bps); err != nil {
+				return err
+			}
+		}
+	case kind >= flacSubframeFixed && kind <= flacSubframeFixed+flacMaxFixedOrder:
+		order := kind - flacSubframeFixed
+		if err := d.decodeWarmUp(x, order, bps); err != nil {
+			return err
+		}
+		if err := d.decodeResidual(x, order); err != nil {
+			return err
+		}
+		restoreFixed(x, order)
+	case kind >= flacSubframeLPC:
+		order := kind - flacSubframeLPC + 1
+		if err := d.decodeWarmUp(x, order, bps); err != nil {
+			return err
+		}
+		precision, err := br.read(4)
+		if err != nil {
+			return err
+		}
+		if precision == 15 {
+			return fmt.Errorf("invalid FLAC LPC precision")
+		}
+		shift, err := br.readSigned(5)
+		if err != nil {
+			return err
+		}
+		if shift < 0 {
+			return fmt.Errorf("negative FLAC LPC shift")
+		}
+		coefficients := make([]int64, order)
+		for i := range coefficients {
+			if coefficients[i], err = br.readSigned(uint(precision) + 1); err != nil {
+				return err
+			}
+		}
+		if err := d.decodeResidual(x, order); err != nil {
+			return err
+		}
+		for i := order; i < len(x); i++ {
+			var p int64
+			for j, c := range coefficients {
+				p += c * x[i-1-j]
+			}
+			x[i] += p >> shift
+		}
+	default:
+		return fmt.Errorf("invalid FLAC subframe type %d", kind)
+	}
+
+	if wasted > 0 {
+		for i := range x {
+			x[i] <<= wasted
+		}
+	}
+	return nil
+}
+
+func (d *flacDecoder) decodeWarmUp(x []int64, order int, bps uint) error {
+	if order > len(x) {
+		return fmt.Errorf("FLAC predictor order %d exceeds block size %d", order, len(x))
+	}
+	for i := 0; i < order; i++ {
+		v, err := d.br.readSigned(bps)
+		if err != nil {
+			return err
+		}
+		x[i] = v
+	}
+	return nil
+}
+
+// decodeResidual reads the Rice-coded residual into x after the warm-up
+// samples.
+func (d *flacDecoder) decodeResidual(x []int64, order int) error {
+	br := &d.br
+	method, err := br.read(2)
+	if err != nil {
+		return err
+	}
+	if method > 1 {
+		return fmt.Errorf("invalid FLAC residual coding %d", method)
+	}
+	paramBits := uint(4 + method)
+	escape := uint64(1)<<paramBits - 1
+	partitionOrder, err := br.read(4)
+	if err != nil {
+		return err
+	}
+	size := len(x) >> partitionOrder
+	if size<<partitionOrder != len(x) || size < order {
+		return fmt.Errorf("invalid FLAC partition order %d", partitionOrder)
+	}
+
+	i := order
+	for p := 0; p < 1<<partitionOrder; p++ {
+		k, err := br.read(paramBits)
+		if err != nil {
+			return err
+		}
+		end := (p + 1) * size
+		if k == escape {
+			raw, err := br.read(5)
+			if err != nil {
+				return err
+			}
+			for ; i < end; i++ {
+				if x[i], err = br.readSigned(uint(raw)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		for ; i < end; i++ {
+			q, err := br.readUnary()
+			if err != nil {
+				return err
+			}
+			low, err := br.read(uint(k))
+			if err != nil {
+				return err
+			}
+			u := q<<k | low
+			x[i] = int64(u>>1) ^ -int64(u&1)
+		}
+	}
+	return nil
+}
+
+// restoreFixed turns the residual after the warm-up samples back into
+// samples with the fixed predictor of the given order.
+func restoreFixed(x []int64, order int) {
+	for i := order; i < len(x); i++ {
+		switch order {
+		case 1:
+			x[i] += x[i-1]
+		case 2:
+			x[i] += 2*x[i-1] - x[i-2]
+		case 3:
+			x[i] += 3*x[i-1] - 3*x[i-2] + x[i-3]
+		case 4:
+			x[i] += 4*x[i-1] - 6*x[i-2] + 4*x[i-3] - x[i-4]
+		}
+	}
+}
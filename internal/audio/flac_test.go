@@ -0,0 +1,117 @@
+package audio
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// flacTestSignal returns frames of interleaved samples at bits, full
+// scale: a sine with noise, a run of silence, and both extremes, so the
+// encoder meets every kind of subframe.
+func flacTestSignal(frames, channels, bits int) []int32 {
+	rng := rand.New(rand.NewPCG(uint64(frames), uint64(bits)))
+	shift := 32 - bits
+	top := int64(1)<<(bits-1) - 1
+	samples := make([]int32, frames*channels)
+	for i := 0; i < frames; i++ {
+		for c := 0; c < channels; c++ {
+			var v int64
+			switch {
+			case i%5000 < 300:
+				v = 0
+			case i%5000 < 310:
+				v = top
+			case i%5000 < 320:
+				v = -top - 1
+			default:
+				v = int64(0.6*float64(top)*math.Sin(float64(i)/(7+float64(c)))) + rng.Int64N(257) - 128
+			}
+			samples[i*channels+c] = int32(v << shift)
+		}
+	}
+	return samples
+}
+
+func TestFLACRoundTrip(t *testing.T) {
+	for _, bits := range []int{16, 24} {
+		for _, channels := range []int{1, 2} {
+			for _, frames := range []int{1, 37, flacBlockSize - 1, flacBlockSize + 1, 3*flacBlockSize + 777} {
+				t.Run(fmt.Sprintf("%dbit_%dch_%d", bits, channels, frames), func(t *testing.T) {
+					testFLACRoundTrip(t, bits, channels, frames)
+				})
+			}
+		}
+	}
+}
+
+func testFLACRoundTrip(t *testing.T, bits, channels, frames int) {
+	samples := flacTestSignal(frames, channels, bits)
+	path := filepath.Join(t.TempDir(), "test.flac")
+	fw, err := newFLACWriter(path, int16(channels), 44100, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Write in chunks that do not line up with the encoder's blocks.
+	for rest := samples; len(rest) > 0; {
+		n := min(len(rest), 1013*channels)
+		if err := fw.WriteFrames(rest[:n]); err != nil {
+			t.Fatal(err)
+		}
+		rest = rest[n:]
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	ar, err := OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ar.Close()
+	if ar.Format != "flac" || int(ar.Channel) != channels || ar.SampleRate != 44100 || ar.NumFrames != int64(frames) {
+		t.Fatalf("read %s, %d channels at %g Hz, %d frames", ar.Format, ar.Channel, ar.SampleRate, ar.NumFrames)
+	}
+	decoded := make([]int32, 0, len(samples))
+	buf := make([]int32, 500*channels)
+	for {
+		n, err := ar.ReadFrames(buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded = append(decoded, buf[:n*channels]...)
+	}
+	if len(decoded) != len(samples) {
+		t.Fatalf("decoded %d samples, wrote %d", len(decoded), len(samples))
+	}
+	for i := range samples {
+		if decoded[i] != samples[i] {
+			t.Fatalf("sample %d decoded as %d, wrote %d", i, decoded[i], samples[i])
+		}
+	}
+
+	// STREAMINFO ends with the MD5 of the samples as little-endian
+	// integers of the bit depth.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := md5.New()
+	for _, v := range samples {
+		for b := 0; b < bits/8; b++ {
+			sum.Write([]byte{byte(v >> (32 - bits + 8*b))})
+		}
+	}
+	if !bytes.Equal(data[4+4+18:4+4+34], sum.Sum(nil)) {
+		t.Error("STREAMINFO MD5 does not match the samples")
+	}
+}
@@ -0,0 +1,103 @@
+package audio
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	DeviceAdded   = "device_added"
+	DeviceRemoved = "device_removed"
+)
+
+// DeviceEvent reports an input device that appeared or disappeared.
+type DeviceEvent struct {
+	Type   string
+	Device AudioDevice
+}
+
+// hotplugLister is implemented by backends whose Devices is too costly
+// or too stale to poll. PortAudio, for one, only rescans devices when
+// it is fully terminated, which never happens while a session records.
+type hotplugLister interface {
+	hotplugDevices() ([]AudioDevice, error)
+}
+
+// WatchDevices polls the capture backend every interval and sends an
+// event for each device that was added or removed since the last poll,
+// until done is closed. Devices are told apart by ID, or by name when
+// the backend has no ID for them.
+func WatchDevices(interval time.Duration, done <-chan struct{}) <-chan DeviceEvent {
+	events := make(chan DeviceEvent, 16)
+
+	go func() {
+		defer close(events)
+
+		known, err := snapshotDevices()
+		if err != nil {
+			log.Printf("Device watcher: %v", err)
+		}
+		failing := err != nil
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			current, err := snapshotDevices()
+			if err != nil {
+				// Keep the last list; a failed poll is not an unplug.
+				if !failing {
+					log.Printf("Device watcher: %v", err)
+				}
+				failing = true
+				continue
+			}
+			failing = false
+
+			for key, device := range current {
+				if _, ok := known[key]; !ok {
+					events <- DeviceEvent{Type: DeviceAdded, Device: device}
+				}
+			}
+			for key, device := range known {
+				if _, ok := current[key]; !ok {
+					events <- DeviceEvent{Type: DeviceRemoved, Device: device}
+				}
+			}
+			known = current
+		}
+	}()
+
+	return events
+}
+
+func snapshotDevices() (map[string]AudioDevice, error) {
+	backend := GetCaptureBackend()
+
+	var devices []AudioDevice
+	var err error
+	if lister, ok := backend.(hotplugLister); ok {
+		devices, err = lister.hotplugDevices()
+	} else {
+		devices, err = backend.Devices()
+	}
+	if err != nil {
+		return nil, err
+	}
+	applyAliases(devicePointers(devices)...)
+
+	snapshot := make(map[string]AudioDevice, len(devices))
+	for _, device := range devices {
+		key := device.ID
+		if key == "" {
+			key = device.Name
+		}
+		snapshot[key] = device
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,120 @@
+package audio
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// scriptedBackend lists the next entry of polls on each call and keeps
+// listing the last one. A nil entry fails the poll.
+type scriptedBackend struct {
+	mu    sync.Mutex
+	polls [][]AudioDevice
+}
+
+func (b *scriptedBackend) next() ([]AudioDevice, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	devices := b.polls[0]
+	if len(b.polls) > 1 {
+		b.polls = b.polls[1:]
+	}
+	if devices == nil {
+		return nil, errors.New("device list unavailable")
+	}
+	return append([]AudioDevice(nil), devices...), nil
+}
+
+func (b *scriptedBackend) Name() string                     { return "scripted" }
+func (b *scriptedBackend) Devices() ([]AudioDevice, error)  { return b.next() }
+func (b *scriptedBackend) Device(int) (*AudioDevice, error) { return nil, errors.New("not supported") }
+func (b *scriptedBackend) Open(CaptureParams) (CaptureStream, error) {
+	return nil, errors.New("not supported")
+}
+
+// hotplugScriptedBackend is polled through hotplugDevices; its Devices
+// list never changes, like PortAudio's.
+type hotplugScriptedBackend struct {
+	scriptedBackend
+	stale []AudioDevice
+}
+
+func (b *hotplugScriptedBackend) Devices() ([]AudioDevice, error)        { return b.stale, nil }
+func (b *hotplugScriptedBackend) hotplugDevices() ([]AudioDevice, error) { return b.next() }
+
+func TestWatchDevices(t *testing.T) {
+	mic := AudioDevice{Index: 0, Name: "USB PnP Sound Device (hw:1,0)", ID: "usb-0c76:161f@1-1.2"}
+	scarlett := AudioDevice{Index: 1, Name: "Scarlett 4i4 USB (hw:2,0)", ID: "usb-1235:8212-Y7ABCD"}
+	// Without an ID a device is known by its name.
+	builtin := AudioDevice{Index: 2, Name: "Built-in Microphone"}
+	polls := [][]AudioDevice{
+		{mic, builtin},
+		{mic, builtin},
+		nil, // a failed poll does not remove anything
+		{mic, scarlett},
+		// Renumbered devices are the same devices.
+		{{Index: 0, Name: scarlett.Name, ID: scarlett.ID}, {Index: 1, Name: "USB PnP Sound Device (hw:3,0)", ID: mic.ID}},
+		{},
+		{builtin},
+	}
+	// The events of each poll that changed something, sorted since they
+	// come in map order.
+	wantPolls := [][]string{
+		{"device_added Scarlett 4i4 USB (hw:2,0)", "device_removed Built-in Microphone"},
+		{"device_removed Scarlett 4i4 USB (hw:2,0)", "device_removed USB PnP Sound Device (hw:3,0)"},
+		{"device_added Built-in Microphone"},
+	}
+	var want []string
+	for _, events := range wantPolls {
+		want = append(want, events...)
+	}
+
+	for _, test := range []struct {
+		name    string
+		backend CaptureBackend
+	}{
+		{"devices", &scriptedBackend{polls: polls}},
+		{"hotplug", &hotplugScriptedBackend{scriptedBackend: scriptedBackend{polls: polls}, stale: polls[0]}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			previous := GetCaptureBackend()
+			SetCaptureBackend(test.backend)
+			defer SetCaptureBackend(previous)
+
+			done := make(chan struct{})
+			events := WatchDevices(time.Millisecond, done)
+			var got []string
+			timeout := time.After(5 * time.Second)
+			for len(got) < len(want) {
+				select {
+				case event := <-events:
+					got = append(got, event.Type+" "+event.Device.Name)
+				case <-timeout:
+					t.Fatalf("got events %q, want %q", got, want)
+				}
+			}
+			// The last list stays, so nothing else may follow.
+			select {
+			case event := <-events:
+				t.Errorf("unexpected %s of %s", event.Type, event.Device.Name)
+			case <-time.After(20 * time.Millisecond):
+			}
+			close(done)
+			for range events {
+			}
+
+			start := 0
+			for _, events := range wantPolls {
+				sort.Strings(got[start : start+len(events)])
+				start += len(events)
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("got events %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package audio
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Device indexes change whenever devices are added or replugged, so
+// devices also get an ID built from what sysfs knows about the hardware:
+//
+//	usb-<vendor>:<product>-<serial>   USB device with a unique serial
+//	usb-<vendor>:<product>@<port>     USB device without one, e.g. @1-1.2
+//	hw:CARD=<card id>,DEV=<n>         anything else ALSA knows
+//
+// A "/<n>" suffix picks PCM device n when a USB card has several.
+
+// sysfs is where device attributes are read; tests point it at a copy.
+var sysfs = "/sys"
+
+var hwNamePattern = regexp.MustCompile(`\(hw:(\d+),(\d+)\)`)
+
+// cardFromDeviceName reads the ALSA card and device from a name such as
+// "USB Condenser Microphone: Audio (hw:2,0)".
+func cardFromDeviceName(name string) (card, device int, ok bool) {
+	m := hwNamePattern.FindStringSubmatch(name)
+	if m == nil {
+		return 0, 0, false
+	}
+	card, _ = strconv.Atoi(m[1])
+	device, _ = strconv.Atoi(m[2])
+	return card, device, true
+}
+
+// stableDeviceID returns the ID of PCM device of an ALSA card, or "" when
+// the card is unknown.
+func stableDeviceID(card, device int) string {
+	if id := usbDeviceID(card); id != "" {
+		if device > 0 {
+			id = fmt.Sprintf("%s/%d", id, device)
+		}
+		return id
+	}
+
+	cardID, err := os.ReadFile(filepath.Join(procASound, fmt.Sprintf("card%d/id", card)))
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("hw:CARD=%s,DEV=%d", strings.TrimSpace(string(cardID)), device)
+}
+
+func usbDeviceID(card int) string {
+	dir, err := filepath.EvalSymlinks(filepath.Join(sysfs, fmt.Sprintf("class/sound/card%d/device", card)))
+	if err != nil {
+		return ""
+	}
+
+	// The card is bound to a USB interface; the device is a parent of it.
+	for ; dir != "/" && dir != "."; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, "idVendor")); err == nil {
+			break
+		}
+	}
+	if dir == "/" || dir == "." {
+		return ""
+	}
+
+	vendor := readSysfs(dir, "idVendor")
+	product := readSysfs(dir, "idProduct")
+	serial := readSysfs(dir, "serial")
+	if serial != "" && usbSerialIsUnique(vendor, product, serial) {
+		return fmt.Sprintf("usb-%s:%s-%s", vendor, product, sanitizeID(serial))
+	}
+	return fmt.Sprintf("usb-%s:%s@%s", vendor, product, filepath.Base(dir))
+}
+
+// usbSerialIsUnique reports whether no other attached device shares the
+// serial. Cheap microphones often ship with the same one, and then only
+// the port tells them apart.
+func usbSerialIsUnique(vendor, product, serial string) bool {
+	dirs, _ := filepath.Glob(filepath.Join(sysfs, "bus/usb/devices/*"))
+	count := 0
+	for _, dir := range dirs {
+		if readSysfs(dir, "idVendor") == vendor && readSysfs(dir, "idProduct") == product && readSysfs(dir, "serial") == serial {
+			count++
+		}
+	}
+	return count <= 1
+}
+
+func readSysfs(dir, name string) string {
+	b, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func sanitizeID(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '/' || r == '@' || r > '~' {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+var deviceAliasFile string
+var deviceAliasMutex sync.RWMutex
+
+// SetDeviceAliasFile sets the JSON file mapping device IDs to friendly
+// names, e.g. {"usb-0c76:161f@1-1.2": "Room 3"}. The file is read on every
+// lookup, so edits apply without a restart. An empty path disables aliases.
+func SetDeviceAliasFile(path string) {
+	deviceAliasMutex.Lock()
+	defer deviceAliasMutex.Unlock()
+	deviceAliasFile = path
+}
+
+func loadDeviceAliases() map[string]string {
+	deviceAliasMutex.RLock()
+	path := deviceAliasFile
+	deviceAliasMutex.RUnlock()
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Failed to read device aliases: %v", err)
+		}
+		return nil
+	}
+
+	aliases := make(map[string]string)
+	if err := json.Unmarshal(data, &aliases); err != nil {
+		log.Printf("Failed to parse device aliases %s: %v", path, err)
+		return nil
+	}
+	return aliases
+}
+
+// applyAliases fills in the Alias of devices listed in the alias file.
+func applyAliases(devices ...*AudioDevice) {
+	aliases := loadDeviceAliases()
+	if len(aliases) == 0 {
+		return
+	}
+	for _, device := range devices {
+		if device.ID != "" {
+			device.Alias = aliases[device.ID]
+		}
+	}
+}
+
+// GetDeviceIndexByID returns the index of the device with the given ID
+// or alias. Unlike GetDeviceIndexByName it only accepts an exact match
+// (ignoring case), and it fails when the match is ambiguous.
+func GetDeviceIndexByID(id string) (int, error) {
+	devices, err := GetCaptureBackend().Devices()
+	if err != nil {
+		return -1, err
+	}
+	applyAliases(devicePointers(devices)...)
+
+	index, err := findDeviceByID(devices, id)
+	if err != nil {
+		return -1, err
+	}
+	if index < 0 {
+		return -1, fmt.Errorf("device with id or alias %q not found", id)
+	}
+	return index, nil
+}
+
+func findDeviceByID(devices []AudioDevice, id string) (int, error) {
+	index := -1
+	for _, device := range devices {
+		if (device.ID != "" && strings.EqualFold(device.ID, id)) ||
+			(device.Alias != "" && strings.EqualFold(device.Alias, id)) {
+			if index >= 0 {
+				return -1, fmt.Errorf("id or alias %q matches more than one device", id)
+			}
+			index = device.Index
+		}
+	}
+	return index, nil
+}
+
+func devicePointers(devices []AudioDevice) []*AudioDevice {
+	ptrs := make([]*AudioDevice, len(devices))
+	for i := range devices {
+		ptrs[i] = &devices[i]
+	}
+	return ptrs
+}
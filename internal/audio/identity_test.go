@@ -0,0 +1,139 @@
+package audio
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindDeviceByID(t *testing.T) {
+	devices := []AudioDevice{
+		{Index: 0, ID: "usb-0c76:161f@1-1.2", Alias: "Room 3"},
+		{Index: 1, ID: "usb-0c76:161f@1-1.3"},
+		{Index: 2, ID: "hw:CARD=Device,DEV=0", Alias: "room 4"},
+		{Index: 3},
+		// Two devices with the same ID.
+		{Index: 4, ID: "usb-1235:8212-Y7ABCD", Alias: "Desk"},
+		{Index: 5, ID: "usb-1235:8212-Y7ABCD"},
+		// An alias naming another device's ID.
+		{Index: 6, ID: "usb-046d:0825-1", Alias: "hw:card=device,dev=0"},
+	}
+	for _, test := range []struct {
+		id        string
+		index     int
+		ambiguous bool
+	}{
+		{"usb-0c76:161f@1-1.3", 1, false},
+		{"USB-0C76:161F@1-1.2", 0, false},
+		{"room 3", 0, false},
+		{"Room 4", 2, false},
+		{"desk", 4, false},
+		{"hw:CARD=Device,DEV=0", -1, true},
+		{"usb-1235:8212-Y7ABCD", -1, true},
+		{"usb-0c76:161f", -1, false},
+		{"", -1, false},
+	} {
+		index, err := findDeviceByID(devices, test.id)
+		if index != test.index || (err != nil) != test.ambiguous {
+			t.Errorf("findDeviceByID(%q) = %d, %v; want %d, ambiguous %v", test.id, index, err, test.index, test.ambiguous)
+		}
+	}
+}
+
+func TestSanitizeID(t *testing.T) {
+	for _, test := range []struct{ in, want string }{
+		{"Y7ABCD1234", "Y7ABCD1234"},
+		{"0001 0002", "0001_0002"},
+		{"a/b@c", "a_b_c"},
+		{"tab\there\n", "tab_here_"},
+		{"séri€", "s_ri_"},
+		{"", ""},
+	} {
+		if got := sanitizeID(test.in); got != test.want {
+			t.Errorf("sanitizeID(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestCardFromDeviceName(t *testing.T) {
+	for _, test := range []struct {
+		name         string
+		card, device int
+		ok           bool
+	}{
+		{"USB Condenser Microphone: Audio (hw:2,0)", 2, 0, true},
+		{"Scarlett 4i4 USB: USB Audio #1 (hw:12,1)", 12, 1, true},
+		{"default", 0, 0, false},
+		{"hw:2,0", 0, 0, false},
+	} {
+		card, device, ok := cardFromDeviceName(test.name)
+		if card != test.card || device != test.device || ok != test.ok {
+			t.Errorf("cardFromDeviceName(%q) = %d, %d, %v", test.name, card, device, ok)
+		}
+	}
+}
+
+func TestStableDeviceID(t *testing.T) {
+	fakeProcASound(t, map[string]string{
+		"card0/id": "vc4hdmi\n",
+		"card1/id": "Device\n",
+		"card2/id": "Device_1\n",
+		"card3/id": "Device_2\n",
+		"card4/id": "Scarlett4i4USB\n",
+	})
+	usb := filepath.Join(sysfs, "devices/platform/soc/usb1")
+	writeTree(t, sysfs, map[string]string{
+		"devices/platform/soc/hdmi/.keep": "",
+		// Two microphones sharing a serial, and one without any.
+		"devices/platform/soc/usb1/1-1.2/idVendor":  "0c76\n",
+		"devices/platform/soc/usb1/1-1.2/idProduct": "161f\n",
+		"devices/platform/soc/usb1/1-1.2/serial":    "0001\n",
+		"devices/platform/soc/usb1/1-1.3/idVendor":  "0c76\n",
+		"devices/platform/soc/usb1/1-1.3/idProduct": "161f\n",
+		"devices/platform/soc/usb1/1-1.3/serial":    "0001\n",
+		"devices/platform/soc/usb1/1-1.4/idVendor":  "0d8c\n",
+		"devices/platform/soc/usb1/1-1.4/idProduct": "0014\n",
+		"devices/platform/soc/usb1/1-1.5/idVendor":  "1235\n",
+		"devices/platform/soc/usb1/1-1.5/idProduct": "8212\n",
+		"devices/platform/soc/usb1/1-1.5/serial":    "Y7 ABCD/1\n",
+	})
+	links := map[string]string{
+		"class/sound/card0/device": "devices/platform/soc/hdmi",
+		"class/sound/card1/device": "devices/platform/soc/usb1/1-1.2/1-1.2:1.0",
+		"class/sound/card2/device": "devices/platform/soc/usb1/1-1.3/1-1.3:1.0",
+		"class/sound/card3/device": "devices/platform/soc/usb1/1-1.4/1-1.4:1.0",
+		"class/sound/card4/device": "devices/platform/soc/usb1/1-1.5/1-1.5:1.0",
+	}
+	for _, port := range []string{"1-1.2", "1-1.3", "1-1.4", "1-1.5"} {
+		links["bus/usb/devices/"+port] = "devices/platform/soc/usb1/" + port
+		if err := os.MkdirAll(filepath.Join(usb, port, port+":1.0"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range links {
+		path := filepath.Join(sysfs, link)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(filepath.Join(sysfs, target), path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		card, device int
+		want         string
+	}{
+		{0, 0, "hw:CARD=vc4hdmi,DEV=0"},
+		{1, 0, "usb-0c76:161f@1-1.2"},
+		{2, 0, "usb-0c76:161f@1-1.3"},
+		{3, 0, "usb-0d8c:0014@1-1.4"},
+		{4, 0, "usb-1235:8212-Y7_ABCD_1"},
+		{4, 1, "usb-1235:8212-Y7_ABCD_1/1"},
+		{5, 0, ""},
+	} {
+		if got := stableDeviceID(test.card, test.device); got != test.want {
+			t.Errorf("stableDeviceID(%d, %d) = %q, want %q", test.card, test.device, got, test.want)
+		}
+	}
+}
@@ -1,10 +1,28 @@
 package audio
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type IAudioFormat interface {
-	Init(recordControlSig *RecondControlSignal, sysPath, filename string, targetChannel int16, sampleRate float64, inputBufSize int)
-	Record()
+	Init(recordControlSig *RecondControlSignal, sysPath, filename string, targetChannel int16, sampleRate float64, inputBufSize int) error
+	Record() error
 	GetFileType() string
 	SetDeviceIndex(deviceIndex int)
+	SetGainControl(agc *AutoGainControl)
+	SetChannelMap(channelMap []int)
+	SetCaptureRate(rate float64)
+	SetRecovery(policy *RecoveryPolicy)
+	SetWriteBuffer(d time.Duration)
+	Stats() CaptureStats
+	SetPaused(paused bool)
+	Pauses() []Pause
+	AddMarker(label string, payload json.RawMessage) Marker
+	Markers() []Marker
+	SetSegmenting(policy *SegmentPolicy)
+	Segments() []Segment
+	SetMetadata(meta *FileMetadata)
 }
 
 const (
@@ -30,6 +48,9 @@ func NewAudioInstance(audioType string) IAudioFormat {
 	case "aiff":
 		return NewAIFFAudioFormat()
 
+	case "wav":
+		return NewWAVAudioFormat()
+
 	default:
 		return NewAIFFAudioFormat()
 	}
@@ -0,0 +1,512 @@
+package audio
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+)
+
+// Loudness measurement follows ITU-R BS.1770-4 (K-weighting, gated
+// integrated loudness, true peak) and EBU Tech 3342 (loudness range).
+
+const (
+	// SilenceLUFS is reported when a recording has no block above the
+	// absolute gate, so the stats always stay representable in JSON.
+	SilenceLUFS = -70.0
+	// SilenceDB is the floor used for peak levels of digital silence.
+	SilenceDB = -150.0
+
+	lufsOffset         = -0.691
+	absoluteGateLUFS   = -70.0
+	integratedRelGate  = -10.0
+	rangeRelGate       = -20.0
+	limiterLookaheadMs = 5.0
+	limiterReleaseMs   = 50.0
+	readChunkFrames    = 4096
+)
+
+// LoudnessStats holds the BS.1770 measurements of a recording.
+type LoudnessStats struct {
+	IntegratedLUFS  float64 `json:"integrated_lufs"`
+	LoudnessRangeLU float64 `json:"loudness_range_lu"`
+	TruePeakDBTP    float64 `json:"true_peak_dbtp"`
+}
+
+// LoudnessReport describes the loudness of a recording before and,
+// when normalization ran, after processing.
+type LoudnessReport struct {
+	Measured   LoudnessStats  `json:"measured"`
+	Normalized bool           `json:"normalized"`
+	TargetLUFS float64        `json:"target_lufs,omitempty"`
+	GainDB     float64        `json:"gain_db,omitempty"`
+	Output     *LoudnessStats `json:"output,omitempty"`
+}
+
+// MeasureLoudness reads an AIFF or WAV file and returns its integrated
+// loudness, loudness range and true peak.
+func MeasureLoudness(path string) (*LoudnessStats, error) {
+	ar, err := OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer ar.Close()
+
+	meter := newLoudnessMeter(int(ar.Channel), ar.SampleRate)
+	buf := make([]int32, readChunkFrames*int(ar.Channel))
+	samples := make([]float64, len(buf))
+
+	for {
+		n, err := ar.ReadFrames(buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < n*int(ar.Channel); i++ {
+			samples[i] = float64(buf[i]) / (1 << 31)
+		}
+		meter.add(samples[:n*int(ar.Channel)])
+	}
+
+	stats := meter.stats()
+	return &stats, nil
+}
+
+// NormalizeLoudness measures inputPath and writes a copy gained to
+// targetLUFS, with a look-ahead true-peak limiter holding the output at or
+// below truePeakDBTP. It returns the path of the normalized file.
+func NormalizeLoudness(inputPath string, targetLUFS, truePeakDBTP float64) (string, *LoudnessReport, error) {
+	measured, err := MeasureLoudness(inputPath)
+	if err != nil {
+		return "", nil, fmt.Errorf("measure loudness: %w", err)
+	}
+
+	report := &LoudnessReport{
+		Measured:   *measured,
+		TargetLUFS: targetLUFS,
+	}
+	if measured.IntegratedLUFS <= SilenceLUFS {
+		// Nothing above the gate, there is no loudness to normalize.
+		return inputPath, report, nil
+	}
+	report.GainDB = targetLUFS - measured.IntegratedLUFS
+
+	ar, err := OpenReader(inputPath)
+	if err != nil {
+		return "", nil, err
+	}
+	defer ar.Close()
+
+	outputPath, out, err := newStepWriter(inputPath, "_normalized", ar)
+	if err != nil {
+		return "", nil, err
+	}
+
+	channels := int(ar.Channel)
+	gain := math.Pow(10, report.GainDB/20)
+	limiter := newPeakLimiter(channels, ar.SampleRate, math.Pow(10, truePeakDBTP/20))
+	meter := newLoudnessMeter(channels, ar.SampleRate)
+
+	buf := make([]int32, readChunkFrames*channels)
+	in := make([]float64, len(buf))
+	var processed []float64
+
+	emit := func(samples []float64) error {
+		meter.add(samples)
+		for i, s := range samples {
+			buf[i] = floatToInt32(s)
+		}
+		return out.WriteFrames(buf[:len(samples)])
+	}
+
+	err = func() error {
+		for {
+			n, err := ar.ReadFrames(buf)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			for i := 0; i < n*channels; i++ {
+				in[i] = float64(buf[i]) / (1 << 31) * gain
+			}
+			processed = limiter.process(in[:n*channels], processed[:0])
+			if err := emit(processed); err != nil {
+				return err
+			}
+		}
+		return emit(limiter.flush(processed[:0]))
+	}()
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(outputPath)
+		return "", nil, err
+	}
+
+	output := meter.stats()
+	report.Normalized = true
+	report.Output = &output
+	return outputPath, report, nil
+}
+
+func floatToInt32(s float64) int32 {
+	v := math.Round(s * (1 << 31))
+	if v > math.MaxInt32 {
+		return math.MaxInt32
+	}
+	if v < math.MinInt32 {
+		return math.MinInt32
+	}
+	return int32(v)
+}
+
+func toDB(amplitude float64) float64 {
+	if amplitude <= 0 {
+		return SilenceDB
+	}
+	return math.Max(20*math.Log10(amplitude), SilenceDB)
+}
+
+// biquad is a direct form II transposed second order section.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.z1
+	f.z1 = f.b1*x - f.a1*y + f.z2
+	f.z2 = f.b2*x - f.a2*y
+	return y
+}
+
+// kWeighting returns the BS.1770 pre-filter (high shelf) and RLB
+// high-pass for the given sample rate. The coefficients are derived
+// from the analog prototypes so rates other than 48 kHz are exact too.
+func kWeighting(sampleRate float64) (biquad, biquad) {
+	f0 := 1681.974450955533
+	g := 3.999843853973347
+	q := 0.7071752369554196
+
+	k := math.Tan(math.Pi * f0 / sampleRate)
+	vh := math.Pow(10, g/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	f0 = 38.13547087602444
+	q = 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / sampleRate)
+	a0 = 1 + k/q + k*k
+	highPass := biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	return shelf, highPass
+}
+
+// loudnessMeter accumulates K-weighted energy in 100 ms steps. Gating
+// blocks (400 ms) and short-term windows (3 s) are built from those
+// steps once the whole recording has been seen.
+type loudnessMeter struct {
+	channels   int
+	shelf      []biquad
+	highPass   []biquad
+	stepFrames int
+	stepCount  int
+	stepSum    float64
+	steps      []float64
+	peak       *truePeakMeter
+}
+
+func newLoudnessMeter(channels int, sampleRate float64) *loudnessMeter {
+	m := &loudnessMeter{
+		channels:   channels,
+		shelf:      make([]biquad, channels),
+		highPass:   make([]biquad, channels),
+		stepFrames: int(math.Round(sampleRate / 10)),
+		peak:       newTruePeakMeter(channels, sampleRate),
+	}
+	for c := 0; c < channels; c++ {
+		m.shelf[c], m.highPass[c] = kWeighting(sampleRate)
+	}
+	return m
+}
+
+// add consumes interleaved samples in the range [-1, 1).
+func (m *loudnessMeter) add(samples []float64) {
+	for i := 0; i+m.channels <= len(samples); i += m.channels {
+		for c := 0; c < m.channels; c++ {
+			x := samples[i+c]
+			m.peak.process(c, x)
+			y := m.highPass[c].process(m.shelf[c].process(x))
+			m.stepSum += y * y
+		}
+		m.stepCount++
+		if m.stepCount == m.stepFrames {
+			m.steps = append(m.steps, m.stepSum/float64(m.stepFrames))
+			m.stepSum = 0
+			m.stepCount = 0
+		}
+	}
+}
+
+func (m *loudnessMeter) stats() LoudnessStats {
+	return LoudnessStats{
+		IntegratedLUFS:  gatedLoudness(m.windows(4, 1), integratedRelGate),
+		LoudnessRangeLU: loudnessRange(m.windows(30, 10)),
+		TruePeakDBTP:    toDB(m.peak.peak),
+	}
+}
+
+// windows returns the mean square energy of every window of size steps,
+// advancing hop steps at a time.
+func (m *loudnessMeter) windows(size, hop int) []float64 {
+	var out []float64
+	for j := 0; j+size <= len(m.steps); j += hop {
+		sum := 0.0
+		for _, e := range m.steps[j : j+size] {
+			sum += e
+		}
+		out = append(out, sum/float64(size))
+	}
+	return out
+}
+
+func energyToLUFS(e float64) float64 {
+	if e <= 0 {
+		return math.Inf(-1)
+	}
+	return lufsOffset + 10*math.Log10(e)
+}
+
+// gateBlocks applies the absolute gate and then a gate relativeGate LU
+// below the loudness of the blocks that passed it.
+func gateBlocks(blocks []float64, relativeGate float64) []float64 {
+	var loud []float64
+	sum := 0.0
+	for _, e := range blocks {
+		if energyToLUFS(e) > absoluteGateLUFS {
+			loud = append(loud, e)
+			sum += e
+		}
+	}
+	if len(loud) == 0 {
+		return nil
+	}
+
+	threshold := energyToLUFS(sum/float64(len(loud))) + relativeGate
+	var gated []float64
+	for _, e := range loud {
+		if energyToLUFS(e) > threshold {
+			gated = append(gated, e)
+		}
+	}
+	return gated
+}
+
+func gatedLoudness(blocks []float64, relativeGate float64) float64 {
+	gated := gateBlocks(blocks, relativeGate)
+	if len(gated) == 0 {
+		return SilenceLUFS
+	}
+	sum := 0.0
+	for _, e := range gated {
+		sum += e
+	}
+	return math.Max(energyToLUFS(sum/float64(len(gated))), SilenceLUFS)
+}
+
+// loudnessRange is the spread between the 10th and 95th percentile of the
+// gated short-term loudness, as defined by EBU Tech 3342.
+func loudnessRange(shortTerm []float64) float64 {
+	gated := gateBlocks(shortTerm, rangeRelGate)
+	if len(gated) == 0 {
+		return 0
+	}
+	sort.Float64s(gated)
+	percentile := func(p float64) float64 {
+		return energyToLUFS(gated[int(math.Round(p*float64(len(gated)-1)))])
+	}
+	return percentile(0.95) - percentile(0.10)
+}
+
+// truePeakMeter estimates inter-sample peaks by oversampling with a
+// windowed-sinc interpolator, as described in BS.1770-4 Annex 2.
+type truePeakMeter struct {
+	phases  [][]float64
+	history [][]float64
+	pos     []int
+	peak    float64
+}
+
+const truePeakTapsPerPhase = 12
+
+func newTruePeakMeter(channels int, sampleRate float64) *truePeakMeter {
+	factor := 4
+	if sampleRate >= 96000 {
+		factor = 2
+	}
+	if sampleRate >= 192000 {
+		factor = 1
+	}
+
+	n := factor * truePeakTapsPerPhase
+	center := float64(n-1) / 2
+	phases := make([][]float64, factor)
+	for p := range phases {
+		phases[p] = make([]float64, truePeakTapsPerPhase)
+	}
+	for i := 0; i < n; i++ {
+		t := (float64(i) - center) / float64(factor)
+		window := 0.5 - 0.5*math.Cos(2*math.Pi*(float64(i)+0.5)/float64(n))
+		phases[i%factor][i/factor] = sinc(t) * window
+	}
+	for _, coeffs := range phases {
+		sum := 0.0
+		for _, k := range coeffs {
+			sum += k
+		}
+		for i := range coeffs {
+			coeffs[i] /= sum
+		}
+	}
+
+	history := make([][]float64, channels)
+	for c := range history {
+		history[c] = make([]float64, truePeakTapsPerPhase)
+	}
+	return &truePeakMeter{
+		phases:  phases,
+		history: history,
+		pos:     make([]int, channels),
+	}
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// process feeds one sample of channel c and returns the largest absolute
+// value among the sample and its interpolated neighbours.
+func (t *truePeakMeter) process(c int, x float64) float64 {
+	h := t.history[c]
+	t.pos[c] = (t.pos[c] + 1) % len(h)
+	h[t.pos[c]] = x
+
+	peak := math.Abs(x)
+	for _, coeffs := range t.phases {
+		y := 0.0
+		idx := t.pos[c]
+		for _, k := range coeffs {
+			y += k * h[idx]
+			idx--
+			if idx < 0 {
+				idx = len(h) - 1
+			}
+		}
+		peak = math.Max(peak, math.Abs(y))
+	}
+	t.peak = math.Max(t.peak, peak)
+	return peak
+}
+
+// peakLimiter is a channel-linked look-ahead limiter driven by the true
+// peak estimate. The signal is delayed by the look-ahead so gain
+// reduction is in place before a peak reaches the output.
+type peakLimiter struct {
+	channels    int
+	ceiling     float64
+	lookahead   int
+	releaseCoef float64
+	detector    *truePeakMeter
+	delay       []float64
+	gains       []float64
+	minIdx      []int
+	frame       int
+	env         float64
+}
+
+func newPeakLimiter(channels int, sampleRate, ceiling float64) *peakLimiter {
+	lookahead := int(sampleRate * limiterLookaheadMs / 1000)
+	return &peakLimiter{
+		channels:    channels,
+		ceiling:     ceiling,
+		lookahead:   lookahead,
+		releaseCoef: math.Exp(-1 / (sampleRate * limiterReleaseMs / 1000)),
+		detector:    newTruePeakMeter(channels, sampleRate),
+		delay:       make([]float64, (lookahead+1)*channels),
+		gains:       make([]float64, lookahead+1),
+		env:         1,
+	}
+}
+
+// process limits interleaved samples and appends the output, which lags
+// the input by the look-ahead, to out.
+func (l *peakLimiter) process(samples []float64, out []float64) []float64 {
+	size := l.lookahead + 1
+	for i := 0; i+l.channels <= len(samples); i += l.channels {
+		peak := 0.0
+		for c := 0; c < l.channels; c++ {
+			peak = math.Max(peak, l.detector.process(c, samples[i+c]))
+		}
+		target := 1.0
+		if peak > l.ceiling {
+			target = l.ceiling / peak
+		}
+
+		// Keep a monotonic queue of frame indexes so the front always
+		// holds the smallest gain within the look-ahead window.
+		slot := l.frame % size
+		l.gains[slot] = target
+		for len(l.minIdx) > 0 && l.gains[l.minIdx[len(l.minIdx)-1]%size] >= target {
+			l.minIdx = l.minIdx[:len(l.minIdx)-1]
+		}
+		l.minIdx = append(l.minIdx, l.frame)
+		for l.minIdx[0] <= l.frame-size {
+			l.minIdx = l.minIdx[1:]
+		}
+		windowMin := l.gains[l.minIdx[0]%size]
+
+		if windowMin < l.env {
+			l.env = windowMin
+		} else {
+			l.env = windowMin - (windowMin-l.env)*l.releaseCoef
+		}
+
+		// The oldest frame in the delay line leaves now, at this gain.
+		outSlot := (l.frame + 1) % size
+		if l.frame >= l.lookahead {
+			for c := 0; c < l.channels; c++ {
+				out = append(out, l.delay[outSlot*l.channels+c]*l.env)
+			}
+		}
+		copy(l.delay[slot*l.channels:], samples[i:i+l.channels])
+		l.frame++
+	}
+	return out
+}
+
+// flush pushes silence through the limiter to drain the delay line.
+func (l *peakLimiter) flush(out []float64) []float64 {
+	return l.process(make([]float64, l.lookahead*l.channels), out)
+}
@@ -0,0 +1,129 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestFile writes seconds of audio to a 32-bit AIFF file in dir;
+// sample returns the value of channel c at frame i in [-1, 1).
+func writeTestFile(t *testing.T, name string, channels int, rate, seconds float64, sample func(i, c int) float64) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name+".aiff")
+	out, err := newPCMFileWriter(path, "aiff", int16(channels), rate, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := int(rate * seconds)
+	buf := make([]int32, 0, readChunkFrames*channels)
+	for i := 0; i < frames; i++ {
+		for c := 0; c < channels; c++ {
+			buf = append(buf, floatToInt32(sample(i, c)))
+		}
+		if len(buf) == cap(buf) || i == frames-1 {
+			if err := out.WriteFrames(buf); err != nil {
+				t.Fatal(err)
+			}
+			buf = buf[:0]
+		}
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestLoudnessReference measures a 1 kHz sine with a peak of -20 dBFS. A
+// mono file is a single channel, so it reads -23.0 LUFS; stereo with the
+// sine in both channels adds their energies and reads -20.0 LUFS.
+func TestLoudnessReference(t *testing.T) {
+	amplitude := math.Pow(10, -20.0/20)
+	for _, test := range []struct {
+		channels int
+		rate     float64
+		lufs     float64
+	}{
+		{1, 48000, -23.0},
+		{2, 48000, -20.0},
+		{1, 44100, -23.0},
+		{2, 44100, -20.0},
+	} {
+		t.Run(fmt.Sprintf("%dch_%g", test.channels, test.rate), func(t *testing.T) {
+			path := writeTestFile(t, "sine", test.channels, test.rate, 10, func(i, c int) float64 {
+				return amplitude * math.Sin(2*math.Pi*1000*float64(i)/test.rate)
+			})
+			stats, err := MeasureLoudness(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(stats.IntegratedLUFS-test.lufs) > 0.1 {
+				t.Errorf("integrated %.2f LUFS, want %.1f", stats.IntegratedLUFS, test.lufs)
+			}
+			if stats.LoudnessRangeLU > 0.1 {
+				t.Errorf("loudness range %.2f LU for a steady tone", stats.LoudnessRangeLU)
+			}
+			if math.Abs(stats.TruePeakDBTP+20) > 0.1 {
+				t.Errorf("true peak %.2f dBTP, want -20.0", stats.TruePeakDBTP)
+			}
+		})
+	}
+}
+
+// TestTruePeak measures a full-scale sine at a quarter of the sample
+// rate whose samples all fall halfway between its peaks, so the sample
+// peak is 3 dB below the true peak.
+func TestTruePeak(t *testing.T) {
+	path := writeTestFile(t, "intersample", 1, 48000, 1, func(i, c int) float64 {
+		return 0.5 * math.Sin(math.Pi/2*float64(i)+math.Pi/4)
+	})
+	stats, err := MeasureLoudness(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := toDB(0.5); math.Abs(stats.TruePeakDBTP-want) > 0.2 {
+		t.Errorf("true peak %.2f dBTP, want %.2f", stats.TruePeakDBTP, want)
+	}
+}
+
+// TestLimiterCeiling normalizes a quiet tone with loud inter-sample
+// peaks, which the gain alone would push above full scale.
+func TestLimiterCeiling(t *testing.T) {
+	const (
+		rate    = 48000.0
+		target  = -10.0
+		ceiling = -1.0
+	)
+	path := writeTestFile(t, "bursts", 2, rate, 10, func(i, c int) float64 {
+		if i%int(5*rate) < 240 {
+			// 5 ms bursts with a true peak of -6 dBTP every 5 seconds.
+			return 0.5 * math.Sin(math.Pi/2*float64(i)+math.Pi/4)
+		}
+		return 0.1 * math.Sin(2*math.Pi*440*float64(i)/rate)
+	})
+
+	outputPath, report, err := NormalizeLoudness(path, target, ceiling)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.GainDB < 8 {
+		t.Fatalf("gain %.1f dB, the bursts would not clip", report.GainDB)
+	}
+	output, err := MeasureLoudness(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output.TruePeakDBTP > ceiling+0.1 {
+		t.Errorf("output true peak %.2f dBTP above the %.1f dBTP ceiling", output.TruePeakDBTP, ceiling)
+	}
+	if output.TruePeakDBTP < ceiling-1 {
+		t.Errorf("output true peak %.2f dBTP, the bursts were limited too far", output.TruePeakDBTP)
+	}
+	if math.Abs(output.IntegratedLUFS-target) > 0.5 {
+		t.Errorf("output %.2f LUFS, want %.1f", output.IntegratedLUFS, target)
+	}
+	if math.Abs(report.Output.TruePeakDBTP-output.TruePeakDBTP) > 0.01 {
+		t.Errorf("report says %.2f dBTP, file measures %.2f", report.Output.TruePeakDBTP, output.TruePeakDBTP)
+	}
+}
@@ -0,0 +1,123 @@
+package audio
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"sync"
+	"time"
+)
+
+// Marker flags a moment in a recording, e.g. "client consent given".
+type Marker struct {
+	// ID numbers the markers of a recording from 1; it is the marker ID
+	// in the file's MARK chunk.
+	ID int `json:"id"`
+	// Frame is the position in the file at the time the marker was
+	// added.
+	Frame   int64           `json:"frame"`
+	Time    time.Time       `json:"time"`
+	Label   string          `json:"label"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// PauseMarkerLabel labels the marker added where a recording was paused.
+const PauseMarkerLabel = "pause"
+
+// ReconnectMarkerLabel labels the marker added where a recording lost its
+// device and went on after a reconnect.
+const ReconnectMarkerLabel = "reconnect"
+
+type markerLog struct {
+	mu      sync.Mutex
+	markers []Marker
+}
+
+func (l *markerLog) add(frame int64, label string, payload json.RawMessage) Marker {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	marker := Marker{
+		ID:      len(l.markers) + 1,
+		Frame:   frame,
+		Time:    time.Now(),
+		Label:   label,
+		Payload: payload,
+	}
+	l.markers = append(l.markers, marker)
+	return marker
+}
+
+func (l *markerLog) snapshot() []Marker {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Marker(nil), l.markers...)
+}
+
+// AddMarker marks the current position of the recording. The position is
+// the number of frames captured when the call is made, so it is accurate
+// to one device buffer.
+func (af *AIFFAudioFormat) AddMarker(label string, payload json.RawMessage) Marker {
+	return af.markers.add(af.counter.snapshot().Frames, label, payload)
+}
+
+// Markers lists the markers added so far. It may be called while
+// recording.
+func (af *AIFFAudioFormat) Markers() []Marker {
+	return af.markers.snapshot()
+}
+
+// WriteAIFFMarkers appends a MARK chunk with markers to an AIFF file that
+// has none. The chunk holds each marker's ID, frame and label (cut to 255
+// bytes); payloads only go into the manifest. Markers past the end of the
+// file, and those whose ID or frame does not fit the chunk, are left out.
+func WriteAIFFMarkers(path string, markers []Marker) error {
+	ar, err := OpenReader(path)
+	if err != nil {
+		return err
+	}
+	numFrames := ar.NumFrames
+	ar.Close()
+
+	chunk := markChunk(markers, numFrames)
+	if chunk == nil {
+		return nil
+	}
+	return aiffLayout.append(path, chunk)
+}
+
+// WriteFileMarkers adds markers to an AIFF or WAV file, told apart by its
+// extension, like WriteAIFFMarkers or WriteWAVMarkers.
+func WriteFileMarkers(path string, markers []Marker) error {
+	return formatOf(path).writeMarkers(path, markers)
+}
+
+func markChunk(markers []Marker, numFrames int64) []byte {
+	var body []byte
+	count := 0
+	for _, m := range markers {
+		if m.ID < 1 || m.ID > math.MaxInt16 || m.Frame < 0 || m.Frame > numFrames || m.Frame > math.MaxUint32 {
+			continue
+		}
+		name := m.Label
+		if len(name) > 255 {
+			name = name[:255]
+		}
+		body = binary.BigEndian.AppendUint16(body, uint16(m.ID))
+		body = binary.BigEndian.AppendUint32(body, uint32(m.Frame))
+		// A pstring: count byte, text, padded to an even length.
+		body = append(body, byte(len(name)))
+		body = append(body, name...)
+		if len(name)%2 == 0 {
+			body = append(body, 0)
+		}
+		count++
+	}
+	if count == 0 {
+		return nil
+	}
+
+	chunk := []byte("MARK")
+	chunk = binary.BigEndian.AppendUint32(chunk, uint32(2+len(body)))
+	chunk = binary.BigEndian.AppendUint16(chunk, uint16(count))
+	return append(chunk, body...)
+}
@@ -0,0 +1,177 @@
+package audio
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// FileMetadata says where a recording comes from. It is written into the
+// file itself, so a file that got separated from its upload can still be
+// traced to its Pi, device and session.
+type FileMetadata struct {
+	SessionID   string    `json:"session_id"`
+	PiID        string    `json:"pi_id,omitempty"`
+	DeviceIndex int       `json:"device_index"`
+	DeviceName  string    `json:"device_name,omitempty"`
+	DeviceID    string    `json:"device_id,omitempty"`
+	DeviceAlias string    `json:"device_alias,omitempty"`
+	StartTime   time.Time `json:"start_time"`
+	// ChannelLabels names the channels in file order.
+	ChannelLabels []string `json:"channel_labels,omitempty"`
+	// Software names the recorder and its version.
+	Software string `json:"software,omitempty"`
+	// Segment is the index of the file in a segmented recording.
+	Segment int `json:"segment,omitempty"`
+}
+
+// AIFFMetadata is the descriptive data found in an AIFF file.
+type AIFFMetadata struct {
+	// Name, Author, Annotation and Copyright are the text of the NAME,
+	// AUTH, ANNO and "(c) " chunks.
+	Name       string `json:"name,omitempty"`
+	Author     string `json:"author,omitempty"`
+	Annotation string `json:"annotation,omitempty"`
+	Copyright  string `json:"copyright,omitempty"`
+	// Recording is the APPL chunk written by this recorder, nil when the
+	// file has none.
+	Recording *FileMetadata `json:"recording,omitempty"`
+	// Markers are read from the MARK chunk; only ID, Frame and Label
+	// are stored there.
+	Markers []Marker `json:"markers,omitempty"`
+}
+
+// annotation describes meta in one line of text.
+func (meta FileMetadata) annotation() string {
+	device := meta.DeviceName
+	if meta.DeviceAlias != "" {
+		device = fmt.Sprintf("%s (%s)", meta.DeviceAlias, meta.DeviceName)
+	}
+	annotation := fmt.Sprintf("Session %s recorded from %s on Pi %s, started %s",
+		meta.SessionID, device, meta.PiID, meta.StartTime.Format(time.RFC3339))
+	if meta.Segment > 0 {
+		annotation += fmt.Sprintf(", segment %d", meta.Segment)
+	}
+	if meta.Software != "" {
+		annotation += ", by " + meta.Software
+	}
+	return annotation
+}
+
+// aiffApplicationSignature tags the APPL chunk that holds FileMetadata.
+const aiffApplicationSignature = "AIHR"
+
+// SetMetadata sets the metadata written into each file of the recording.
+func (af *AIFFAudioFormat) SetMetadata(meta *FileMetadata) {
+	af.Metadata = meta
+}
+
+// WriteAIFFMetadata appends NAME, AUTH and ANNO chunks describing meta to
+// an AIFF file, followed by an APPL chunk holding meta as JSON. It fails
+// if the file already has one of these chunks.
+func WriteAIFFMetadata(path string, meta FileMetadata) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	return aiffLayout.append(path,
+		aiffLayout.chunk("NAME", []byte(meta.SessionID)),
+		aiffLayout.chunk("AUTH", []byte("Pi "+meta.PiID)),
+		aiffLayout.chunk("ANNO", []byte(meta.annotation())),
+		aiffLayout.chunk("APPL", append([]byte(aiffApplicationSignature), data...)),
+	)
+}
+
+// WriteFileMetadata writes meta into an AIFF or WAV file, told apart by
+// its extension, like WriteAIFFMetadata or WriteWAVMetadata.
+func WriteFileMetadata(path string, meta FileMetadata) error {
+	return formatOf(path).writeMetadata(path, meta)
+}
+
+// ReadAIFFMetadata reads the text chunks, the recorder's APPL chunk and
+// the markers of an AIFF file. Chunks it does not know are skipped.
+func ReadAIFFMetadata(path string) (*AIFFMetadata, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &AIFFMetadata{}
+	_, err = aiffLayout.walk(file, func(id string, offset, size int64) error {
+		switch id {
+		case "NAME", "AUTH", "ANNO", "(c) ", "APPL", "MARK":
+		default:
+			return nil
+		}
+		if offset+size > info.Size() {
+			return fmt.Errorf("%s chunk of %d bytes runs past the end of the file", id, size)
+		}
+		body := make([]byte, size)
+		if _, err := file.ReadAt(body, offset); err != nil {
+			return fmt.Errorf("read %s chunk: %w", id, err)
+		}
+
+		switch id {
+		case "NAME":
+			meta.Name = string(body)
+		case "AUTH":
+			meta.Author = string(body)
+		case "ANNO":
+			meta.Annotation = string(body)
+		case "(c) ":
+			meta.Copyright = string(body)
+		case "APPL":
+			if len(body) < 4 || string(body[:4]) != aiffApplicationSignature {
+				return nil
+			}
+			var recording FileMetadata
+			if err := json.Unmarshal(body[4:], &recording); err != nil {
+				return fmt.Errorf("parse APPL chunk: %w", err)
+			}
+			meta.Recording = &recording
+		case "MARK":
+			markers, err := parseMarkChunk(body)
+			if err != nil {
+				return err
+			}
+			meta.Markers = markers
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return meta, nil
+}
+
+func parseMarkChunk(body []byte) ([]Marker, error) {
+	if len(body) < 2 {
+		return nil, fmt.Errorf("short MARK chunk")
+	}
+	count := int(binary.BigEndian.Uint16(body))
+	body = body[2:]
+
+	markers := make([]Marker, 0, count)
+	for i := 0; i < count; i++ {
+		if len(body) < 7 || len(body) < 7+int(body[6]) {
+			return nil, fmt.Errorf("short MARK chunk")
+		}
+		n := int(body[6])
+		markers = append(markers, Marker{
+			ID:    int(int16(binary.BigEndian.Uint16(body))),
+			Frame: int64(binary.BigEndian.Uint32(body[2:])),
+			Label: string(body[7 : 7+n]),
+		})
+		// The pstring is padded to an even length.
+		body = body[min(len(body), 7+n+(n+1)%2):]
+	}
+	return markers, nil
+}
@@ -0,0 +1,137 @@
+package audio
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAIFFMetadataRoundTrip(t *testing.T) {
+	start := time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC)
+	for _, test := range []struct {
+		name       string
+		meta       FileMetadata
+		author     string
+		annotation string
+	}{
+		{
+			name: "full",
+			meta: FileMetadata{
+				SessionID:     "session-42",
+				PiID:          "pi07",
+				DeviceIndex:   2,
+				DeviceName:    "hw:1,0",
+				DeviceID:      "usb-0d8c_0014",
+				StartTime:     start,
+				ChannelLabels: []string{"client", "practitioner"},
+				Software:      "aihub-recorder 1.4",
+			},
+			author:     "Pi pi07",
+			annotation: "Session session-42 recorded from hw:1,0 on Pi pi07, started 2026-10-19T09:30:00Z, by aihub-recorder 1.4",
+		},
+		{
+			name: "alias and segment",
+			meta: FileMetadata{
+				SessionID:   "session-42",
+				PiID:        "pi07",
+				DeviceName:  "hw:1,0",
+				DeviceAlias: "Room 4",
+				StartTime:   start,
+				Segment:     3,
+			},
+			author:     "Pi pi07",
+			annotation: "Session session-42 recorded from Room 4 (hw:1,0) on Pi pi07, started 2026-10-19T09:30:00Z, segment 3",
+		},
+		{
+			// Odd-length text chunks are padded; the reader must not
+			// take the pad byte into the text or lose its place.
+			name:       "odd lengths",
+			meta:       FileMetadata{SessionID: "abc", PiID: "p", StartTime: start},
+			author:     "Pi p",
+			annotation: "Session abc recorded from  on Pi p, started 2026-10-19T09:30:00Z",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeTestFile(t, "take", 2, 8000, 0.5, func(i, c int) float64 { return 0 })
+			markers := []Marker{{ID: 1, Frame: 1000, Label: "question"}, {ID: 2, Frame: 3999, Label: "end"}}
+			if err := WriteAIFFMarkers(path, markers); err != nil {
+				t.Fatal(err)
+			}
+			if err := WriteAIFFMetadata(path, test.meta); err != nil {
+				t.Fatal(err)
+			}
+			if err := WriteAIFFMetadata(path, test.meta); err == nil {
+				t.Error("second WriteAIFFMetadata succeeded")
+			}
+
+			got, err := ReadAIFFMetadata(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, field := range []struct{ name, got, want string }{
+				{"NAME", got.Name, test.meta.SessionID},
+				{"AUTH", got.Author, test.author},
+				{"ANNO", got.Annotation, test.annotation},
+				{"(c) ", got.Copyright, ""},
+			} {
+				if field.got != field.want {
+					t.Errorf("%s = %q, want %q", field.name, field.got, field.want)
+				}
+			}
+			if got.Recording == nil {
+				t.Fatal("no APPL chunk")
+			}
+			if !got.Recording.StartTime.Equal(test.meta.StartTime) {
+				t.Errorf("APPL start time %v, want %v", got.Recording.StartTime, test.meta.StartTime)
+			}
+			recording := *got.Recording
+			recording.StartTime = test.meta.StartTime
+			if !reflect.DeepEqual(recording, test.meta) {
+				t.Errorf("APPL = %+v, want %+v", recording, test.meta)
+			}
+			if !reflect.DeepEqual(got.Markers, markers) {
+				t.Errorf("markers %+v, want %+v", got.Markers, markers)
+			}
+
+			ar, err := OpenReader(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ar.Close()
+			if ar.NumFrames != 4000 {
+				t.Errorf("%d frames after adding chunks, want 4000", ar.NumFrames)
+			}
+		})
+	}
+}
+
+// TestAIFFMetadataRecorded checks the chunks the recorder writes into a
+// file once it is complete.
+func TestAIFFMetadataRecorded(t *testing.T) {
+	meta := testMetadata()
+	af, path := newTestRecorder(t, false, func(af *AIFFAudioFormat) { af.SetMetadata(meta) })
+	stop := startRecording(af)
+	waitFrames(t, af, 4800)
+	marker := af.AddMarker("question", nil)
+	waitFrames(t, af, 9600)
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadAIFFMetadata(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != meta.SessionID || got.Author != "Pi "+meta.PiID {
+		t.Errorf("NAME %q, AUTH %q; want %q and %q", got.Name, got.Author, meta.SessionID, "Pi "+meta.PiID)
+	}
+	if got.Recording == nil || got.Recording.SessionID != meta.SessionID || !reflect.DeepEqual(got.Recording.ChannelLabels, meta.ChannelLabels) {
+		t.Errorf("APPL = %+v, want %+v", got.Recording, meta)
+	}
+	if len(got.Markers) != 1 || got.Markers[0].ID != marker.ID || got.Markers[0].Frame != marker.Frame || got.Markers[0].Label != "question" {
+		t.Errorf("markers %+v, want %+v", got.Markers, marker)
+	}
+	if info, err := Verify(path); err != nil || len(info.Problems) > 0 {
+		t.Errorf("Verify: %v %v", err, info.Problems)
+	}
+}
@@ -0,0 +1,91 @@
+package audio
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Pause is one interval in which a recording was paused. Nothing is
+// written while paused, so in the file the audio before and after the
+// pause meets at Frame.
+type Pause struct {
+	Frame    int64     `json:"frame"`
+	PausedAt time.Time `json:"paused_at"`
+	// ResumedAt is nil while still paused, and when the recording was
+	// stopped without resuming.
+	ResumedAt *time.Time `json:"resumed_at,omitempty"`
+	Seconds   float64    `json:"seconds"`
+}
+
+type pauseLog struct {
+	mu     sync.Mutex
+	pauses []Pause
+	open   bool
+}
+
+func (l *pauseLog) begin(frame int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pauses = append(l.pauses, Pause{Frame: frame, PausedAt: time.Now()})
+	l.open = true
+}
+
+// end closes the current pause; resumed tells whether recording goes on
+// after it.
+func (l *pauseLog) end(resumed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.open {
+		return
+	}
+	now := time.Now()
+	last := &l.pauses[len(l.pauses)-1]
+	last.Seconds = now.Sub(last.PausedAt).Seconds()
+	if resumed {
+		last.ResumedAt = &now
+	}
+	l.open = false
+}
+
+func (l *pauseLog) snapshot() []Pause {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	pauses := append([]Pause(nil), l.pauses...)
+	if l.open {
+		last := &pauses[len(pauses)-1]
+		last.Seconds = time.Since(last.PausedAt).Seconds()
+	}
+	return pauses
+}
+
+// SetPaused pauses or resumes writing. The stream stays open while
+// paused, so resuming does not wait for the device.
+func (af *AIFFAudioFormat) SetPaused(paused bool) {
+	af.pauseRequest.Store(paused)
+}
+
+// Pauses lists the pauses so far. It may be called while recording.
+func (af *AIFFAudioFormat) Pauses() []Pause {
+	return af.pauses.snapshot()
+}
+
+// updatePause applies a pause or resume request. It runs on the capture
+// loop between reads, so Frame is exact.
+func (af *AIFFAudioFormat) updatePause() {
+	paused := af.pauseRequest.Load()
+	if paused == af.paused {
+		return
+	}
+	af.paused = paused
+	if paused {
+		af.flushResampler()
+		frame := af.counter.snapshot().Frames
+		af.pauses.begin(frame)
+		af.markers.add(frame, PauseMarkerLabel, nil)
+		log.Printf("⏸️ Recording paused")
+	} else {
+		af.pauses.end(true)
+		log.Printf("▶️ Recording resumed")
+	}
+}
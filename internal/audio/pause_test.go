@@ -0,0 +1,103 @@
+package audio
+
+import (
+	"testing"
+	"time"
+)
+
+// waitPauses waits until af has logged n pauses.
+func waitPauses(t *testing.T, af *AIFFAudioFormat, n int) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for len(af.Pauses()) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d pauses logged, waiting for %d", len(af.Pauses()), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPauseFrames(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		// pauses is how many times recording is paused and resumed.
+		pauses int
+		// stopPaused stops the recording while it is paused.
+		stopPaused bool
+		// repeat sends every pause and resume request twice.
+		repeat bool
+	}{
+		{name: "once", pauses: 1},
+		{name: "three times", pauses: 3},
+		{name: "stopped while paused", pauses: 1, stopPaused: true},
+		{name: "repeated requests", pauses: 2, repeat: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			af, path := newTestRecorder(t, false, nil)
+			stop := startRecording(af)
+
+			var frames []int64
+			for i := 0; i < test.pauses; i++ {
+				waitFrames(t, af, af.Stats().Frames+4800)
+				af.SetPaused(true)
+				if test.repeat {
+					af.SetPaused(true)
+				}
+				waitPauses(t, af, i+1)
+				frame := af.Stats().Frames
+				frames = append(frames, frame)
+
+				// The device is still read, but nothing is counted.
+				time.Sleep(20 * time.Millisecond)
+				if now := af.Stats().Frames; now != frame {
+					t.Errorf("frames went from %d to %d while paused", frame, now)
+				}
+				if test.stopPaused && i == test.pauses-1 {
+					break
+				}
+				af.SetPaused(false)
+				if test.repeat {
+					af.SetPaused(false)
+				}
+			}
+			if !test.stopPaused {
+				waitFrames(t, af, af.Stats().Frames+4800)
+			}
+			if err := stop(); err != nil {
+				t.Fatal(err)
+			}
+
+			pauses := af.Pauses()
+			if len(pauses) != test.pauses {
+				t.Fatalf("logged %d pauses, want %d", len(pauses), test.pauses)
+			}
+			markers := af.Markers()
+			if len(markers) != test.pauses {
+				t.Fatalf("added %d markers, want %d", len(markers), test.pauses)
+			}
+			for i, pause := range pauses {
+				if pause.Frame != frames[i] || markers[i].Frame != frames[i] || markers[i].Label != PauseMarkerLabel {
+					t.Errorf("pause %d at frame %d with marker %+v, paused at frame %d", i, pause.Frame, markers[i], frames[i])
+				}
+				if pause.Seconds < 0.02 {
+					t.Errorf("pause %d lasted %.3f s", i, pause.Seconds)
+				}
+				resumed := !test.stopPaused || i < len(pauses)-1
+				if (pause.ResumedAt != nil) != resumed {
+					t.Errorf("pause %d resumed at %v, want resumed %v", i, pause.ResumedAt, resumed)
+				}
+			}
+
+			info, err := Verify(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Frames != af.Stats().Frames {
+				t.Errorf("file holds %d frames, counted %d", info.Frames, af.Stats().Frames)
+			}
+			if test.stopPaused && info.Frames != frames[len(frames)-1] {
+				t.Errorf("file holds %d frames, paused at %d", info.Frames, frames[len(frames)-1])
+			}
+		})
+	}
+}
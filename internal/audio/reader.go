@@ -0,0 +1,267 @@
+package audio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// Reader streams sample frames out of an AIFF, WAV or FLAC file. Samples
+// are returned as int32 scaled to full range regardless of the bit depth
+// stored in the file, so 16- and 24-bit files read the same way as our
+// own 32-bit recordings.
+//
+// A file whose header sizes were never filled in, because the recorder
+// did not get to finalize it, reads up to its end.
+type Reader struct {
+	file *os.File
+	r    *bufio.Reader
+	// Format is "aiff", "wav" or "flac".
+	Format        string
+	Channel       int16
+	BitsPerSample int16
+	SampleRate    float64
+	NumFrames     int64
+	remaining     int64
+	raw           []byte
+	littleEndian  bool
+	// unsigned is set for 8-bit WAV, which stores samples offset by 128.
+	unsigned bool
+	flac     *flacDecoder
+}
+
+// OpenReader opens an AIFF, WAV or FLAC file and positions it at the
+// first frame.
+func OpenReader(path string) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ar := &Reader{file: file}
+	if err := ar.readHeader(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return ar, nil
+}
+
+func (ar *Reader) readHeader() error {
+	info, err := ar.file.Stat()
+	if err != nil {
+		return err
+	}
+	var form [12]byte
+	if _, err := io.ReadFull(ar.file, form[:]); err != nil {
+		return fmt.Errorf("read file header: %w", err)
+	}
+
+	var layout chunkLayout
+	switch {
+	case string(form[0:4]) == "FORM" && string(form[8:12]) == "AIFF":
+		layout, ar.Format = aiffLayout, "aiff"
+	case string(form[0:4]) == "RIFF" && string(form[8:12]) == "WAVE":
+		layout, ar.Format, ar.littleEndian = wavLayout, "wav", true
+	case string(form[0:4]) == "fLaC":
+		ar.Format = "flac"
+		if _, err := ar.file.Seek(4, io.SeekStart); err != nil {
+			return err
+		}
+		return ar.readFLACHeader()
+	default:
+		return fmt.Errorf("not an AIFF, WAV or FLAC file")
+	}
+	finalized := layout.order.Uint32(form[4:8]) != 0
+
+	haveFormat := false
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(ar.file, chunk[:]); err != nil {
+			return fmt.Errorf("sample data not found: %w", err)
+		}
+		id := string(chunk[0:4])
+		size := int64(layout.order.Uint32(chunk[4:8]))
+
+		var dataSize int64 = -1
+		switch id {
+		case "COMM", "fmt ":
+			offset, err := ar.file.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return err
+			}
+			if size > info.Size()-offset {
+				return fmt.Errorf("%s chunk of %d bytes runs past the end of the file", id, size)
+			}
+			body := make([]byte, size)
+			if _, err := io.ReadFull(ar.file, body); err != nil {
+				return fmt.Errorf("read %s chunk: %w", id, err)
+			}
+			if id == "COMM" {
+				err = ar.parseCOMM(body)
+			} else {
+				err = ar.parseFmt(body)
+			}
+			if err != nil {
+				return err
+			}
+			if _, err := ar.file.Seek(size%2, io.SeekCurrent); err != nil {
+				return err
+			}
+			haveFormat = true
+			continue
+
+		case "SSND":
+			var offset [8]byte
+			if _, err := io.ReadFull(ar.file, offset[:]); err != nil {
+				return fmt.Errorf("read SSND chunk: %w", err)
+			}
+			skip := int64(binary.BigEndian.Uint32(offset[0:4]))
+			if _, err := ar.file.Seek(skip, io.SeekCurrent); err != nil {
+				return err
+			}
+			dataSize = size - 8 - skip
+
+		case "data":
+			dataSize = size
+
+		default:
+			if _, err := ar.file.Seek(size+size%2, io.SeekCurrent); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !haveFormat {
+			return fmt.Errorf("%s chunk before the format chunk", id)
+		}
+		start, err := ar.file.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		if available := info.Size() - start; !finalized || dataSize < 0 || dataSize > available {
+			dataSize = available
+		}
+		ar.NumFrames = dataSize / ar.frameBytes()
+		ar.remaining = ar.NumFrames
+		ar.r = bufio.NewReaderSize(ar.file, 64*1024)
+		return nil
+	}
+}
+
+func (ar *Reader) parseCOMM(body []byte) error {
+	if len(body) < 18 {
+		return fmt.Errorf("short COMM chunk")
+	}
+	ar.Channel = int16(binary.BigEndian.Uint16(body[0:2]))
+	ar.BitsPerSample = int16(binary.BigEndian.Uint16(body[6:8]))
+	ar.SampleRate = extendedToFloat(body[8:18])
+	return ar.checkFormat()
+}
+
+// wavFormatPCM and wavFormatExtensible are the fmt chunk format tags the
+// reader understands; an extensible file must have the PCM sub-format.
+const (
+	wavFormatPCM        = 1
+	wavFormatExtensible = 0xfffe
+)
+
+func (ar *Reader) parseFmt(body []byte) error {
+	if len(body) < 16 {
+		return fmt.Errorf("short fmt chunk")
+	}
+	tag := binary.LittleEndian.Uint16(body[0:2])
+	if tag == wavFormatExtensible && (len(body) < 40 || !bytes.Equal(body[24:40], wavPCMSubFormat)) {
+		return fmt.Errorf("unsupported WAV sub-format")
+	}
+	if tag != wavFormatPCM && tag != wavFormatExtensible {
+		return fmt.Errorf("unsupported WAV format %#x", tag)
+	}
+	ar.Channel = int16(binary.LittleEndian.Uint16(body[2:4]))
+	ar.SampleRate = float64(binary.LittleEndian.Uint32(body[4:8]))
+	ar.BitsPerSample = int16(binary.LittleEndian.Uint16(body[14:16]))
+	ar.unsigned = ar.BitsPerSample <= 8
+	return ar.checkFormat()
+}
+
+func (ar *Reader) checkFormat() error {
+	if ar.Channel <= 0 || ar.BitsPerSample <= 0 || ar.BitsPerSample > 32 || !(ar.SampleRate > 0) {
+		return fmt.Errorf("unsupported format: %d channels, %d bits, %g Hz", ar.Channel, ar.BitsPerSample, ar.SampleRate)
+	}
+	return nil
+}
+
+func (ar *Reader) frameBytes() int64 {
+	return int64(ar.Channel) * int64((ar.BitsPerSample+7)/8)
+}
+
+// ReadFrames fills buf with interleaved samples and returns the number of
+// whole frames read. It returns io.EOF once all frames have been read.
+func (ar *Reader) ReadFrames(buf []int32) (int, error) {
+	if ar.remaining <= 0 {
+		return 0, io.EOF
+	}
+
+	channels := int(ar.Channel)
+	bytesPerSample := int((ar.BitsPerSample + 7) / 8)
+	frames := len(buf) / channels
+	if int64(frames) > ar.remaining {
+		frames = int(ar.remaining)
+	}
+	if ar.flac != nil {
+		return ar.readFLACFrames(buf, frames)
+	}
+
+	need := frames * channels * bytesPerSample
+	if cap(ar.raw) < need {
+		ar.raw = make([]byte, need)
+	}
+	raw := ar.raw[:need]
+	if _, err := io.ReadFull(ar.r, raw); err != nil {
+		return 0, err
+	}
+
+	shift := uint(32 - 8*bytesPerSample)
+	for i := 0; i < frames*channels; i++ {
+		sample := raw[i*bytesPerSample : (i+1)*bytesPerSample]
+		var v uint32
+		for b := range sample {
+			if ar.littleEndian {
+				v = v<<8 | uint32(sample[bytesPerSample-1-b])
+			} else {
+				v = v<<8 | uint32(sample[b])
+			}
+		}
+		v <<= shift
+		if ar.unsigned {
+			v ^= 0x80000000
+		}
+		buf[i] = int32(v)
+	}
+
+	ar.remaining -= int64(frames)
+	return frames, nil
+}
+
+func (ar *Reader) Close() error {
+	return ar.file.Close()
+}
+
+// extendedToFloat decodes an IEEE 754 80-bit extended float as stored in
+// the AIFF COMM chunk.
+func extendedToFloat(b []byte) float64 {
+	exponent := int(binary.BigEndian.Uint16(b[0:2]) & 0x7fff)
+	mantissa := binary.BigEndian.Uint64(b[2:10])
+	if exponent == 0 && mantissa == 0 {
+		return 0
+	}
+
+	f := math.Ldexp(float64(mantissa), exponent-16383-63)
+	if b[0]&0x80 != 0 {
+		f = -f
+	}
+	return f
+}
@@ -0,0 +1,34 @@
+package audio
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestOversizedChunk checks that a chunk claiming more bytes than the
+// file holds is rejected instead of allocated.
+func TestOversizedChunk(t *testing.T) {
+	for _, id := range []string{"COMM", "NAME"} {
+		header := []byte("FORM\x00\x00\x00\x00AIFF" + id + "\xff\xff\xff\xf0")
+		binary.BigEndian.PutUint32(header[4:8], uint32(len(header)-8))
+		path := filepath.Join(t.TempDir(), "broken.aiff")
+		if err := os.WriteFile(path, header, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if id == "COMM" {
+			_, err := OpenReader(path)
+			if err == nil || !strings.Contains(err.Error(), "past the end") {
+				t.Errorf("OpenReader: got %v, want an oversized chunk error", err)
+			}
+		} else {
+			_, err := ReadAIFFMetadata(path)
+			if err == nil || !strings.Contains(err.Error(), "past the end") {
+				t.Errorf("ReadAIFFMetadata: got %v, want an oversized chunk error", err)
+			}
+		}
+	}
+}
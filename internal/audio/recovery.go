@@ -0,0 +1,154 @@
+package audio
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// RecoveryPolicy makes a recorder survive its device going away: instead
+// of ending the recording on a stream error, it waits for the device to
+// come back and keeps appending to the same file.
+type RecoveryPolicy struct {
+	// FillGap writes silence for the time the device was gone, so the
+	// file stays aligned with wall-clock time. Without it the audio
+	// simply continues and the gap is only reported.
+	FillGap bool
+	// Timeout bounds the wait for the device; after it the recording is
+	// interrupted as without a policy.
+	Timeout time.Duration
+	// PollInterval is how often the device list is checked while waiting.
+	PollInterval time.Duration
+	// DeviceID is the stable ID of the device to wait for, which may come
+	// back at another index. Without one the same index is reopened.
+	DeviceID string
+	// OnReconnect is called once the device records again.
+	OnReconnect func(reconnect Reconnect)
+}
+
+// Reconnect describes one outage that was recovered from.
+type Reconnect struct {
+	// Frame is the position in the file where the device was lost. A
+	// marker labelled ReconnectMarkerLabel is added there.
+	Frame      int64     `json:"frame"`
+	LostAt     time.Time `json:"lost_at"`
+	GapSeconds float64   `json:"gap_seconds"`
+	// GapFrames is the length of the silence inserted at Frame; zero when
+	// the gap was not filled.
+	GapFrames int64  `json:"gap_frames"`
+	Error     string `json:"error"`
+}
+
+func (af *AIFFAudioFormat) SetRecovery(policy *RecoveryPolicy) {
+	af.Recovery = policy
+}
+
+// reconnect waits for the device after a stream error and opens a new
+// stream on it. Stop signals are still answered while waiting. done is
+// true when the recording ended meanwhile, err then being its result;
+// otherwise err tells that the device did not return in time.
+func (af *AIFFAudioFormat) reconnect(params CaptureParams, cause error) (stream CaptureStream, done bool, err error) {
+	policy := af.Recovery
+	lostAt := time.Now()
+	frame := af.counter.snapshot().Frames
+	log.Printf("⚠️ Device lost after %d frames (%v), waiting up to %s for it to return", frame, cause, policy.Timeout)
+
+	ticker := time.NewTicker(policy.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case ctl := <-af.RecControlSig.Sig:
+			return nil, true, af.finish(ctl)
+		case <-ticker.C:
+		}
+
+		if time.Since(lostAt) > policy.Timeout {
+			return nil, false, fmt.Errorf("device did not return within %s: %w", policy.Timeout, cause)
+		}
+
+		index, err := af.findRecoveredDevice(params.DeviceIndex)
+		if err != nil {
+			continue
+		}
+		params.DeviceIndex = index
+		stream, err := af.Backend.Open(params)
+		if err != nil {
+			continue
+		}
+		if err := stream.Start(); err != nil {
+			stream.Close()
+			continue
+		}
+
+		gap := time.Since(lostAt)
+		reconnect := Reconnect{
+			Frame:      frame,
+			LostAt:     lostAt,
+			GapSeconds: gap.Seconds(),
+			Error:      cause.Error(),
+		}
+		// A gap while paused would not have been recorded anyway.
+		if policy.FillGap && !af.paused {
+			af.flushResampler()
+			reconnect.GapFrames = int64(gap.Seconds() * af.SampleRate)
+			if af.AGC != nil {
+				af.AGC.skip(reconnect.GapFrames)
+			}
+			af.writer.putSilence(reconnect.GapFrames)
+			af.counter.captured(reconnect.GapFrames)
+		}
+		af.markers.add(frame, ReconnectMarkerLabel, nil)
+		log.Printf("🔌 Device back at index %d after %.1fs", index, gap.Seconds())
+
+		if policy.OnReconnect != nil {
+			go policy.OnReconnect(reconnect)
+		}
+		return stream, false, nil
+	}
+}
+
+// findRecoveredDevice returns the index the device is listed at now.
+func (af *AIFFAudioFormat) findRecoveredDevice(index int) (int, error) {
+	if af.Recovery.DeviceID == "" {
+		if _, err := af.Backend.Device(index); err != nil {
+			return -1, err
+		}
+		return index, nil
+	}
+
+	// PortAudio keeps listing the lost device while other sessions hold
+	// the library open, so its presence is checked where hotplug sees it.
+	if lister, ok := af.Backend.(hotplugLister); ok {
+		present, err := lister.hotplugDevices()
+		if err != nil {
+			return -1, err
+		}
+		if !hasDeviceID(present, af.Recovery.DeviceID) {
+			return -1, fmt.Errorf("device %s not present", af.Recovery.DeviceID)
+		}
+	}
+
+	devices, err := af.Backend.Devices()
+	if err != nil {
+		return -1, err
+	}
+	found, err := findDeviceByID(devices, af.Recovery.DeviceID)
+	if err != nil {
+		return -1, err
+	}
+	if found < 0 {
+		return -1, fmt.Errorf("device %s not enumerated yet", af.Recovery.DeviceID)
+	}
+	return found, nil
+}
+
+// hasDeviceID tells whether a device with the stable ID id is listed.
+func hasDeviceID(devices []AudioDevice, id string) bool {
+	for _, device := range devices {
+		if strings.EqualFold(device.ID, id) {
+			return true
+		}
+	}
+	return false
+}
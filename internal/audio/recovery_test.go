@@ -0,0 +1,105 @@
+package audio
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// unplugBackend is a FakeBackend whose device goes away for a while
+// after failAfter reads of the first stream.
+type unplugBackend struct {
+	*FakeBackend
+	failAfter int
+	outage    time.Duration
+	back      atomic.Int64 // Unix nanoseconds the device returns at
+}
+
+func (b *unplugBackend) Device(index int) (*AudioDevice, error) {
+	if time.Now().UnixNano() < b.back.Load() {
+		return nil, errors.New("device unplugged")
+	}
+	return b.FakeBackend.Device(index)
+}
+
+func (b *unplugBackend) Open(params CaptureParams) (CaptureStream, error) {
+	if _, err := b.Device(params.DeviceIndex); err != nil {
+		return nil, err
+	}
+	stream, err := b.FakeBackend.Open(params)
+	if err != nil {
+		return nil, err
+	}
+	reads := b.failAfter
+	b.failAfter = -1
+	return &unplugStream{CaptureStream: stream, backend: b, reads: reads}, nil
+}
+
+type unplugStream struct {
+	CaptureStream
+	backend *unplugBackend
+	reads   int
+}
+
+func (s *unplugStream) Read(buf []int32) error {
+	if s.reads == 0 {
+		s.backend.back.Store(time.Now().Add(s.backend.outage).UnixNano())
+		return errors.New("device unplugged")
+	}
+	s.reads--
+	return s.CaptureStream.Read(buf)
+}
+
+func TestRecoveryMarker(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		fillGap bool
+	}{
+		{"marker", false},
+		{"silence", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			fake := NewFakeBackend(FakeSource{Signal: "sine", Frequency: 1000, LevelDBFS: -12})
+			fake.Realtime = false
+			backend := &unplugBackend{FakeBackend: fake, failAfter: 10, outage: 20 * time.Millisecond}
+			reconnects := make(chan Reconnect, 1)
+
+			af, path := newTestRecorder(t, false, func(af *AIFFAudioFormat) {
+				af.Backend = backend
+				af.SetRecovery(&RecoveryPolicy{
+					FillGap:      test.fillGap,
+					Timeout:      5 * time.Second,
+					PollInterval: 5 * time.Millisecond,
+					OnReconnect:  func(r Reconnect) { reconnects <- r },
+				})
+			})
+			stop := startRecording(af)
+			var reconnect Reconnect
+			select {
+			case reconnect = <-reconnects:
+			case <-time.After(10 * time.Second):
+				t.Fatal("device did not reconnect")
+			}
+			waitFrames(t, af, reconnect.Frame+reconnect.GapFrames+640)
+			if err := stop(); err != nil {
+				t.Fatal(err)
+			}
+
+			if reconnect.Frame != 640 {
+				t.Errorf("device lost at frame %d, want 640", reconnect.Frame)
+			}
+			if gotFill := reconnect.GapFrames > 0; gotFill != test.fillGap {
+				t.Errorf("%d gap frames filled", reconnect.GapFrames)
+			}
+			meta, err := ReadAIFFMetadata(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			markers := meta.Markers
+			if len(markers) != 1 || markers[0].ID != 1 || markers[0].Frame != reconnect.Frame || markers[0].Label != ReconnectMarkerLabel {
+				t.Errorf("MARK chunk holds %+v, want a %q marker at frame %d", markers, ReconnectMarkerLabel, reconnect.Frame)
+			}
+		})
+	}
+}
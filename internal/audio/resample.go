@@ -0,0 +1,269 @@
+package audio
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// Resampler converts interleaved audio between two sample rates with a
+// polyphase windowed-sinc filter. The output rate is an exact fraction
+// up/down of the input rate; each output frame is the input filtered at
+// its position, using one of up precomputed phases of the filter.
+//
+// The filter passes up to 90% of the lower Nyquist frequency and is down
+// by 100 dB at the Nyquist frequency, so nothing above the output band
+// aliases into it.
+type Resampler struct {
+	channels int
+	up, down int64
+	// half is the number of input frames on each side of an output
+	// position that the filter reaches.
+	half  int
+	taps  [][]float64
+	in    []float64
+	start int64
+	// frames is the number of input frames received so far; next is the
+	// index of the next output frame.
+	frames   int64
+	next     int64
+	flushing bool
+}
+
+const (
+	// resampleStopbandDB is the attenuation of the filter's stopband.
+	resampleStopbandDB = 100
+	// resamplePassband is the fraction of the lower Nyquist frequency
+	// passed without attenuation.
+	resamplePassband = 0.9
+	// resampleMaxPhases bounds the filter table for awkward rate pairs.
+	resampleMaxPhases = 1024
+)
+
+// NewResampler returns a resampler from inRate to outRate for audio with
+// the given number of channels. Both rates must be whole numbers.
+func NewResampler(inRate, outRate float64, channels int) (*Resampler, error) {
+	if channels < 1 {
+		return nil, fmt.Errorf("invalid channel count %d", channels)
+	}
+	in, out := int64(math.Round(inRate)), int64(math.Round(outRate))
+	if in <= 0 || out <= 0 || float64(in) != inRate || float64(out) != outRate {
+		return nil, fmt.Errorf("cannot resample from %g Hz to %g Hz: rates must be positive whole numbers", inRate, outRate)
+	}
+	g := gcd(in, out)
+	up, down := out/g, in/g
+	if up > resampleMaxPhases {
+		return nil, fmt.Errorf("cannot resample from %d Hz to %d Hz: ratio %d/%d is too fine", in, out, up, down)
+	}
+
+	// Frequencies are in cycles per input frame.
+	nyquist := 0.5 * min(1, float64(out)/float64(in))
+	transition := (1 - resamplePassband) * nyquist
+	cutoff := nyquist - transition/2
+	// Kaiser's estimates for the window length and shape.
+	length := (resampleStopbandDB - 7.95) / (14.36 * transition)
+	beta := 0.1102 * (resampleStopbandDB - 8.7)
+	half := int(math.Ceil(length / 2))
+
+	r := &Resampler{
+		channels: channels,
+		up:       up,
+		down:     down,
+		half:     half,
+		taps:     make([][]float64, up),
+	}
+	norm := besselI0(beta)
+	for p := range r.taps {
+		taps := make([]float64, 2*half)
+		sum := 0.0
+		for j := range taps {
+			// Distance from the output position to input frame
+			// i0-half+1+j, where the output sits p/up after i0.
+			t := float64(half-1-j) + float64(p)/float64(up)
+			x := t / float64(half)
+			if x <= -1 || x >= 1 {
+				continue
+			}
+			window := besselI0(beta*math.Sqrt(1-x*x)) / norm
+			taps[j] = 2 * cutoff * sinc(2*cutoff*t) * window
+			sum += taps[j]
+		}
+		// Each phase passes DC unchanged.
+		for j := range taps {
+			taps[j] /= sum
+		}
+		r.taps[p] = taps
+	}
+
+	r.Reset()
+	return r, nil
+}
+
+// Reset starts a new stream, as after a gap in the input.
+func (r *Resampler) Reset() {
+	// The input before the first frame is silence.
+	r.in = append(r.in[:0], make([]float64, r.half*r.channels)...)
+	r.start = -int64(r.half)
+	r.frames = 0
+	r.next = 0
+	r.flushing = false
+}
+
+// MaxOutput is the most frames Process returns for inFrames input frames.
+func (r *Resampler) MaxOutput(inFrames int) int {
+	return int(int64(inFrames)*r.up/r.down) + 1
+}
+
+// OutputFrames is the length of the output, flush included, for an input
+// of inFrames frames.
+func (r *Resampler) OutputFrames(inFrames int64) int64 {
+	return (inFrames*r.up + r.down - 1) / r.down
+}
+
+// Process resamples the interleaved frames of in into dst and returns the
+// number of samples written. dst must have room for MaxOutput frames.
+// The output lags the input by the reach of the filter; Flush returns the
+// rest at the end of the stream.
+func (r *Resampler) Process(dst, in []int32) int {
+	for _, s := range in {
+		r.in = append(r.in, float64(s))
+	}
+	r.frames += int64(len(in) / r.channels)
+	return r.emit(dst)
+}
+
+// Flush writes the output still held back into dst and returns the
+// number of samples written; it returns 0 once everything was written.
+// The resampler takes no more input afterwards.
+func (r *Resampler) Flush(dst []int32) int {
+	if !r.flushing {
+		r.flushing = true
+		r.in = append(r.in, make([]float64, r.half*r.channels)...)
+	}
+	return r.emit(dst)
+}
+
+func (r *Resampler) emit(dst []int32) int {
+	written := 0
+	for written+r.channels <= len(dst) {
+		position := r.next * r.down
+		i0 := position / r.up
+		if r.flushing {
+			if position >= r.frames*r.up {
+				break
+			}
+		} else if i0+int64(r.half) >= r.frames {
+			break
+		}
+
+		taps := r.taps[position%r.up]
+		base := int(i0-int64(r.half)+1-r.start) * r.channels
+		for c := 0; c < r.channels; c++ {
+			acc := 0.0
+			for j, tap := range taps {
+				acc += tap * r.in[base+j*r.channels+c]
+			}
+			dst[written+c] = clampSample(acc)
+		}
+		written += r.channels
+		r.next++
+	}
+
+	// Drop the input no later output reaches.
+	first := (r.next*r.down)/r.up - int64(r.half) + 1
+	if drop := int(first - r.start); drop > 0 {
+		drop = min(drop, len(r.in)/r.channels)
+		r.in = r.in[:copy(r.in, r.in[drop*r.channels:])]
+		r.start += int64(drop)
+	}
+	return written
+}
+
+func clampSample(v float64) int32 {
+	v = math.Round(v)
+	if v > math.MaxInt32 {
+		return math.MaxInt32
+	}
+	if v < math.MinInt32 {
+		return math.MinInt32
+	}
+	return int32(v)
+}
+
+// besselI0 is the zeroth-order modified Bessel function of the first
+// kind, summed as a power series.
+func besselI0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	for k := 1; term > 1e-12*sum; k++ {
+		term *= (x / (2 * float64(k))) * (x / (2 * float64(k)))
+		sum += term
+	}
+	return sum
+}
+
+func gcd(a, b int64) int64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// ResampleFile writes a copy of an audio file at sampleRate and returns
+// the path of the new file, named after the input with the rate appended
+// and in its format for AIFF and WAV. A file already at sampleRate is returned as is.
+func ResampleFile(inputPath string, sampleRate float64) (string, error) {
+	ar, err := OpenReader(inputPath)
+	if err != nil {
+		return "", err
+	}
+	defer ar.Close()
+	if ar.SampleRate == sampleRate {
+		return inputPath, nil
+	}
+
+	channels := int(ar.Channel)
+	r, err := NewResampler(ar.SampleRate, sampleRate, channels)
+	if err != nil {
+		return "", err
+	}
+
+	outputPath, out, err := newOutputWriter(inputPath, fmt.Sprintf("_%gHz", sampleRate), ar.Format, ar.Channel, sampleRate)
+	if err != nil {
+		return "", err
+	}
+
+	err = func() error {
+		buf := make([]int32, readChunkFrames*channels)
+		dst := make([]int32, r.MaxOutput(readChunkFrames)*channels)
+		for {
+			n, err := ar.ReadFrames(buf)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if err := out.WriteFrames(dst[:r.Process(dst, buf[:n*channels])]); err != nil {
+				return err
+			}
+		}
+		for {
+			n := r.Flush(dst)
+			if n == 0 {
+				return nil
+			}
+			if err := out.WriteFrames(dst[:n]); err != nil {
+				return err
+			}
+		}
+	}()
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(outputPath)
+		return "", err
+	}
+	return outputPath, nil
+}
@@ -0,0 +1,154 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// resampleTone resamples half a second of a sine at freq Hz and half full
+// scale from inRate to outRate, feeding it in uneven chunks, and returns
+// the output as floats in [-1, 1).
+func resampleTone(t *testing.T, inRate, outRate, freq float64) []float64 {
+	t.Helper()
+	r, err := NewResampler(inRate, outRate, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := make([]int32, int(inRate)/2)
+	for i := range in {
+		in[i] = int32(0.5 * math.Sin(2*math.Pi*freq*float64(i)/inRate) * (1 << 31))
+	}
+
+	var out []int32
+	buf := make([]int32, r.MaxOutput(1000))
+	for len(in) > 0 {
+		n := min(len(in), 997)
+		out = append(out, buf[:r.Process(buf, in[:n])]...)
+		in = in[n:]
+	}
+	for {
+		n := r.Flush(buf)
+		if n == 0 {
+			break
+		}
+		out = append(out, buf[:n]...)
+	}
+
+	samples := make([]float64, len(out))
+	for i, s := range out {
+		samples[i] = float64(s) / (1 << 31)
+	}
+	return samples
+}
+
+// fitTone fits a sine at freq to the middle 80% of samples, away from
+// the filter's start and end, and returns its amplitude and the RMS of
+// what is left over.
+func fitTone(samples []float64, rate, freq float64) (amplitude, residual float64) {
+	lo, hi := len(samples)/10, len(samples)*9/10
+	var ss, sc, cc, ys, yc float64
+	for i := lo; i < hi; i++ {
+		s := math.Sin(2 * math.Pi * freq * float64(i) / rate)
+		c := math.Cos(2 * math.Pi * freq * float64(i) / rate)
+		ss += s * s
+		sc += s * c
+		cc += c * c
+		ys += samples[i] * s
+		yc += samples[i] * c
+	}
+	det := ss*cc - sc*sc
+	a := (ys*cc - yc*sc) / det
+	b := (yc*ss - ys*sc) / det
+
+	var sum float64
+	for i := lo; i < hi; i++ {
+		s := math.Sin(2 * math.Pi * freq * float64(i) / rate)
+		c := math.Cos(2 * math.Pi * freq * float64(i) / rate)
+		d := samples[i] - a*s - b*c
+		sum += d * d
+	}
+	return math.Hypot(a, b), math.Sqrt(sum / float64(hi-lo))
+}
+
+// rms returns the RMS of the middle 80% of samples.
+func rms(samples []float64) float64 {
+	lo, hi := len(samples)/10, len(samples)*9/10
+	var sum float64
+	for _, s := range samples[lo:hi] {
+		sum += s * s
+	}
+	return math.Sqrt(sum / float64(hi-lo))
+}
+
+var resampleRates = []struct{ in, out float64 }{
+	{44100, 16000},
+	{44100, 48000},
+	{48000, 16000},
+}
+
+func TestResamplerPassband(t *testing.T) {
+	const maxRippleDB = 0.1
+	// Everything besides the tone, including images, must stay this far
+	// below it.
+	const minCleanDB = 90
+
+	for _, rates := range resampleRates {
+		t.Run(fmt.Sprintf("%g-%g", rates.in, rates.out), func(t *testing.T) {
+			edge := resamplePassband * min(rates.in, rates.out) / 2
+			for i := 0; i <= 24; i++ {
+				freq := 50 * math.Pow(edge/50, float64(i)/24)
+				out := resampleTone(t, rates.in, rates.out, freq)
+				amplitude, residual := fitTone(out, rates.out, freq)
+
+				gain := 20 * math.Log10(amplitude/0.5)
+				if math.Abs(gain) > maxRippleDB {
+					t.Errorf("%.0f Hz: gain %.4f dB, want within ±%g dB", freq, gain, maxRippleDB)
+				}
+				if clean := 20 * math.Log10(amplitude/residual); clean < minCleanDB {
+					t.Errorf("%.0f Hz: distortion and images %.1f dB below the tone, want at least %d dB", freq, clean, minCleanDB)
+				}
+			}
+		})
+	}
+}
+
+func TestResamplerStopband(t *testing.T) {
+	const minRejectionDB = 90
+
+	for _, rates := range resampleRates {
+		t.Run(fmt.Sprintf("%g-%g", rates.in, rates.out), func(t *testing.T) {
+			if rates.out > rates.in {
+				// Upsampling has no input above the output Nyquist
+				// frequency; its images are covered by the passband
+				// test.
+				t.Skip("no input above the output Nyquist frequency")
+			}
+			lo, hi := rates.out/2, 0.98*rates.in/2
+			for i := 0; i <= 16; i++ {
+				freq := lo + (hi-lo)*float64(i)/16
+				out := resampleTone(t, rates.in, rates.out, freq)
+				rejection := -20 * math.Log10(rms(out)/(0.5/math.Sqrt2))
+				if rejection < minRejectionDB {
+					t.Errorf("%.0f Hz: rejected by %.1f dB, want at least %d dB", freq, rejection, minRejectionDB)
+				}
+			}
+		})
+	}
+}
+
+// TestResamplerImages checks that upsampling a tone near the top of the
+// input band leaves no image above the input Nyquist frequency.
+func TestResamplerImages(t *testing.T) {
+	const minRejectionDB = 90
+
+	for _, freq := range []float64{21000, 21500, 22000} {
+		out := resampleTone(t, 44100, 48000, freq)
+		image := 44100 - freq
+		amplitude, _ := fitTone(out, 48000, image)
+		if rejection := -20 * math.Log10(amplitude/0.5); rejection < minRejectionDB {
+			t.Errorf("%.0f Hz: image at %.0f Hz rejected by %.1f dB, want at least %d dB", freq, image, rejection, minRejectionDB)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package audio
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SegmentPolicy splits a recording into consecutive files, so a long
+// session is not lost with its last file. Segments follow each other
+// without a gap: the frame after the last one of a segment is the first
+// of the next.
+//
+// Every recording is split once a file reaches the AIFF size limit, with
+// or without a policy; a policy with no limits only receives those
+// segments.
+type SegmentPolicy struct {
+	// MaxDuration and MaxBytes limit the audio in one segment; zero
+	// leaves that limit off.
+	MaxDuration time.Duration
+	MaxBytes    int64
+	// OnSegment is called with each complete segment, the last one
+	// included. It runs on the disk writer and must not block.
+	OnSegment func(Segment)
+}
+
+// Segment is one file of a segmented recording.
+type Segment struct {
+	// Index numbers the segments of a recording from 1.
+	Index    int    `json:"index"`
+	FilePath string `json:"file_path"`
+	// StartFrame is the position of the segment's first frame in the
+	// whole recording; StartSeconds is the same in seconds.
+	StartFrame   int64   `json:"start_frame"`
+	StartSeconds float64 `json:"start_seconds"`
+	Frames       int64   `json:"frames"`
+	// Final is set on the last segment of the recording.
+	Final bool `json:"final"`
+	// Markers are the recording's markers that fall into the segment,
+	// with frames relative to its start.
+	Markers []Marker `json:"markers,omitempty"`
+	// AGCCurve is the gain applied to the segment, see AGCReport.
+	AGCCurve []AGCPoint `json:"agc_curve,omitempty"`
+	// Loudness is measured on the complete segment before it is
+	// uploaded; segments are not normalized.
+	Loudness *LoudnessStats `json:"loudness,omitempty"`
+}
+
+// SegmentFileName returns the file name, without extension, of segment
+// index of a recording named filename.
+func SegmentFileName(filename string, index int) string {
+	return fmt.Sprintf("%s_%03d", filename, index)
+}
+
+// fileFormat is the container a segmenter writes around the sample data.
+type fileFormat interface {
+	ext() string
+	encode(dst []byte, samples []int32) []byte
+	// maxDataBytes is the most sample data one file can hold.
+	maxDataBytes() int64
+	// writeHeader starts a file with its sizes left at zero and returns
+	// the offset of the sample data. startFrame is the position of the
+	// file's first frame in the whole recording.
+	writeHeader(w io.Writer, channel int16, sampleRate float64, meta *FileMetadata, startFrame int64) (int64, error)
+	// complete fills in the sizes of a file holding frames frames.
+	complete(file *os.File, dataOffset, frames int64, channel int16) error
+	// writeMetadata and writeMarkers add chunks to a completed file.
+	writeMetadata(path string, meta FileMetadata) error
+	writeMarkers(path string, markers []Marker) error
+}
+
+// formatOf returns the container of a recording by its extension.
+func formatOf(path string) fileFormat {
+	if strings.EqualFold(filepath.Ext(path), ".wav") {
+		return wavFormat{}
+	}
+	return aiffFormat{}
+}
+
+// segmenter is the io.Writer behind the disk writer. It writes the
+// sample data into one file, or into numbered segment files when the
+// policy sets limits, and completes each file's header once it is done.
+// A single file that reaches the format's size limit rolls over into
+// <name>_002 and so on, and the recording becomes segmented.
+type segmenter struct {
+	dir        string
+	name       string
+	format     fileFormat
+	channel    int16
+	sampleRate float64
+	policy     *SegmentPolicy
+	metadata   *FileMetadata
+	markers    *markerLog
+	agc        *AutoGainControl
+	// maxBytes is the data size at which a segment is closed.
+	maxBytes int64
+	// numbered is set when every file name carries its index, segmented
+	// once the recording consists of several files.
+	numbered  bool
+	segmented bool
+
+	file       *os.File
+	index      int
+	startFrame int64
+	dataOffset int64
+	bytes      int64
+
+	mu       sync.Mutex
+	segments []Segment
+}
+
+func newSegmenter(dir, name string, format fileFormat, channel int16, sampleRate float64, policy *SegmentPolicy, metadata *FileMetadata, markers *markerLog, agc *AutoGainControl) (*segmenter, error) {
+	s := &segmenter{
+		dir:        dir,
+		name:       name,
+		format:     format,
+		channel:    channel,
+		sampleRate: sampleRate,
+		policy:     policy,
+		metadata:   metadata,
+		markers:    markers,
+		agc:        agc,
+	}
+
+	frameBytes := int64(4 * channel)
+	s.maxBytes = format.maxDataBytes() / frameBytes * frameBytes
+	if policy != nil {
+		if policy.MaxDuration > 0 {
+			s.maxBytes = min(s.maxBytes, int64(policy.MaxDuration.Seconds()*sampleRate)*frameBytes)
+			s.numbered = true
+		}
+		if policy.MaxBytes > 0 {
+			s.maxBytes = min(s.maxBytes, policy.MaxBytes/frameBytes*frameBytes)
+			s.numbered = true
+		}
+		s.maxBytes = max(s.maxBytes, frameBytes)
+	}
+	s.segmented = s.numbered
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// path returns the file of the current segment.
+func (s *segmenter) path() string {
+	name := s.name
+	if s.numbered || s.index > 1 {
+		name = SegmentFileName(s.name, s.index)
+	}
+	return filepath.Join(s.dir, fmt.Sprintf("%s.%s", name, s.format.ext()))
+}
+
+func (s *segmenter) open() error {
+	s.index++
+	path := s.path()
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	dataOffset, err := s.format.writeHeader(file, s.channel, s.sampleRate, s.fileMetadata(), s.startFrame)
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("write header of %s: %w", path, err)
+	}
+	s.file = file
+	s.dataOffset = dataOffset
+	s.bytes = 0
+	return nil
+}
+
+func (s *segmenter) Write(p []byte) (int, error) {
+	if s.file == nil {
+		return 0, fmt.Errorf("audio file not open")
+	}
+
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(int64(len(p)), s.maxBytes-s.bytes)]
+		n, err := s.file.Write(chunk)
+		written += n
+		s.bytes += int64(n)
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+
+		if s.bytes == s.maxBytes && len(p) > 0 {
+			if err := s.rotate(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (s *segmenter) rotate() error {
+	if !s.segmented {
+		log.Printf("⚠️ %s reached the file size limit, continuing in a new file", s.file.Name())
+		s.segmented = true
+	}
+	frames := s.frames()
+	if err := s.closeFile(false); err != nil {
+		return err
+	}
+	s.startFrame += frames
+	return s.open()
+}
+
+func (s *segmenter) frames() int64 {
+	return s.bytes / int64(4*s.channel)
+}
+
+// Close completes the last file.
+func (s *segmenter) Close() error {
+	if s.file == nil {
+		return fmt.Errorf("audio file not initialized")
+	}
+	return s.closeFile(true)
+}
+
+// closeFile patches the header sizes for the frames written, closes the
+// file and adds the metadata and the markers that fall into it.
+func (s *segmenter) closeFile(final bool) error {
+	file := s.file
+	s.file = nil
+	frames := s.frames()
+	name := file.Name()
+
+	if err := s.format.complete(file, s.dataOffset, frames, s.channel); err != nil {
+		file.Close()
+		return fmt.Errorf("finalize %s: %w", name, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("finalize %s: %w", name, err)
+	}
+
+	if meta := s.fileMetadata(); meta != nil {
+		if err := s.format.writeMetadata(name, *meta); err != nil {
+			return fmt.Errorf("write metadata to %s: %w", name, err)
+		}
+	}
+
+	var markers []Marker
+	for _, marker := range s.markers.snapshot() {
+		// A marker on the boundary belongs to the segment it starts.
+		if marker.Frame >= s.startFrame && (marker.Frame < s.startFrame+frames || final && marker.Frame == s.startFrame+frames) {
+			marker.Frame -= s.startFrame
+			markers = append(markers, marker)
+		}
+	}
+	if len(markers) > 0 {
+		if err := s.format.writeMarkers(name, markers); err != nil {
+			return fmt.Errorf("write markers to %s: %w", name, err)
+		}
+	}
+
+	if !s.segmented {
+		return nil
+	}
+	segment := Segment{
+		Index:        s.index,
+		FilePath:     name,
+		StartFrame:   s.startFrame,
+		StartSeconds: float64(s.startFrame) / s.sampleRate,
+		Frames:       frames,
+		Final:        final,
+		Markers:      markers,
+	}
+	if s.agc != nil {
+		segment.AGCCurve = s.agc.takeCurve(s.startFrame, s.startFrame+frames)
+	}
+	s.mu.Lock()
+	s.segments = append(s.segments, segment)
+	s.mu.Unlock()
+	if s.policy != nil && s.policy.OnSegment != nil {
+		s.policy.OnSegment(segment)
+	}
+	return nil
+}
+
+// fileMetadata returns the metadata of the current file, nil if the
+// recording has none.
+func (s *segmenter) fileMetadata() *FileMetadata {
+	if s.metadata == nil {
+		return nil
+	}
+	meta := *s.metadata
+	if s.segmented {
+		meta.Segment = s.index
+	}
+	return &meta
+}
+
+// list returns the segments completed so far.
+func (s *segmenter) list() []Segment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Segment(nil), s.segments...)
+}
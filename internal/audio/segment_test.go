@@ -0,0 +1,262 @@
+package audio
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// segmentRun is what a segmenter made of a recording.
+type segmentRun struct {
+	dir      string
+	samples  []int32
+	reported []Segment
+	seg      *segmenter
+}
+
+// runSegmenter writes frames stereo frames at 1 kHz through a segmenter
+// in uneven chunks, with a marker at each of markerFrames.
+func runSegmenter(t *testing.T, format fileFormat, policy *SegmentPolicy, frames int, markerFrames []int64) *segmentRun {
+	t.Helper()
+	run := &segmentRun{dir: t.TempDir()}
+	if policy != nil {
+		policy.OnSegment = func(segment Segment) { run.reported = append(run.reported, segment) }
+	}
+	markers := &markerLog{}
+	for _, frame := range markerFrames {
+		markers.add(frame, "m", nil)
+	}
+	meta := &FileMetadata{SessionID: "segments"}
+
+	s, err := newSegmenter(run.dir, "take", format, 2, 1000, policy, meta, markers, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run.seg = s
+	run.samples = make([]int32, 2*frames)
+	for i := range run.samples {
+		run.samples[i] = int32(i) << 8
+	}
+	for rest := run.samples; len(rest) > 0; {
+		n := min(len(rest), 2*333)
+		if _, err := s.Write(format.encode(nil, rest[:n])); err != nil {
+			t.Fatal(err)
+		}
+		rest = rest[n:]
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return run
+}
+
+// fileMarkers reads the markers stored in an AIFF or WAV file.
+func fileMarkers(t *testing.T, path string) []Marker {
+	t.Helper()
+	if filepath.Ext(path) == ".wav" {
+		meta, err := ReadWAVMetadata(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return meta.Markers
+	}
+	meta, err := ReadAIFFMetadata(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return meta.Markers
+}
+
+func TestSegmentRotation(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		format  fileFormat
+		policy  *SegmentPolicy
+		frames  int
+		markers []int64
+		// files and lengths describe the expected segments;
+		// fileMarkers lists the marker frames inside each.
+		files       []string
+		lengths     []int64
+		fileMarkers [][]int64
+	}{
+		{
+			name: "duration", format: aiffFormat{}, policy: &SegmentPolicy{MaxDuration: time.Second},
+			frames: 3500, markers: []int64{0, 999, 1000, 3500},
+			files:       []string{"take_001.aiff", "take_002.aiff", "take_003.aiff", "take_004.aiff"},
+			lengths:     []int64{1000, 1000, 1000, 500},
+			fileMarkers: [][]int64{{0, 999}, {0}, nil, {500}},
+		},
+		{
+			name: "bytes", format: aiffFormat{}, policy: &SegmentPolicy{MaxBytes: 8003},
+			frames: 3500, markers: []int64{2000},
+			files:       []string{"take_001.aiff", "take_002.aiff", "take_003.aiff", "take_004.aiff"},
+			lengths:     []int64{1000, 1000, 1000, 500},
+			fileMarkers: [][]int64{nil, nil, {0}, nil},
+		},
+		{
+			name: "whole segments", format: aiffFormat{}, policy: &SegmentPolicy{MaxDuration: time.Second},
+			frames: 3000, markers: []int64{3000},
+			files:       []string{"take_001.aiff", "take_002.aiff", "take_003.aiff"},
+			lengths:     []int64{1000, 1000, 1000},
+			fileMarkers: [][]int64{nil, nil, {1000}},
+		},
+		{
+			name: "both limits", format: wavFormat{}, policy: &SegmentPolicy{MaxDuration: time.Second, MaxBytes: 4000},
+			frames: 1200, markers: []int64{499, 500},
+			files:       []string{"take_001.wav", "take_002.wav", "take_003.wav"},
+			lengths:     []int64{500, 500, 200},
+			fileMarkers: [][]int64{{499}, {0}, nil},
+		},
+		{
+			name: "no limits", format: aiffFormat{}, policy: &SegmentPolicy{},
+			frames: 3500, markers: []int64{1000},
+			files:       []string{"take.aiff"},
+			lengths:     []int64{3500},
+			fileMarkers: [][]int64{{1000}},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			run := runSegmenter(t, test.format, test.policy, test.frames, test.markers)
+			checkSegments(t, run, test.files, test.lengths, test.fileMarkers)
+			if len(test.files) == 1 && (len(run.reported) != 0 || len(run.seg.segments) != 0) {
+				t.Errorf("a single file was reported as %d segments", len(run.reported))
+			}
+		})
+	}
+}
+
+// checkSegments checks that the files hold the recording without a gap
+// in the expected pieces, and that segmented files were reported.
+func checkSegments(t *testing.T, run *segmentRun, files []string, lengths []int64, markers [][]int64) {
+	t.Helper()
+	var joined []int32
+	start := int64(0)
+	for i, name := range files {
+		path := filepath.Join(run.dir, name)
+		samples := readAll(t, path)
+		joined = append(joined, samples...)
+		if got := int64(len(samples) / 2); got != lengths[i] {
+			t.Errorf("%s holds %d frames, want %d", name, got, lengths[i])
+		}
+		var got []int64
+		for _, marker := range fileMarkers(t, path) {
+			got = append(got, marker.Frame)
+		}
+		if !slices.Equal(got, markers[i]) {
+			t.Errorf("%s has markers at %v, want %v", name, got, markers[i])
+		}
+
+		if len(files) > 1 {
+			if i >= len(run.reported) {
+				t.Fatalf("%d segments reported", len(run.reported))
+			}
+			segment := run.reported[i]
+			if segment.Index != i+1 || segment.FilePath != path || segment.StartFrame != start ||
+				segment.Frames != lengths[i] || segment.Final != (i == len(files)-1) || len(segment.Markers) != len(markers[i]) {
+				t.Errorf("segment %d reported as %+v", i+1, segment)
+			}
+			if meta, err := ReadAIFFMetadata(path); err == nil && meta.Recording != nil && meta.Recording.Segment != i+1 {
+				t.Errorf("%s describes itself as segment %d", name, meta.Recording.Segment)
+			}
+		}
+		start += lengths[i]
+	}
+	if len(files) > 1 && !slices.EqualFunc(run.reported, run.seg.segments, func(a, b Segment) bool { return a.FilePath == b.FilePath }) {
+		t.Errorf("reported %d segments, listed %d", len(run.reported), len(run.seg.segments))
+	}
+	if !slices.Equal(joined, run.samples) {
+		t.Error("the files joined do not hold the recording")
+	}
+}
+
+// smallFormat is a format that holds only limit bytes of sample data.
+type smallFormat struct {
+	fileFormat
+	limit int64
+}
+
+func (f smallFormat) maxDataBytes() int64 { return f.limit }
+
+// TestFormatLimitRollover records past the size limit of a format, which
+// rolls the recording over into numbered files without a policy.
+func TestFormatLimitRollover(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		format fileFormat
+		policy *SegmentPolicy
+		files  []string
+	}{
+		{"aiff", smallFormat{aiffFormat{}, 8003}, nil, []string{"take.aiff", "take_002.aiff", "take_003.aiff"}},
+		{"wav", smallFormat{wavFormat{}, 8003}, nil, []string{"take.wav", "take_002.wav", "take_003.wav"}},
+		// A looser policy limit leaves the format's in charge.
+		{"policy", smallFormat{aiffFormat{}, 8003}, &SegmentPolicy{MaxDuration: time.Hour}, []string{"take_001.aiff", "take_002.aiff", "take_003.aiff"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			run := runSegmenter(t, test.format, test.policy, 2500, []int64{1000})
+			if test.policy == nil {
+				// Only the segments list tells about them then.
+				run.reported = run.seg.segments
+			}
+			checkSegments(t, run, test.files, []int64{1000, 1000, 500}, [][]int64{nil, {0}, nil})
+		})
+	}
+}
+
+// TestFormatLimitHeaders completes headers for the largest file each
+// format's limit allows and checks that a reader gets the sizes back,
+// which an overflowing 32-bit size field would not give. A file whose
+// data alone overflows the size field must be refused.
+func TestFormatLimitHeaders(t *testing.T) {
+	if testing.Short() {
+		t.Skip("creates 4 GiB sparse files")
+	}
+	for _, test := range []struct {
+		name   string
+		format fileFormat
+		// sizeField is the first data size the header cannot hold.
+		sizeField int64
+	}{
+		{"aiff", aiffFormat{}, 1 << 31},
+		{"wav", wavFormat{}, 1 << 32},
+	} {
+		for _, channel := range []int16{1, 2, 6} {
+			frameBytes := int64(4 * channel)
+			frames := test.format.maxDataBytes() / frameBytes
+			path := filepath.Join(t.TempDir(), "limit."+test.format.ext())
+			file, err := os.Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dataOffset, err := test.format.writeHeader(file, channel, 48000, nil, 0)
+			if err == nil {
+				err = file.Truncate(dataOffset + frames*frameBytes)
+			}
+			if err == nil {
+				err = test.format.complete(file, dataOffset, frames, channel)
+			}
+			if err == nil && test.format.complete(file, dataOffset, test.sizeField/frameBytes, channel) == nil {
+				t.Errorf("%s, %d channels: %d bytes of data fit the header", test.name, channel, test.sizeField)
+			}
+			if err == nil {
+				err = test.format.complete(file, dataOffset, frames, channel)
+			}
+			file.Close()
+			if err != nil {
+				t.Fatalf("%s, %d channels: %v", test.name, channel, err)
+			}
+
+			ar, err := OpenReader(path)
+			if err != nil {
+				t.Fatalf("%s, %d channels: %v", test.name, channel, err)
+			}
+			ar.Close()
+			if ar.NumFrames != frames || ar.Channel != channel {
+				t.Errorf("%s: read %d frames of %d channels, wrote %d of %d", test.name, ar.NumFrames, ar.Channel, frames, channel)
+			}
+			os.Remove(path)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package audio
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var unsafeLabelChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// SplitChannels de-interleaves a multichannel file into one mono file
+// per channel, in the same format for AIFF and WAV, and returns their
+// paths in channel order. A label given for a channel is appended to
+// that file's name.
+func SplitChannels(inputPath string, labels []string) ([]string, error) {
+	ar, err := OpenReader(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	defer ar.Close()
+
+	channels := int(ar.Channel)
+	paths := make([]string, channels)
+	writers := make([]*pcmFileWriter, channels)
+	defer func() {
+		for _, w := range writers {
+			if w != nil {
+				w.Close()
+			}
+		}
+	}()
+
+	for c := 0; c < channels; c++ {
+		suffix := fmt.Sprintf("_ch%d", c+1)
+		if c < len(labels) && labels[c] != "" {
+			suffix += "_" + strings.Trim(unsafeLabelChars.ReplaceAllString(strings.ToLower(labels[c]), "-"), "-")
+		}
+
+		paths[c], writers[c], err = newOutputWriter(inputPath, suffix, ar.Format, 1, ar.SampleRate)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	buf := make([]int32, readChunkFrames*channels)
+	mono := make([]int32, readChunkFrames)
+	for {
+		n, err := ar.ReadFrames(buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for c, w := range writers {
+			for f := 0; f < n; f++ {
+				mono[f] = buf[f*channels+c]
+			}
+			if err := w.WriteFrames(mono[:n]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for c, w := range writers {
+		writers[c] = nil
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
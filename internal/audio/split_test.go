@@ -0,0 +1,68 @@
+package audio
+
+import (
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplitChannels(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		channels int
+		format   string
+		labels   []string
+		want     []string
+	}{
+		{"labelled", 2, "aiff", []string{"Client", "Practitioner"}, []string{"take_ch1_client.aiff", "take_ch2_practitioner.aiff"}},
+		{"unlabelled", 2, "aiff", nil, []string{"take_ch1.aiff", "take_ch2.aiff"}},
+		{"unsafe label", 2, "aiff", []string{" Dr. Smith / Room 2!", ""}, []string{"take_ch1_dr-smith-room-2.aiff", "take_ch2.aiff"}},
+		{"fewer labels", 4, "aiff", []string{"a", "b"}, []string{"take_ch1_a.aiff", "take_ch2_b.aiff", "take_ch3.aiff", "take_ch4.aiff"}},
+		{"wav", 2, "wav", []string{"client"}, []string{"take_ch1_client.wav", "take_ch2.wav"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			input := writeTestFile(t, "take", test.channels, 48000, 0.5, func(i, c int) float64 {
+				return float64(c+1) * 0.1 * math.Sin(2*math.Pi*float64(100*(c+1))*float64(i)/48000)
+			})
+			if test.format == "wav" {
+				wav := strings.TrimSuffix(input, ".aiff") + ".wav"
+				if _, err := Convert(input, wav, ConvertOptions{}); err != nil {
+					t.Fatal(err)
+				}
+				input = wav
+			}
+
+			paths, err := SplitChannels(input, test.labels)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(paths) != len(test.want) {
+				t.Fatalf("split into %v, want %v", paths, test.want)
+			}
+			in := readAll(t, input)
+			for c, path := range paths {
+				if filepath.Dir(path) != filepath.Dir(input) || filepath.Base(path) != test.want[c] {
+					t.Errorf("channel %d written to %s, want %s next to the input", c+1, path, test.want[c])
+				}
+				ar, err := OpenReader(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ar.Close()
+				if ar.Format != test.format || ar.Channel != 1 || ar.SampleRate != 48000 {
+					t.Errorf("channel %d is %s, %d channels at %g Hz", c+1, ar.Format, ar.Channel, ar.SampleRate)
+				}
+				out := readAll(t, path)
+				if len(out)*test.channels != len(in) {
+					t.Fatalf("channel %d holds %d frames of %d", c+1, len(out), len(in)/test.channels)
+				}
+				for f, s := range out {
+					if s != in[f*test.channels+c] {
+						t.Fatalf("channel %d frame %d is %d, input has %d", c+1, f, s, in[f*test.channels+c])
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package audio
+
+import (
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+const (
+	// trimWindow is the resolution of the silence detector.
+	trimWindow = 10 * time.Millisecond
+	// trimPadding is kept on both sides of the audible part so speech
+	// onsets and decays are not clipped.
+	trimPadding = 200 * time.Millisecond
+)
+
+// TrimReport records how much was cut from each end of a recording.
+// Offsets are in frames and seconds from the start of the original file,
+// so timestamps in the trimmed file map back to wall-clock time by adding
+// StartOffsetSeconds to the time the recording started.
+type TrimReport struct {
+	Trimmed             bool    `json:"trimmed"`
+	OriginalFrames      int64   `json:"original_frames"`
+	StartOffsetFrames   int64   `json:"start_offset_frames"`
+	EndOffsetFrames     int64   `json:"end_offset_frames"`
+	StartOffsetSeconds  float64 `json:"start_offset_seconds"`
+	EndOffsetSeconds    float64 `json:"end_offset_seconds"`
+	TrailingTrimSeconds float64 `json:"trailing_trim_seconds"`
+}
+
+// TrimSilence removes leading and trailing silence longer than minSilence
+// from an AIFF file. A window counts as silent when its RMS level is below
+// thresholdDBFS on every channel. The trimmed copy is written next to the
+// input and its path returned; when nothing qualifies for trimming the
+// input path is returned unchanged.
+func TrimSilence(inputPath string, thresholdDBFS float64, minSilence time.Duration) (string, *TrimReport, error) {
+	first, last, total, sampleRate, err := findAudibleRange(inputPath, thresholdDBFS)
+	if err != nil {
+		return "", nil, err
+	}
+
+	report := &TrimReport{
+		OriginalFrames:  total,
+		EndOffsetFrames: total,
+	}
+	if first < 0 {
+		// Nothing above the threshold, keep the file as it is.
+		report.EndOffsetSeconds = float64(total) / sampleRate
+		return inputPath, report, nil
+	}
+
+	padding := durationToFrames(trimPadding, sampleRate)
+	minFrames := durationToFrames(minSilence, sampleRate)
+
+	start := int64(0)
+	if first-padding >= minFrames {
+		start = first - padding
+	}
+	end := total
+	if total-(last+padding) >= minFrames {
+		end = last + padding
+	}
+
+	report.StartOffsetFrames = start
+	report.EndOffsetFrames = end
+	report.StartOffsetSeconds = float64(start) / sampleRate
+	report.EndOffsetSeconds = float64(end) / sampleRate
+	report.TrailingTrimSeconds = float64(total-end) / sampleRate
+	if start == 0 && end == total {
+		return inputPath, report, nil
+	}
+
+	outputPath, err := copyFrameRange(inputPath, "_trimmed", start, end)
+	if err != nil {
+		return "", nil, err
+	}
+
+	report.Trimmed = true
+	return outputPath, report, nil
+}
+
+func durationToFrames(d time.Duration, sampleRate float64) int64 {
+	return int64(d.Seconds() * sampleRate)
+}
+
+// findAudibleRange returns the first and last frame of the windows whose
+// level reaches thresholdDBFS, or -1 when the whole file is below it.
+func findAudibleRange(path string, thresholdDBFS float64) (int64, int64, int64, float64, error) {
+	ar, err := OpenReader(path)
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+	defer ar.Close()
+
+	channels := int(ar.Channel)
+	window := int(durationToFrames(trimWindow, ar.SampleRate))
+	if window < 1 {
+		window = 1
+	}
+	threshold := math.Pow(10, thresholdDBFS/20)
+	threshold *= threshold
+
+	buf := make([]int32, window*channels)
+	sums := make([]float64, channels)
+	first, last := int64(-1), int64(-1)
+	pos := int64(0)
+
+	for {
+		n, err := ar.ReadFrames(buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, 0, 0, 0, err
+		}
+
+		for c := range sums {
+			sums[c] = 0
+		}
+		for i := 0; i < n*channels; i++ {
+			s := float64(buf[i]) / (1 << 31)
+			sums[i%channels] += s * s
+		}
+		for _, sum := range sums {
+			if sum/float64(n) >= threshold {
+				if first < 0 {
+					first = pos
+				}
+				last = pos + int64(n)
+				break
+			}
+		}
+		pos += int64(n)
+	}
+
+	return first, last, ar.NumFrames, ar.SampleRate, nil
+}
+
+// copyFrameRange writes frames [start, end) of inputPath to a new file
+// named with suffix, see newStepWriter, and returns its path.
+func copyFrameRange(inputPath, suffix string, start, end int64) (string, error) {
+	ar, err := OpenReader(inputPath)
+	if err != nil {
+		return "", err
+	}
+	defer ar.Close()
+
+	outputPath, out, err := newStepWriter(inputPath, suffix, ar)
+	if err != nil {
+		return "", err
+	}
+
+	err = func() error {
+		channels := int(ar.Channel)
+		buf := make([]int32, readChunkFrames*channels)
+		pos := int64(0)
+		for pos < end {
+			n, err := ar.ReadFrames(buf)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+
+			from, to := int64(0), int64(n)
+			if pos < start {
+				from = min(start-pos, int64(n))
+			}
+			if pos+int64(n) > end {
+				to = end - pos
+			}
+			if from < to {
+				if err := out.WriteFrames(buf[from*int64(channels) : to*int64(channels)]); err != nil {
+					return err
+				}
+			}
+			pos += int64(n)
+		}
+		return nil
+	}()
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(outputPath)
+		return "", err
+	}
+	return outputPath, nil
+}
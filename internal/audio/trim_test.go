@@ -0,0 +1,74 @@
+package audio
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTrimSilence(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		rate float64
+		// lead, tone and tail are the lengths in seconds of the leading
+		// silence, the tone and the trailing silence.
+		lead, tone, tail float64
+		// quietChannel leaves the first of two channels silent.
+		quietChannel bool
+		start, end   int64
+	}{
+		{name: "both ends", rate: 48000, lead: 1, tone: 1, tail: 1, start: 38400, end: 105600},
+		{name: "short lead", rate: 48000, lead: 0.3, tone: 1, tail: 1, start: 0, end: 72000},
+		{name: "short tail", rate: 48000, lead: 1, tone: 1, tail: 0.5, start: 38400, end: 120000},
+		{name: "no silence", rate: 48000, tone: 1, start: 0, end: 48000},
+		{name: "all silent", rate: 48000, lead: 1, start: 0, end: 48000},
+		{name: "44.1 kHz", rate: 44100, lead: 2, tone: 1, tail: 2, start: 79380, end: 141120},
+		{name: "one channel audible", rate: 48000, lead: 1, tone: 1, tail: 1, quietChannel: true, start: 38400, end: 105600},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			channels := 1
+			if test.quietChannel {
+				channels = 2
+			}
+			toneStart, toneEnd := int(test.lead*test.rate), int((test.lead+test.tone)*test.rate)
+			sample := func(i, c int) float64 {
+				if i < toneStart || i >= toneEnd || (test.quietChannel && c == 0) {
+					return 0
+				}
+				return 0.1 * math.Sin(2*math.Pi*440*float64(i)/test.rate)
+			}
+			input := writeTestFile(t, "take", channels, test.rate, test.lead+test.tone+test.tail, sample)
+
+			path, report, err := TrimSilence(input, -40, 500*time.Millisecond)
+			if err != nil {
+				t.Fatal(err)
+			}
+			total := int64((test.lead + test.tone + test.tail) * test.rate)
+			trimmed := test.start > 0 || test.end < total
+			if report.Trimmed != trimmed || (path != input) != trimmed {
+				t.Fatalf("trimmed %v to %s, want trimmed %v", report.Trimmed, path, trimmed)
+			}
+			if report.OriginalFrames != total || report.StartOffsetFrames != test.start || report.EndOffsetFrames != test.end {
+				t.Errorf("kept frames [%d, %d) of %d, want [%d, %d) of %d",
+					report.StartOffsetFrames, report.EndOffsetFrames, report.OriginalFrames, test.start, test.end, total)
+			}
+			if report.StartOffsetSeconds != float64(test.start)/test.rate ||
+				report.EndOffsetSeconds != float64(test.end)/test.rate ||
+				report.TrailingTrimSeconds != float64(total-test.end)/test.rate {
+				t.Errorf("offsets %.4f s, %.4f s, trailing %.4f s do not match the frames",
+					report.StartOffsetSeconds, report.EndOffsetSeconds, report.TrailingTrimSeconds)
+			}
+
+			in, out := readAll(t, input), readAll(t, path)
+			want := in[test.start*int64(channels) : test.end*int64(channels)]
+			if len(out) != len(want) {
+				t.Fatalf("output holds %d samples, want %d", len(out), len(want))
+			}
+			for i := range want {
+				if out[i] != want[i] {
+					t.Fatalf("output sample %d is %d, input has %d", i, out[i], want[i])
+				}
+			}
+		})
+	}
+}
@@ -1,12 +1,12 @@
 package audio
 
 import (
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"strings"
-
-	"github.com/gordonklaus/portaudio"
 )
 
 // AudioDevice represents an audio input device
@@ -16,133 +16,98 @@ type AudioDevice struct {
 	MaxInputChannels  int     `json:"max_input_channels"`
 	DefaultSampleRate float64 `json:"default_sample_rate"`
 	HostAPI           string  `json:"host_api"`
+	// ID names the device in a way that survives replugging and
+	// re-enumeration, see stableDeviceID. PulseAudio sources use their
+	// source name.
+	ID string `json:"id,omitempty"`
+	// Alias is the friendly name given to ID in the device alias file.
+	Alias string `json:"alias,omitempty"`
 }
 
+// SampleRateToByte encodes a positive sample rate as the 80-bit IEEE
+// extended float of the AIFF COMM chunk.
 func SampleRateToByte(sampleRate float64) []byte {
-	switch sampleRate {
-	case 16000:
-		return []byte{0x40, 0x0c, 0x7a, 0, 0, 0, 0, 0, 0, 0}
-	case 44100:
-		return []byte{0x40, 0x0e, 0xac, 0x44, 0, 0, 0, 0, 0, 0}
-	case 48000:
-		return []byte{0x40, 0x0e, 0xbb, 0x80, 0, 0, 0, 0, 0, 0}
-	default:
-		panic("unsupported sample rate")
-	}
-}
-
-func must(err error) {
-	if err != nil {
-		panic(err)
-	}
+	b := make([]byte, 10)
+	if sampleRate <= 0 {
+		return b
+	}
+	frac, exp := math.Frexp(sampleRate)
+	binary.BigEndian.PutUint16(b[0:2], uint16(exp-1+16383))
+	binary.BigEndian.PutUint64(b[2:10], uint64(math.Ldexp(frac, 64)))
+	return b
 }
 
 func ListAudioDevices() []AudioDevice {
-	if err := portaudio.Initialize(); err != nil {
-		log.Printf("Failed to initialize PortAudio: %v", err)
-		return []AudioDevice{}
-	}
-	defer portaudio.Terminate()
-
-	devices, err := portaudio.Devices()
+	devices, err := ListDevices()
 	if err != nil {
-		log.Printf("Failed to get devices: %v", err)
+		log.Printf("Failed to list devices: %v", err)
 		return []AudioDevice{}
 	}
 
-	var audioDevices []AudioDevice
-	for i, device := range devices {
-		if device.MaxInputChannels > 0 && isHardwareDevice(device.Name) {
-			hostAPIName := "Unknown"
-			if device.HostApi != nil {
-				hostAPIName = device.HostApi.Name
-			}
-
-			audioDevices = append(audioDevices, AudioDevice{
-				Index:             i,
-				Name:              device.Name,
-				MaxInputChannels:  device.MaxInputChannels,
-				DefaultSampleRate: device.DefaultSampleRate,
-				HostAPI:           hostAPIName,
-			})
-		}
-	}
-
-	log.Printf("Found %d audio input devices", len(audioDevices))
-	return audioDevices
+	log.Printf("Found %d audio input devices", len(devices))
+	return devices
 }
 
-func isHardwareDevice(name string) bool {
-	n := strings.ToLower(name)
-	if strings.Contains(n, "hw:") {
-		return true
-	}
-
-	virtual := []string{"default", "sysdefault", "spdif"}
-	for _, v := range virtual {
-		if n == v || strings.Contains(n, v) {
-			return false
-		}
+// ListDevices lists the input devices of the capture backend with their
+// aliases, or the error that kept the backend from listing them.
+func ListDevices() ([]AudioDevice, error) {
+	devices, err := GetCaptureBackend().Devices()
+	if err != nil {
+		return nil, err
 	}
-
-	return false
+	applyAliases(devicePointers(devices)...)
+	return devices, nil
 }
 
 // GetDeviceByIndex returns device information for a specific index
 func GetDeviceByIndex(index int) (*AudioDevice, error) {
-	if err := portaudio.Initialize(); err != nil {
-		return nil, fmt.Errorf("failed to initialize PortAudio: %w", err)
-	}
-	defer portaudio.Terminate()
-
-	devices, err := portaudio.Devices()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get devices: %w", err)
-	}
-
-	if index < 0 || index >= len(devices) {
+	if index < 0 {
 		return nil, fmt.Errorf("device index %d out of range", index)
 	}
-
-	device := devices[index]
-	if device.MaxInputChannels == 0 {
-		return nil, fmt.Errorf("device %d has no input channels", index)
-	}
-
-	hostAPIName := "Unknown"
-	if device.HostApi != nil {
-		hostAPIName = device.HostApi.Name
+	device, err := GetCaptureBackend().Device(index)
+	if err != nil {
+		return nil, err
 	}
-
-	return &AudioDevice{
-		Index:             index,
-		Name:              device.Name,
-		MaxInputChannels:  device.MaxInputChannels,
-		DefaultSampleRate: device.DefaultSampleRate,
-		HostAPI:           hostAPIName,
-	}, nil
+	applyAliases(device)
+	return device, nil
 }
 
+// GetDeviceIndexByName resolves an exact device ID or alias first, then
+// the first device whose name contains name.
 func GetDeviceIndexByName(name string) (int, error) {
-	if err := portaudio.Initialize(); err != nil {
-		return -1, fmt.Errorf("failed to initialize PortAudio: %w", err)
-	}
-
-	defer portaudio.Terminate()
-
-	devices, err := portaudio.Devices()
+	devices, err := GetCaptureBackend().Devices()
 	if err != nil {
-		return -1, fmt.Errorf("failed to get devices: %w", err)
+		return -1, err
 	}
+	applyAliases(devicePointers(devices)...)
 
-	for i, device := range devices {
+	if index, err := findDeviceByID(devices, name); err != nil || index >= 0 {
+		return index, err
+	}
+	for _, device := range devices {
 		if strings.Contains(strings.ToLower(device.Name), strings.ToLower(name)) {
-			return i, nil
+			return device.Index, nil
 		}
 	}
 	return -1, fmt.Errorf("device with name containing %q not found", name)
 }
 
+// ValidateChannelMap checks that a 1-based channel map only selects
+// channels the device has, each at most once.
+func ValidateChannelMap(channelMap []int, maxInputChannels int) error {
+	seen := make(map[int]bool)
+	for _, ch := range channelMap {
+		if ch < 1 || ch > maxInputChannels {
+			return fmt.Errorf("channel %d out of range (device has %d input channels)", ch, maxInputChannels)
+		}
+		if seen[ch] {
+			return fmt.Errorf("channel %d selected twice", ch)
+		}
+		seen[ch] = true
+	}
+	return nil
+}
+
 func GetDevicesJSON() ([]byte, error) {
 	devices := ListAudioDevices()
 	return json.MarshalIndent(devices, "", "  ")
@@ -159,38 +124,10 @@ func PrintAvailableDevicesJSON() {
 
 // GetDefaultInputDevice returns the default input device
 func GetDefaultInputDevice() (*AudioDevice, error) {
-	if err := portaudio.Initialize(); err != nil {
-		return nil, fmt.Errorf("failed to initialize PortAudio: %w", err)
-	}
-	defer portaudio.Terminate()
-
-	defaultDevice, err := portaudio.DefaultInputDevice()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get default input device: %w", err)
-	}
-
-	devices, err := portaudio.Devices()
+	device, err := GetCaptureBackend().Device(-1)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get devices: %w", err)
+		return nil, err
 	}
-
-	// Find the index of the default device
-	for i, device := range devices {
-		if device == defaultDevice {
-			hostAPIName := "Unknown"
-			if device.HostApi != nil {
-				hostAPIName = device.HostApi.Name
-			}
-
-			return &AudioDevice{
-				Index:             i,
-				Name:              device.Name,
-				MaxInputChannels:  device.MaxInputChannels,
-				DefaultSampleRate: device.DefaultSampleRate,
-				HostAPI:           hostAPIName,
-			}, nil
-		}
-	}
-
-	return nil, fmt.Errorf("default device not found in device list")
+	applyAliases(device)
+	return device, nil
 }
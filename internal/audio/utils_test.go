@@ -0,0 +1,24 @@
+package audio
+
+import "testing"
+
+func TestValidateChannelMap(t *testing.T) {
+	for _, test := range []struct {
+		channelMap []int
+		ok         bool
+	}{
+		{[]int{1, 2}, true},
+		{[]int{2, 1}, true},
+		{[]int{4}, true},
+		{nil, true},
+		{[]int{0}, false},
+		{[]int{5}, false},
+		{[]int{-1, 2}, false},
+		{[]int{1, 3, 1}, false},
+	} {
+		err := ValidateChannelMap(test.channelMap, 4)
+		if (err == nil) != test.ok {
+			t.Errorf("ValidateChannelMap(%v, 4) = %v", test.channelMap, err)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrInvalidFile is wrapped by the error Verify returns for a file whose
+// structure is broken.
+var ErrInvalidFile = errors.New("invalid audio file")
+
+// FileInfo describes a verified audio file.
+type FileInfo struct {
+	Path          string  `json:"path"`
+	Format        string  `json:"format"`
+	Channels      int     `json:"channels"`
+	BitsPerSample int     `json:"bits_per_sample"`
+	SampleRate    float64 `json:"sample_rate"`
+	Frames        int64   `json:"frames"`
+	Seconds       float64 `json:"seconds"`
+	Size          int64   `json:"size"`
+	// Problems lists everything wrong with the file; it is empty for a
+	// valid file.
+	Problems []string `json:"problems,omitempty"`
+}
+
+// Verify checks that an AIFF or WAV file is complete: the container and
+// chunk sizes must match the file length, the format chunk must be
+// readable and the sample data must agree with it. It returns what it
+// could read of the file, and an error wrapping ErrInvalidFile that lists
+// the problems if there are any.
+func Verify(path string) (*FileInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	info := &FileInfo{Path: path, Size: stat.Size()}
+	problem := func(format string, args ...interface{}) {
+		info.Problems = append(info.Problems, fmt.Sprintf(format, args...))
+	}
+
+	var form [12]byte
+	if _, err := file.ReadAt(form[:], 0); err != nil {
+		problem("no file header: %v", err)
+		return info, info.err()
+	}
+	var layout chunkLayout
+	switch {
+	case string(form[0:4]) == "FORM" && string(form[8:12]) == "AIFF":
+		layout, info.Format = aiffLayout, "aiff"
+	case string(form[0:4]) == "RIFF" && string(form[8:12]) == "WAVE":
+		layout, info.Format = wavLayout, "wav"
+	default:
+		problem("not an AIFF or WAV file")
+		return info, info.err()
+	}
+	// The recorder fills in the sizes when it finalizes a file.
+	size := int64(layout.order.Uint32(form[4:8])) + 8
+	if size == 8 {
+		problem("sizes not filled in, the recording was not finalized")
+		return info, info.err()
+	}
+	if size != info.Size {
+		problem("%s size says %d bytes, file has %d", layout.form, size, info.Size)
+	}
+
+	// The format is read with the same code as for playback.
+	reader := &Reader{file: file}
+	var commFrames, dataBytes int64 = -1, -1
+	formatSeen, formatOK := false, false
+	_, err = layout.walk(file, func(id string, offset, size int64) error {
+		if offset+size > info.Size {
+			problem("%s chunk at %d runs %d bytes past the end of the file", id, offset-8, offset+size-info.Size)
+			// A truncated recording still has its sample data counted.
+			if id != "SSND" && id != "data" {
+				return nil
+			}
+		}
+		switch id {
+		case "COMM", "fmt ":
+			body := make([]byte, size)
+			if _, err := file.ReadAt(body, offset); err != nil {
+				return err
+			}
+			if id == "COMM" {
+				err = reader.parseCOMM(body)
+				if len(body) >= 6 {
+					commFrames = int64(binary.BigEndian.Uint32(body[2:6]))
+				}
+			} else {
+				err = reader.parseFmt(body)
+				if err == nil && int64(binary.LittleEndian.Uint16(body[12:14])) != reader.frameBytes() {
+					problem("fmt block align %d does not match %d channels of %d bits", binary.LittleEndian.Uint16(body[12:14]), reader.Channel, reader.BitsPerSample)
+				}
+			}
+			formatSeen = true
+			if err != nil {
+				problem("%v", err)
+			} else {
+				formatOK = true
+			}
+		case "SSND":
+			var header [8]byte
+			if size < 8 {
+				return fmt.Errorf("short SSND chunk")
+			}
+			if _, err := file.ReadAt(header[:], offset); err != nil {
+				return err
+			}
+			dataBytes = size - 8 - int64(binary.BigEndian.Uint32(header[0:4]))
+		case "data":
+			dataBytes = size
+		}
+		return nil
+	})
+	if err != nil {
+		problem("%v", err)
+		return info, info.err()
+	}
+
+	if formatOK {
+		info.Channels = int(reader.Channel)
+		info.BitsPerSample = int(reader.BitsPerSample)
+		info.SampleRate = reader.SampleRate
+	}
+	switch {
+	case !formatSeen:
+		problem("no format chunk")
+	case !formatOK:
+		// Already reported.
+	case dataBytes < 0:
+		problem("no sample data chunk")
+	default:
+		frameBytes := reader.frameBytes()
+		info.Frames = dataBytes / frameBytes
+		if dataBytes%frameBytes != 0 {
+			problem("sample data of %d bytes is not a whole number of %d-byte frames", dataBytes, frameBytes)
+		}
+		if commFrames >= 0 && commFrames != info.Frames {
+			problem("COMM says %d frames, SSND holds %d", commFrames, info.Frames)
+		}
+		info.Seconds = float64(info.Frames) / info.SampleRate
+	}
+	return info, info.err()
+}
+
+func (info *FileInfo) err() error {
+	if len(info.Problems) == 0 {
+		return nil
+	}
+	errs := make([]error, len(info.Problems))
+	for i, p := range info.Problems {
+		errs[i] = errors.New(p)
+	}
+	return fmt.Errorf("%w %s: %w", ErrInvalidFile, info.Path, errors.Join(errs...))
+}
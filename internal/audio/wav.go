@@ -0,0 +1,359 @@
+package audio
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// WAVAudioFormat records like AIFFAudioFormat, into 32-bit WAV files.
+// With SetBroadcastWave the files are Broadcast Wave files.
+type WAVAudioFormat struct {
+	AIFFAudioFormat
+}
+
+func NewWAVAudioFormat() *WAVAudioFormat {
+	wf := &WAVAudioFormat{}
+	wf.DeviceIndex = -1
+	wf.Backend = GetCaptureBackend()
+	wf.format = wavFormat{}
+	return wf
+}
+
+func (wf *WAVAudioFormat) GetFileType() string { return "wav" }
+
+// SetBroadcastWave adds bext and iXML chunks, filled in from the
+// metadata, to each file. It must be called before Init.
+func (wf *WAVAudioFormat) SetBroadcastWave(enabled bool) {
+	wf.format = wavFormat{broadcast: enabled}
+}
+
+// wavMaxDataBytes caps the sound data of one file below the unsigned
+// 32-bit RIFF size, leaving room for the header, metadata and markers.
+const wavMaxDataBytes = 1<<32 - 1 - 16<<20
+
+// wavFormat writes recordings as 32-bit WAVE_FORMAT_EXTENSIBLE files.
+type wavFormat struct {
+	broadcast bool
+}
+
+func (wavFormat) ext() string { return "wav" }
+
+func (wavFormat) encode(dst []byte, samples []int32) []byte {
+	return encodeSamplesLE(dst, samples)
+}
+
+func (wavFormat) maxDataBytes() int64 { return wavMaxDataBytes }
+
+// wavPCMSubFormat is the KSDATAFORMAT_SUBTYPE_PCM GUID as stored in the
+// fmt chunk.
+var wavPCMSubFormat = []byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xaa, 0x00, 0x38, 0x9b, 0x71}
+
+// wavFmtChunk builds the body of a fmt chunk for integer PCM. Formats
+// plain PCM cannot describe, with more than 16 bits or 2 channels, use
+// WAVE_FORMAT_EXTENSIBLE.
+func wavFmtChunk(channel int16, sampleRate float64, bitsPerSample int) []byte {
+	rate := uint32(math.Round(sampleRate))
+	blockAlign := uint16(bitsPerSample/8) * uint16(channel)
+	extensible := bitsPerSample > 16 || channel > 2
+
+	var format []byte
+	if extensible {
+		format = binary.LittleEndian.AppendUint16(format, wavFormatExtensible)
+	} else {
+		format = binary.LittleEndian.AppendUint16(format, wavFormatPCM)
+	}
+	format = binary.LittleEndian.AppendUint16(format, uint16(channel))
+	format = binary.LittleEndian.AppendUint32(format, rate)
+	format = binary.LittleEndian.AppendUint32(format, rate*uint32(blockAlign))
+	format = binary.LittleEndian.AppendUint16(format, blockAlign)
+	format = binary.LittleEndian.AppendUint16(format, uint16(bitsPerSample))
+	if !extensible {
+		return format
+	}
+	format = binary.LittleEndian.AppendUint16(format, 22)
+	format = binary.LittleEndian.AppendUint16(format, uint16(bitsPerSample))
+	format = binary.LittleEndian.AppendUint32(format, 0)
+	return append(format, wavPCMSubFormat...)
+}
+
+func (f wavFormat) writeHeader(w io.Writer, channel int16, sampleRate float64, meta *FileMetadata, startFrame int64) (int64, error) {
+	header := []byte("RIFF\x00\x00\x00\x00WAVE")
+	header = append(header, wavLayout.chunk("fmt ", wavFmtChunk(channel, sampleRate, 32))...)
+	if f.broadcast {
+		if meta == nil {
+			meta = &FileMetadata{StartTime: time.Now()}
+		}
+		header = appendPadded(header, wavLayout.chunk("bext", bextChunk(*meta, channel, sampleRate, startFrame)))
+		ixml, err := ixmlChunk(*meta, channel, sampleRate, startFrame)
+		if err != nil {
+			return 0, err
+		}
+		header = appendPadded(header, wavLayout.chunk("iXML", ixml))
+	}
+	header = append(header, "data\x00\x00\x00\x00"...)
+
+	if _, err := w.Write(header); err != nil {
+		return 0, err
+	}
+	return int64(len(header)), nil
+}
+
+func (wavFormat) complete(file *os.File, dataOffset, frames int64, channel int16) error {
+	dataBytes := 4 * frames * int64(channel)
+	if dataOffset+dataBytes-8 > math.MaxUint32 {
+		return fmt.Errorf("%d frames do not fit in a WAV header", frames)
+	}
+	patches := []struct {
+		offset int64
+		value  uint32
+	}{
+		{4, uint32(dataOffset + dataBytes - 8)},
+		{dataOffset - 4, uint32(dataBytes)},
+	}
+	for _, p := range patches {
+		var b [4]byte
+		binary.LittleEndian.PutUint32(b[:], p.value)
+		if _, err := file.WriteAt(b[:], p.offset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (wavFormat) writeMetadata(path string, meta FileMetadata) error {
+	return WriteWAVMetadata(path, meta)
+}
+
+func (wavFormat) writeMarkers(path string, markers []Marker) error {
+	return WriteWAVMarkers(path, markers)
+}
+
+// WriteWAVMetadata appends a LIST INFO chunk describing meta to a WAV
+// file: the session as INAM, the Pi as IART, a summary as ICMT, the
+// software as ISFT and the start date as ICRD.
+func WriteWAVMetadata(path string, meta FileMetadata) error {
+	info := []byte("INFO")
+	for _, field := range []struct{ id, text string }{
+		{"INAM", meta.SessionID},
+		{"IART", "Pi " + meta.PiID},
+		{"ICMT", meta.annotation()},
+		{"ISFT", meta.Software},
+		{"ICRD", meta.StartTime.Format("2006-01-02")},
+	} {
+		if field.text == "" {
+			continue
+		}
+		// INFO strings are NUL-terminated.
+		info = appendPadded(info, wavLayout.chunk(field.id, append([]byte(field.text), 0)))
+	}
+	return wavLayout.append(path, wavLayout.chunk("LIST", info))
+}
+
+// WriteWAVMarkers appends a cue chunk with markers to a WAV file that has
+// none, with the labels in a LIST adtl chunk. Like WriteAIFFMarkers it
+// leaves out markers past the end of the file and payloads.
+func WriteWAVMarkers(path string, markers []Marker) error {
+	numFrames, err := wavFrames(path)
+	if err != nil {
+		return err
+	}
+
+	var points, labels []byte
+	count := 0
+	for _, m := range markers {
+		if m.ID < 1 || m.Frame < 0 || m.Frame > numFrames || m.Frame > math.MaxUint32 {
+			continue
+		}
+		points = binary.LittleEndian.AppendUint32(points, uint32(m.ID))
+		points = binary.LittleEndian.AppendUint32(points, uint32(m.Frame))
+		points = append(points, "data"...)
+		points = binary.LittleEndian.AppendUint32(points, 0)
+		points = binary.LittleEndian.AppendUint32(points, 0)
+		points = binary.LittleEndian.AppendUint32(points, uint32(m.Frame))
+
+		label := binary.LittleEndian.AppendUint32(nil, uint32(m.ID))
+		label = append(label, m.Label...)
+		labels = appendPadded(labels, wavLayout.chunk("labl", append(label, 0)))
+		count++
+	}
+	if count == 0 {
+		return nil
+	}
+
+	cue := binary.LittleEndian.AppendUint32(nil, uint32(count))
+	return wavLayout.append(path,
+		wavLayout.chunk("cue ", append(cue, points...)),
+		wavLayout.chunk("LIST", append([]byte("adtl"), labels...)),
+	)
+}
+
+// wavFrames returns the number of frames in a WAV file.
+func wavFrames(path string) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var blockAlign, dataBytes int64 = 0, -1
+	_, err = wavLayout.walk(file, func(id string, offset, size int64) error {
+		switch id {
+		case "fmt ":
+			var b [2]byte
+			if _, err := file.ReadAt(b[:], offset+12); err != nil {
+				return fmt.Errorf("read fmt chunk: %w", err)
+			}
+			blockAlign = int64(binary.LittleEndian.Uint16(b[:]))
+		case "data":
+			dataBytes = size
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+	if blockAlign == 0 || dataBytes < 0 {
+		return 0, fmt.Errorf("%s: missing fmt or data chunk", path)
+	}
+	return dataBytes / blockAlign, nil
+}
+
+// WAVMetadata is the descriptive data found in a WAV file.
+type WAVMetadata struct {
+	// Name, Artist, Comment and Software are the INAM, IART, ICMT and
+	// ISFT fields of the LIST INFO chunk.
+	Name     string `json:"name,omitempty"`
+	Artist   string `json:"artist,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+	Software string `json:"software,omitempty"`
+	// Broadcast is the bext chunk of a Broadcast Wave file.
+	Broadcast *BroadcastExtension `json:"broadcast,omitempty"`
+	// Scene, Take and Tape come from the iXML chunk, and Tracks names
+	// the channels in order as it lists them.
+	Scene  string   `json:"scene,omitempty"`
+	Take   int      `json:"take,omitempty"`
+	Tape   string   `json:"tape,omitempty"`
+	Tracks []string `json:"tracks,omitempty"`
+	// Recording is the metadata this recorder stores in the iXML USER
+	// element, nil when the file has none.
+	Recording *FileMetadata `json:"recording,omitempty"`
+	// Markers are read from the cue chunk and their labl names.
+	Markers []Marker `json:"markers,omitempty"`
+}
+
+// ReadWAVMetadata reads the LIST INFO, bext, iXML and cue chunks of a WAV
+// file. Chunks it does not know are skipped.
+func ReadWAVMetadata(path string) (*WAVMetadata, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &WAVMetadata{}
+	labels := map[int]string{}
+	_, err = wavLayout.walk(file, func(id string, offset, size int64) error {
+		switch id {
+		case "LIST", "bext", "iXML", "cue ":
+		default:
+			return nil
+		}
+		if offset+size > info.Size() {
+			return fmt.Errorf("%s chunk of %d bytes runs past the end of the file", id, size)
+		}
+		body := make([]byte, size)
+		if _, err := file.ReadAt(body, offset); err != nil {
+			return fmt.Errorf("read %s chunk: %w", id, err)
+		}
+
+		switch id {
+		case "LIST":
+			if len(body) < 4 {
+				return nil
+			}
+			listType := string(body[:4])
+			walkSubchunks(body[4:], func(id string, body []byte) {
+				text := strings.TrimRight(string(body), "\x00")
+				switch {
+				case listType == "INFO" && id == "INAM":
+					meta.Name = text
+				case listType == "INFO" && id == "IART":
+					meta.Artist = text
+				case listType == "INFO" && id == "ICMT":
+					meta.Comment = text
+				case listType == "INFO" && id == "ISFT":
+					meta.Software = text
+				case listType == "adtl" && id == "labl" && len(body) >= 4:
+					labels[int(binary.LittleEndian.Uint32(body))] = strings.TrimRight(string(body[4:]), "\x00")
+				}
+			})
+		case "bext":
+			meta.Broadcast, err = parseBextChunk(body)
+			return err
+		case "iXML":
+			var doc ixmlDocument
+			if err := xml.Unmarshal(body, &doc); err != nil {
+				return fmt.Errorf("parse iXML chunk: %w", err)
+			}
+			meta.Scene, meta.Take, meta.Tape = doc.Scene, doc.Take, doc.Tape
+			for _, track := range doc.Tracks.Tracks {
+				meta.Tracks = append(meta.Tracks, track.Name)
+			}
+			if doc.User != "" {
+				var recording FileMetadata
+				if err := json.Unmarshal([]byte(doc.User), &recording); err != nil {
+					return fmt.Errorf("parse iXML USER: %w", err)
+				}
+				meta.Recording = &recording
+			}
+		case "cue ":
+			if len(body) < 4 {
+				return fmt.Errorf("short cue chunk")
+			}
+			count := int(binary.LittleEndian.Uint32(body))
+			points := body[4:]
+			if len(points) < 24*count {
+				return fmt.Errorf("short cue chunk")
+			}
+			for i := 0; i < count; i++ {
+				point := points[24*i:]
+				meta.Markers = append(meta.Markers, Marker{
+					ID:    int(binary.LittleEndian.Uint32(point)),
+					Frame: int64(binary.LittleEndian.Uint32(point[20:])),
+				})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i := range meta.Markers {
+		meta.Markers[i].Label = labels[meta.Markers[i].ID]
+	}
+	return meta, nil
+}
+
+// walkSubchunks calls fn with each chunk packed in the body of a LIST
+// chunk, stopping at one that runs past the end.
+func walkSubchunks(body []byte, fn func(id string, body []byte)) {
+	for len(body) >= 8 {
+		size := int(binary.LittleEndian.Uint32(body[4:8]))
+		if size > len(body)-8 {
+			return
+		}
+		fn(string(body[:4]), body[8:8+size])
+		body = body[min(len(body), 8+size+size%2):]
+	}
+}
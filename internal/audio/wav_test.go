@@ -0,0 +1,123 @@
+package audio
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func testMetadata() *FileMetadata {
+	return &FileMetadata{
+		SessionID:     "bwf-test",
+		PiID:          "pi07",
+		DeviceName:    "Fake sine",
+		StartTime:     time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC),
+		ChannelLabels: []string{"client", "practitioner"},
+		Software:      "aihub-recorder test",
+	}
+}
+
+func TestBroadcastWaveRoundTrip(t *testing.T) {
+	meta := testMetadata()
+	af, path := newTestRecorder(t, true, func(af *AIFFAudioFormat) { af.SetMetadata(meta) })
+	stop := startRecording(af)
+	waitFrames(t, af, 4800)
+	marker := af.AddMarker("question", nil)
+	waitFrames(t, af, 9600)
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	ar, err := OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ar.Close()
+	if ar.Format != "wav" || ar.Channel != 2 || ar.SampleRate != 48000 || ar.NumFrames != af.Stats().Frames {
+		t.Errorf("read %s, %d channels at %g Hz, %d frames; recorded %d frames", ar.Format, ar.Channel, ar.SampleRate, ar.NumFrames, af.Stats().Frames)
+	}
+	if info, err := Verify(path); err != nil || len(info.Problems) > 0 {
+		t.Errorf("Verify: %v %v", err, info.Problems)
+	}
+
+	got, err := ReadWAVMetadata(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bext := got.Broadcast
+	if bext == nil {
+		t.Fatal("no bext chunk")
+	}
+	for _, field := range []struct{ name, got, want string }{
+		{"INAM", got.Name, "bwf-test"},
+		{"IART", got.Artist, "Pi pi07"},
+		{"ISFT", got.Software, "aihub-recorder test"},
+		{"bext originator", bext.Originator, "Pi pi07"},
+		{"bext originator reference", bext.OriginatorReference, "bwf-test"},
+		{"bext origination date", bext.OriginationDate, "2026-10-19"},
+		{"bext origination time", bext.OriginationTime, "09:30:00"},
+		{"bext coding history", bext.CodingHistory, "A=PCM,F=48000,W=32,M=stereo,T=aihub-recorder test"},
+		{"iXML scene", got.Scene, "bwf-test"},
+		{"iXML tape", got.Tape, "pi07"},
+		{"iXML tracks", strings.Join(got.Tracks, ","), "client,practitioner"},
+	} {
+		if field.got != field.want {
+			t.Errorf("%s = %q, want %q", field.name, field.got, field.want)
+		}
+	}
+	if want := uint64(9.5 * 3600 * 48000); bext.TimeReference != want {
+		t.Errorf("bext time reference %d, want %d", bext.TimeReference, want)
+	}
+	if bext.Version != 1 || got.Take != 1 {
+		t.Errorf("bext version %d, iXML take %d; want 1 and 1", bext.Version, got.Take)
+	}
+	if got.Recording == nil || got.Recording.SessionID != meta.SessionID || !got.Recording.StartTime.Equal(meta.StartTime) {
+		t.Errorf("iXML USER = %+v, want %+v", got.Recording, meta)
+	}
+	if len(got.Markers) != 1 || got.Markers[0].ID != marker.ID || got.Markers[0].Frame != marker.Frame || got.Markers[0].Label != "question" {
+		t.Errorf("markers %+v, want %+v", got.Markers, marker)
+	}
+}
+
+// TestWriteBroadcastWave checks the chunks added to a processed file,
+// whose first frame comes later than the recording's.
+func TestWriteBroadcastWave(t *testing.T) {
+	af, path := newTestRecorder(t, false, nil)
+	stop := startRecording(af)
+	waitFrames(t, af, 4800)
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+	wavPath := strings.TrimSuffix(path, ".aiff") + ".wav"
+	if _, err := Convert(path, wavPath, ConvertOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	meta := testMetadata()
+	if err := WriteFileMetadata(wavPath, *meta); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteBroadcastWave(wavPath, *meta, 1500*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteBroadcastWave(wavPath, *meta, 0); err == nil {
+		t.Error("second bext chunk was added")
+	}
+
+	got, err := ReadWAVMetadata(wavPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != meta.SessionID || got.Broadcast == nil {
+		t.Fatalf("read %+v", got)
+	}
+	if want := uint64((9.5*3600 + 1.5) * 48000); got.Broadcast.TimeReference != want {
+		t.Errorf("bext time reference %d, want %d", got.Broadcast.TimeReference, want)
+	}
+	if got.Broadcast.OriginationTime != "09:30:01" {
+		t.Errorf("bext origination time %s, want 09:30:01", got.Broadcast.OriginationTime)
+	}
+	if info, err := Verify(wavPath); err != nil || len(info.Problems) > 0 {
+		t.Errorf("Verify: %v %v", err, info.Problems)
+	}
+}
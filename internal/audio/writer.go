@@ -0,0 +1,247 @@
+package audio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrOverflow is returned by CaptureStream.Read when the device dropped
+// input before the frames in buf because they were not read in time.
+// buf is still filled and recording continues.
+var ErrOverflow = errors.New("input overflow")
+
+// maxCaptureEvents bounds CaptureStats.Events for very unstable devices;
+// the counters keep counting past it.
+const maxCaptureEvents = 1000
+
+// diskWriteSize is how much encoded audio is collected before it is
+// written to a file. It is independent of the device buffer size, which
+// is kept small for latency and would otherwise mean hundreds of tiny
+// writes per second per device.
+const diskWriteSize = 64 * 1024
+
+// CaptureStats counts the audio a recording lost.
+type CaptureStats struct {
+	// Frames is the number of frames captured into the file so far,
+	// including silence inserted after a reconnect.
+	Frames int64 `json:"frames"`
+	// Overflows counts device overflows. The device does not say how
+	// many frames each one lost.
+	Overflows int `json:"overflows"`
+	// DroppedFrames counts frames read from the device but discarded
+	// because the disk writer fell too far behind.
+	DroppedFrames int64          `json:"dropped_frames"`
+	Events        []CaptureEvent `json:"events,omitempty"`
+}
+
+// CaptureEvent marks a gap in a recording.
+type CaptureEvent struct {
+	// Type is "overflow" or "dropped".
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	// Frame is the position in the file where audio is missing.
+	Frame int64 `json:"frame"`
+	// Frames is the number of frames dropped there; 0 for an overflow.
+	Frames int64 `json:"frames,omitempty"`
+}
+
+type captureCounter struct {
+	mu    sync.Mutex
+	stats CaptureStats
+}
+
+func (c *captureCounter) captured(frames int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.Frames += frames
+}
+
+func (c *captureCounter) overflow() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.Overflows++
+	c.addEvent(CaptureEvent{Type: "overflow", Time: time.Now(), Frame: c.stats.Frames})
+}
+
+// dropped counts frames that never reached the file. Drops at the same
+// file position belong to one stall and are merged into one event.
+func (c *captureCounter) dropped(frames int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.DroppedFrames += frames
+	if n := len(c.stats.Events); n > 0 {
+		last := &c.stats.Events[n-1]
+		if last.Type == "dropped" && last.Frame == c.stats.Frames {
+			last.Frames += frames
+			return
+		}
+	}
+	c.addEvent(CaptureEvent{Type: "dropped", Time: time.Now(), Frame: c.stats.Frames, Frames: frames})
+}
+
+func (c *captureCounter) addEvent(event CaptureEvent) {
+	if len(c.stats.Events) < maxCaptureEvents {
+		c.stats.Events = append(c.stats.Events, event)
+	}
+}
+
+func (c *captureCounter) snapshot() CaptureStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Events = append([]CaptureEvent(nil), c.stats.Events...)
+	return stats
+}
+
+// encodeSamples packs samples into dst as 32-bit big-endian PCM, growing
+// dst when needed, and returns the packed bytes.
+func encodeSamples(dst []byte, samples []int32) []byte {
+	n := 4 * len(samples)
+	if cap(dst) < n {
+		dst = make([]byte, n)
+	}
+	dst = dst[:n]
+	// PutUint32 compiles to a single byte-swapping store, unlike
+	// binary.Write, which goes through reflection and allocates.
+	for i, s := range samples {
+		binary.BigEndian.PutUint32(dst[4*i:], uint32(s))
+	}
+	return dst
+}
+
+// encodeSamplesLE is encodeSamples for little-endian PCM.
+func encodeSamplesLE(dst []byte, samples []int32) []byte {
+	n := 4 * len(samples)
+	if cap(dst) < n {
+		dst = make([]byte, n)
+	}
+	dst = dst[:n]
+	for i, s := range samples {
+		binary.LittleEndian.PutUint32(dst[4*i:], uint32(s))
+	}
+	return dst
+}
+
+// writeBlock is one unit of work for the disk writer: captured samples,
+// or a run of silent frames.
+type writeBlock struct {
+	samples []int32
+	silence int64
+}
+
+// blockWriter writes captured blocks to disk on its own goroutine, so a
+// slow SD card delays the file instead of the device reads. Blocks come
+// from a fixed pool; when the pool is empty the writer is behind by the
+// whole queue and the capture loop drops the block.
+type blockWriter struct {
+	w        *bufio.Writer
+	encode   func(dst []byte, samples []int32) []byte
+	channels int
+	// buf holds the encoding of one block and is reused for every block.
+	buf   []byte
+	free  chan []int32
+	queue chan writeBlock
+	done  chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+func newBlockWriter(w io.Writer, encode func(dst []byte, samples []int32) []byte, channels, blockSamples, blocks int) *blockWriter {
+	bw := &blockWriter{
+		w:        bufio.NewWriterSize(w, diskWriteSize),
+		encode:   encode,
+		channels: channels,
+		buf:      make([]byte, 4*blockSamples),
+		free:     make(chan []int32, blocks),
+		queue:    make(chan writeBlock, blocks+1),
+		done:     make(chan struct{}),
+	}
+	for i := 0; i < blocks; i++ {
+		bw.free <- make([]int32, blockSamples)
+	}
+	go bw.run()
+	return bw
+}
+
+// get returns a free block, or nil when all blocks are queued.
+func (bw *blockWriter) get() []int32 {
+	select {
+	case b := <-bw.free:
+		return b
+	default:
+		return nil
+	}
+}
+
+func (bw *blockWriter) put(samples []int32) {
+	bw.queue <- writeBlock{samples: samples}
+}
+
+func (bw *blockWriter) putSilence(frames int64) {
+	bw.queue <- writeBlock{silence: frames}
+}
+
+func (bw *blockWriter) run() {
+	defer close(bw.done)
+
+	var silence []byte
+	for block := range bw.queue {
+		// After a failure blocks are only recycled, so capture never
+		// stalls on a writer that gave up.
+		if bw.Err() == nil {
+			var err error
+			if block.samples != nil {
+				bw.buf = bw.encode(bw.buf, block.samples)
+				_, err = bw.w.Write(bw.buf)
+			} else {
+				if silence == nil {
+					silence = make([]byte, 4*readChunkFrames*bw.channels)
+				}
+				for left := block.silence; left > 0 && err == nil; left -= readChunkFrames {
+					n := min(left, readChunkFrames)
+					_, err = bw.w.Write(silence[:4*n*int64(bw.channels)])
+				}
+			}
+			if err != nil {
+				bw.setErr(err)
+			}
+		}
+		if block.samples != nil {
+			// Blocks may have been queued short; they go back whole.
+			bw.free <- block.samples[:cap(block.samples)]
+		}
+	}
+
+	if bw.Err() == nil {
+		if err := bw.w.Flush(); err != nil {
+			bw.setErr(err)
+		}
+	}
+}
+
+func (bw *blockWriter) setErr(err error) {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+	bw.err = err
+}
+
+// Err returns the first write error.
+func (bw *blockWriter) Err() error {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+	return bw.err
+}
+
+// Close writes out everything queued and returns the first write error.
+// The file below counts what actually reached it, so the header never
+// claims audio that is missing.
+func (bw *blockWriter) Close() error {
+	close(bw.queue)
+	<-bw.done
+	return bw.Err()
+}
@@ -0,0 +1,49 @@
+package audio
+
+import (
+	"io"
+	"testing"
+)
+
+// benchBlock returns one 64-frame stereo buffer, the default device
+// buffer, filled with a ramp.
+func benchBlock() []int32 {
+	samples := make([]int32, 64*2)
+	for i := range samples {
+		samples[i] = int32(i) << 20
+	}
+	return samples
+}
+
+func BenchmarkEncodeSamples(b *testing.B) {
+	samples := benchBlock()
+	var buf []byte
+	b.SetBytes(int64(4 * len(samples)))
+	b.ReportAllocs()
+	for b.Loop() {
+		buf = encodeSamples(buf, samples)
+	}
+}
+
+// BenchmarkBlockWriter measures the disk writer's throughput from the
+// capture side: taking a free block, filling it and queueing it, with
+// the writer goroutine encoding into a discarded file.
+func BenchmarkBlockWriter(b *testing.B) {
+	src := benchBlock()
+	bw := newBlockWriter(io.Discard, encodeSamples, 2, len(src), 64)
+	b.SetBytes(int64(4 * len(src)))
+	b.ReportAllocs()
+	for b.Loop() {
+		block := bw.get()
+		for block == nil {
+			// The writer is behind by the whole pool; wait for it
+			// instead of dropping, so every block is counted.
+			block = <-bw.free
+		}
+		copy(block, src)
+		bw.put(block)
+	}
+	if err := bw.Close(); err != nil {
+		b.Fatal(err)
+	}
+}
@@ -4,11 +4,22 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 )
 
 var BackendHost = "aeronsarondo.site"
 var WebSocketPath = "/ws"
 var ReconnectSeconds = 5
+var UploadURL = "http://aeronsarondo.site/db/audio"
+var DeviceWatchSeconds = 2
+
+// Version is written into every recording. Release builds set it with
+// -ldflags "-X github.com/otis-co-ltd/aihub-recorder/internal/config.Version=<version>".
+var Version = "1.0.0"
+
+// CaptureRateNative as SYS_CAPTURE_SAMPLE_RATE opens each device at its
+// own default rate.
+const CaptureRateNative = -1
 
 type Config struct {
 	SYS_TCP_PORT                uint8
@@ -18,17 +29,85 @@ type Config struct {
 	SYS_AUDIO_SAMPLE_RATE       float64
 	SYS_AUDIO_INPUT_BUFFER_SIZE int
 	SYS_ENABLE_DENOISING        bool
+	SYS_LOUDNESS_NORMALIZE      bool
+	SYS_LOUDNESS_TARGET_LUFS    float64
+	SYS_LOUDNESS_TRUE_PEAK_DBTP float64
+	SYS_TRIM_SILENCE            bool
+	SYS_TRIM_THRESHOLD_DBFS     float64
+	SYS_TRIM_MIN_SILENCE_MS     int
+	SYS_AGC_ENABLE              bool
+	SYS_AGC_TARGET_DBFS         float64
+	SYS_AGC_MAX_GAIN_DB         float64
+	SYS_AGC_ATTACK_MS           int
+	SYS_AGC_RELEASE_MS          int
+	SYS_SPLIT_CHANNELS          bool
+	SYS_CHANNEL_LABELS          map[string][]string
+	SYS_CHANNEL_MAP             map[string][]int
+	SYS_CAPTURE_BACKEND         string
+	SYS_FAKE_SOURCES            string
+	SYS_ALSA_PERIOD_FRAMES      int
+	SYS_ALSA_PERIODS            int
+	SYS_DEVICE_ALIASES          string
+	SYS_RECOVERY_MODE           string
+	SYS_RECOVERY_TIMEOUT_S      int
+	SYS_WRITE_BUFFER_MS         int
+	SYS_MAX_DURATION_S          int
+	SYS_SEGMENT_SECONDS         int
+	SYS_SEGMENT_MB              int
+	SYS_WAV_BROADCAST           bool
+	SYS_CAPTURE_SAMPLE_RATE     float64
+	SYS_UPLOAD_SAMPLE_RATE      float64
 }
 
 func Load() *Config {
 
 	cfgRecordPath := loadEnv("SYS_RECORD_PATH", "./recordings")
-	cfgAudioType := loadEnv("SYS_AUDIO_TYPE", "1")
+	cfgAudioType := loadEnv("SYS_AUDIO_TYPE", "0")
 	cfgAudioChannel := loadEnv("SYS_AUDIO_CHANNEL", "1")
 	cfgAudioSampleRate := loadEnv("SYS_AUDIO_SAMPLE_RATE", "48000")
 	cfgAudioInputBufferSize := loadEnv("SYS_AUDIO_INPUT_BUFFER_SIZE", "64")
 	cfgEnableDenoising := loadEnv("SYS_ENABLE_DENOISING", "true")
 	enableDenoising := cfgEnableDenoising == "true" || cfgEnableDenoising == "1"
+	cfgLoudnessNormalize := loadEnv("SYS_LOUDNESS_NORMALIZE", "false")
+	loudnessNormalize := cfgLoudnessNormalize == "true" || cfgLoudnessNormalize == "1"
+	cfgLoudnessTarget := loadEnv("SYS_LOUDNESS_TARGET_LUFS", "-23")
+	cfgLoudnessTruePeak := loadEnv("SYS_LOUDNESS_TRUE_PEAK_DBTP", "-1")
+	cfgTrimSilence := loadEnv("SYS_TRIM_SILENCE", "false")
+	trimSilence := cfgTrimSilence == "true" || cfgTrimSilence == "1"
+	cfgTrimThreshold := loadEnv("SYS_TRIM_THRESHOLD_DBFS", "-50")
+	cfgTrimMinSilence := loadEnv("SYS_TRIM_MIN_SILENCE_MS", "2000")
+	cfgAGCEnable := loadEnv("SYS_AGC_ENABLE", "false")
+	agcEnable := cfgAGCEnable == "true" || cfgAGCEnable == "1"
+	cfgAGCTarget := loadEnv("SYS_AGC_TARGET_DBFS", "-20")
+	cfgAGCMaxGain := loadEnv("SYS_AGC_MAX_GAIN_DB", "30")
+	cfgAGCAttack := loadEnv("SYS_AGC_ATTACK_MS", "10")
+	cfgAGCRelease := loadEnv("SYS_AGC_RELEASE_MS", "1000")
+	cfgSplitChannels := loadEnv("SYS_SPLIT_CHANNELS", "false")
+	splitChannels := cfgSplitChannels == "true" || cfgSplitChannels == "1"
+	cfgCaptureBackend := loadEnv("SYS_CAPTURE_BACKEND", "portaudio")
+	cfgFakeSources := loadEnv("SYS_FAKE_SOURCES", "sine:440")
+	cfgALSAPeriodFrames := loadEnv("SYS_ALSA_PERIOD_FRAMES", "1024")
+	cfgALSAPeriods := loadEnv("SYS_ALSA_PERIODS", "4")
+	cfgDeviceAliases := loadEnv("SYS_DEVICE_ALIASES", "./device_aliases.json")
+	cfgRecoveryMode := loadEnv("SYS_RECOVERY_MODE", "off")
+	cfgRecoveryTimeout := loadEnv("SYS_RECOVERY_TIMEOUT_S", "120")
+	cfgWriteBuffer := loadEnv("SYS_WRITE_BUFFER_MS", "10000")
+	cfgMaxDuration := loadEnv("SYS_MAX_DURATION_S", "0")
+	cfgSegmentSeconds := loadEnv("SYS_SEGMENT_SECONDS", "0")
+	cfgSegmentMB := loadEnv("SYS_SEGMENT_MB", "0")
+	cfgWAVBroadcast := loadEnv("SYS_WAV_BROADCAST", "false")
+	wavBroadcast := cfgWAVBroadcast == "true" || cfgWAVBroadcast == "1"
+	cfgCaptureSampleRate := loadEnv("SYS_CAPTURE_SAMPLE_RATE", "0")
+	cfgUploadSampleRate := loadEnv("SYS_UPLOAD_SAMPLE_RATE", "0")
+	channelLabels := parseDeviceLists(os.Getenv("SYS_CHANNEL_LABELS"), "SYS_CHANNEL_LABELS")
+	channelMap := make(map[string][]int)
+	for device, list := range parseDeviceLists(os.Getenv("SYS_CHANNEL_MAP"), "SYS_CHANNEL_MAP") {
+		for _, item := range list {
+			ch, err := strconv.Atoi(item)
+			must(err)
+			channelMap[device] = append(channelMap[device], ch)
+		}
+	}
 
 	audioType, err := strconv.Atoi(cfgAudioType)
 	must(err)
@@ -45,6 +124,66 @@ func Load() *Config {
 	must(err)
 	sysAudioInputBufferSize := audioInputBufferSize // int now
 
+	loudnessTarget, err := strconv.ParseFloat(cfgLoudnessTarget, 64)
+	must(err)
+
+	loudnessTruePeak, err := strconv.ParseFloat(cfgLoudnessTruePeak, 64)
+	must(err)
+
+	trimThreshold, err := strconv.ParseFloat(cfgTrimThreshold, 64)
+	must(err)
+
+	trimMinSilence, err := strconv.Atoi(cfgTrimMinSilence)
+	must(err)
+
+	agcTarget, err := strconv.ParseFloat(cfgAGCTarget, 64)
+	must(err)
+
+	agcMaxGain, err := strconv.ParseFloat(cfgAGCMaxGain, 64)
+	must(err)
+
+	agcAttack, err := strconv.Atoi(cfgAGCAttack)
+	must(err)
+
+	agcRelease, err := strconv.Atoi(cfgAGCRelease)
+	must(err)
+
+	alsaPeriodFrames, err := strconv.Atoi(cfgALSAPeriodFrames)
+	must(err)
+
+	alsaPeriods, err := strconv.Atoi(cfgALSAPeriods)
+	must(err)
+
+	switch cfgRecoveryMode {
+	case "off", "silence", "marker":
+	default:
+		panic(fmt.Sprintf("SYS_RECOVERY_MODE must be off, silence or marker, got %q", cfgRecoveryMode))
+	}
+
+	recoveryTimeout, err := strconv.Atoi(cfgRecoveryTimeout)
+	must(err)
+
+	writeBuffer, err := strconv.Atoi(cfgWriteBuffer)
+	must(err)
+
+	maxDuration, err := strconv.Atoi(cfgMaxDuration)
+	must(err)
+
+	segmentSeconds, err := strconv.Atoi(cfgSegmentSeconds)
+	must(err)
+
+	segmentMB, err := strconv.Atoi(cfgSegmentMB)
+	must(err)
+
+	captureSampleRate := float64(CaptureRateNative)
+	if cfgCaptureSampleRate != "native" {
+		captureSampleRate, err = strconv.ParseFloat(cfgCaptureSampleRate, 64)
+		must(err)
+	}
+
+	uploadSampleRate, err := strconv.ParseFloat(cfgUploadSampleRate, 64)
+	must(err)
+
 	return &Config{
 		SYS_RECORD_PATH:             cfgRecordPath,
 		SYS_AUDIO_TYPE:              sysAudioType,
@@ -52,9 +191,87 @@ func Load() *Config {
 		SYS_AUDIO_SAMPLE_RATE:       sysAudioSampleRate,
 		SYS_AUDIO_INPUT_BUFFER_SIZE: sysAudioInputBufferSize,
 		SYS_ENABLE_DENOISING:        enableDenoising,
+		SYS_LOUDNESS_NORMALIZE:      loudnessNormalize,
+		SYS_LOUDNESS_TARGET_LUFS:    loudnessTarget,
+		SYS_LOUDNESS_TRUE_PEAK_DBTP: loudnessTruePeak,
+		SYS_TRIM_SILENCE:            trimSilence,
+		SYS_TRIM_THRESHOLD_DBFS:     trimThreshold,
+		SYS_TRIM_MIN_SILENCE_MS:     trimMinSilence,
+		SYS_AGC_ENABLE:              agcEnable,
+		SYS_AGC_TARGET_DBFS:         agcTarget,
+		SYS_AGC_MAX_GAIN_DB:         agcMaxGain,
+		SYS_AGC_ATTACK_MS:           agcAttack,
+		SYS_AGC_RELEASE_MS:          agcRelease,
+		SYS_SPLIT_CHANNELS:          splitChannels,
+		SYS_CHANNEL_LABELS:          channelLabels,
+		SYS_CHANNEL_MAP:             channelMap,
+		SYS_CAPTURE_BACKEND:         cfgCaptureBackend,
+		SYS_FAKE_SOURCES:            cfgFakeSources,
+		SYS_ALSA_PERIOD_FRAMES:      alsaPeriodFrames,
+		SYS_ALSA_PERIODS:            alsaPeriods,
+		SYS_DEVICE_ALIASES:          cfgDeviceAliases,
+		SYS_RECOVERY_MODE:           cfgRecoveryMode,
+		SYS_RECOVERY_TIMEOUT_S:      recoveryTimeout,
+		SYS_WRITE_BUFFER_MS:         writeBuffer,
+		SYS_MAX_DURATION_S:          maxDuration,
+		SYS_SEGMENT_SECONDS:         segmentSeconds,
+		SYS_SEGMENT_MB:              segmentMB,
+		SYS_WAV_BROADCAST:           wavBroadcast,
+		SYS_CAPTURE_SAMPLE_RATE:     captureSampleRate,
+		SYS_UPLOAD_SAMPLE_RATE:      uploadSampleRate,
 	}
 }
 
+// parseDeviceLists reads per-device lists in the form
+// "<device name>=<item>,<item>;<device name>=...", for example
+// "USB Condenser Microphone=client,practitioner". An entry without a
+// device name applies to every device without an entry of its own.
+func parseDeviceLists(value, key string) map[string][]string {
+	lists := make(map[string][]string)
+	for _, entry := range strings.Split(value, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		device, list, ok := strings.Cut(entry, "=")
+		if !ok {
+			device, list = "", entry
+		}
+		var items []string
+		for _, item := range strings.Split(list, ",") {
+			items = append(items, strings.TrimSpace(item))
+		}
+		if len(items) == 0 || items[0] == "" {
+			panic(fmt.Sprintf("invalid %s entry %q", key, entry))
+		}
+		lists[strings.TrimSpace(device)] = items
+	}
+	return lists
+}
+
+// lookupDevice returns the entry whose key is the longest case-insensitive
+// substring of deviceName, matching like device name lookups do.
+func lookupDevice[T any](lists map[string][]T, deviceName string) []T {
+	name := strings.ToLower(deviceName)
+	var best []T
+	bestLen := -1
+	for device, list := range lists {
+		if len(device) > bestLen && strings.Contains(name, strings.ToLower(device)) {
+			best, bestLen = list, len(device)
+		}
+	}
+	return best
+}
+
+// ChannelLabelsFor returns the configured channel labels for a device.
+func (c *Config) ChannelLabelsFor(deviceName string) []string {
+	return lookupDevice(c.SYS_CHANNEL_LABELS, deviceName)
+}
+
+// ChannelMapFor returns the configured 1-based channel map for a device.
+func (c *Config) ChannelMapFor(deviceName string) []int {
+	return lookupDevice(c.SYS_CHANNEL_MAP, deviceName)
+}
+
 func loadEnv(key, defaultValue string) string {
 	cfg := os.Getenv(key)
 	if cfg == "" {
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestChannelMapFor(t *testing.T) {
+	c := &Config{SYS_CHANNEL_MAP: map[string][]int{}}
+	for device, list := range parseDeviceLists("3,4; USB Audio=2,1 ;usb audio codec=5;Scarlett 4i4=1, 3", "SYS_CHANNEL_MAP") {
+		for _, item := range list {
+			ch, err := strconv.Atoi(item)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.SYS_CHANNEL_MAP[device] = append(c.SYS_CHANNEL_MAP[device], ch)
+		}
+	}
+
+	for _, test := range []struct {
+		device string
+		want   []int
+	}{
+		{"USB Audio Device: - (hw:1,0)", []int{2, 1}},
+		{"usb audio CODEC (hw:2,0)", []int{5}},
+		{"Focusrite Scarlett 4i4 USB", []int{1, 3}},
+		{"Built-in Microphone", []int{3, 4}},
+	} {
+		if got := c.ChannelMapFor(test.device); !slices.Equal(got, test.want) {
+			t.Errorf("ChannelMapFor(%q) = %v, want %v", test.device, got, test.want)
+		}
+	}
+
+	if got := (&Config{}).ChannelMapFor("USB Audio"); got != nil {
+		t.Errorf("ChannelMapFor without a map = %v", got)
+	}
+}
+
+func TestParseDeviceListsInvalid(t *testing.T) {
+	for _, value := range []string{"USB Audio=", "USB Audio=;", "=,1"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%q was accepted", value)
+				}
+			}()
+			parseDeviceLists(value, "SYS_CHANNEL_MAP")
+		}()
+	}
+}
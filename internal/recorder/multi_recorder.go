@@ -1,12 +1,16 @@
 package recorder
 
 import (
+	"encoding/json"
 	"fmt"
+	"log"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/otis-co-ltd/aihub-recorder/internal/audio"
 	"github.com/otis-co-ltd/aihub-recorder/internal/config"
+	"github.com/otis-co-ltd/aihub-recorder/internal/pi"
 )
 
 var sessionManager *SessionManager
@@ -15,28 +19,69 @@ var cfg *config.Config
 func init() {
 	cfg = config.Load()
 	sessionManager = NewSessionManager()
+
+	backend, err := audio.NewCaptureBackend(cfg.SYS_CAPTURE_BACKEND, audio.BackendOptions{
+		FakeSources:      cfg.SYS_FAKE_SOURCES,
+		ALSAPeriodFrames: cfg.SYS_ALSA_PERIOD_FRAMES,
+		ALSAPeriods:      cfg.SYS_ALSA_PERIODS,
+	})
+	if err != nil {
+		panic(err)
+	}
+	audio.SetCaptureBackend(backend)
+	audio.SetDeviceAliasFile(cfg.SYS_DEVICE_ALIASES)
 }
 
 func GetSessionManager() *SessionManager {
 	return sessionManager
 }
 
+// GetConfig returns the configuration the recorder was set up with.
+func GetConfig() *config.Config {
+	return cfg
+}
+
 func getAudioTypeString(audioType uint8) string {
 	switch audioType {
 	case 0:
 		return "aiff"
 
+	case 1:
+		return "wav"
+
 	default:
 		return "aiff"
 	}
 }
 
-func StartSession(sessionID string, deviceIndex int) error {
+// SessionOptions holds the optional settings of a start command.
+type SessionOptions struct {
+	// ChannelLabels names the recorded channels in order. When empty the
+	// labels configured for the device in SYS_CHANNEL_LABELS are used.
+	ChannelLabels []string
+	// ChannelMap selects which 1-based device channels are recorded, in
+	// file order. When empty the map configured in SYS_CHANNEL_MAP is used,
+	// and without one the first SYS_AUDIO_CHANNEL channels are recorded.
+	ChannelMap []int
+	// MaxDuration stops the session on its own once it has recorded this
+	// long. Zero uses SYS_MAX_DURATION_S.
+	MaxDuration time.Duration
+}
+
+// AutoStopMaxDuration is the AutoStopReason of a session that reached
+// its maximum duration.
+const AutoStopMaxDuration = "max_duration"
+
+func StartSession(sessionID string, deviceIndex int, opts SessionOptions) error {
 	// [STEP 1] Check if session already exists
 	if _, err := sessionManager.GetSession(sessionID); err == nil {
 		return fmt.Errorf("session %s already recording", sessionID)
 	}
 
+	if opts.MaxDuration < 0 {
+		return fmt.Errorf("invalid max duration %s", opts.MaxDuration)
+	}
+
 	// [STEP 2] Create new session
 	session, err := sessionManager.CreateSession(sessionID, deviceIndex)
 	if err != nil {
@@ -47,9 +92,102 @@ func StartSession(sessionID string, deviceIndex int) error {
 	audioTypeStr := getAudioTypeString(cfg.SYS_AUDIO_TYPE)
 	session.Recorder = audio.NewAudioInstance(audioTypeStr)
 
+	// [STEP 3.1] Write Broadcast Wave files if configured
+	if wav, ok := session.Recorder.(*audio.WAVAudioFormat); ok {
+		wav.SetBroadcastWave(cfg.SYS_WAV_BROADCAST)
+	}
+
 	// [STEP 4] Set the microphone index BEFORE initializing
 	session.Recorder.SetDeviceIndex(deviceIndex)
 
+	// [STEP 4.1] Look up the device; its stable ID goes into the report
+	var device *audio.AudioDevice
+	if deviceIndex >= 0 {
+		device, err = audio.GetDeviceByIndex(deviceIndex)
+	} else {
+		device, err = audio.GetDefaultInputDevice()
+	}
+	if err != nil {
+		sessionManager.RemoveSession(sessionID)
+		return fmt.Errorf("look up device: %w", err)
+	}
+	session.DeviceID = device.ID
+	session.DeviceAlias = device.Alias
+
+	// [STEP 4.2] Resolve channel map and labels from the command or the device config
+	if err := resolveChannels(session, device, opts); err != nil {
+		sessionManager.RemoveSession(sessionID)
+		return err
+	}
+	session.Recorder.SetChannelMap(session.ChannelMap)
+
+	// [STEP 4.3] Attach automatic gain control if enabled
+	if cfg.SYS_AGC_ENABLE {
+		session.AGC = audio.NewAutoGainControl(audio.AGCConfig{
+			TargetDBFS: cfg.SYS_AGC_TARGET_DBFS,
+			MaxGainDB:  cfg.SYS_AGC_MAX_GAIN_DB,
+			Attack:     time.Duration(cfg.SYS_AGC_ATTACK_MS) * time.Millisecond,
+			Release:    time.Duration(cfg.SYS_AGC_RELEASE_MS) * time.Millisecond,
+		}, session.Channels, cfg.SYS_AUDIO_SAMPLE_RATE)
+		session.Recorder.SetGainControl(session.AGC)
+	}
+
+	// [STEP 4.4] Keep recording through device disconnects if configured
+	if cfg.SYS_RECOVERY_MODE != "off" {
+		session.Recorder.SetRecovery(&audio.RecoveryPolicy{
+			FillGap:      cfg.SYS_RECOVERY_MODE == "silence",
+			Timeout:      time.Duration(cfg.SYS_RECOVERY_TIMEOUT_S) * time.Second,
+			PollInterval: 500 * time.Millisecond,
+			DeviceID:     session.DeviceID,
+			OnReconnect: func(reconnect audio.Reconnect) {
+				session.AddReconnect(reconnect)
+				notifyReconnect(sessionID, reconnect)
+			},
+		})
+	}
+
+	// [STEP 4.5] Size the queue between capture and disk writes
+	session.Recorder.SetWriteBuffer(time.Duration(cfg.SYS_WRITE_BUFFER_MS) * time.Millisecond)
+
+	// [STEP 4.6] Split long recordings into segments if configured; any
+	// recording is split at the AIFF size limit
+	segmented := cfg.SYS_SEGMENT_SECONDS > 0 || cfg.SYS_SEGMENT_MB > 0
+	session.Recorder.SetSegmenting(&audio.SegmentPolicy{
+		MaxDuration: time.Duration(cfg.SYS_SEGMENT_SECONDS) * time.Second,
+		MaxBytes:    int64(cfg.SYS_SEGMENT_MB) << 20,
+		OnSegment: func(segment audio.Segment) {
+			notifySegment(newSegmentReport(session, segment))
+		},
+	})
+
+	// [STEP 4.7] Describe the recording in the files themselves
+	session.Metadata = &audio.FileMetadata{
+		SessionID:     sessionID,
+		PiID:          pi.GetPiId(),
+		DeviceIndex:   deviceIndex,
+		DeviceName:    device.Name,
+		DeviceID:      device.ID,
+		DeviceAlias:   device.Alias,
+		StartTime:     session.StartTime,
+		ChannelLabels: session.ChannelLabels,
+		Software:      "aihub-recorder " + config.Version,
+	}
+	session.Recorder.SetMetadata(session.Metadata)
+
+	// [STEP 4.8] Capture at another rate than the file's if configured;
+	// the audio is resampled on the way to the disk
+	switch cfg.SYS_CAPTURE_SAMPLE_RATE {
+	case 0:
+	case config.CaptureRateNative:
+		session.CaptureRate = device.DefaultSampleRate
+	default:
+		session.CaptureRate = cfg.SYS_CAPTURE_SAMPLE_RATE
+	}
+	if session.CaptureRate == cfg.SYS_AUDIO_SAMPLE_RATE {
+		session.CaptureRate = 0
+	}
+	session.Recorder.SetCaptureRate(session.CaptureRate)
+
 	// [STEP 5] Create session-specific directory
 	sessionDir := filepath.Join(cfg.SYS_RECORD_PATH, sessionID)
 
@@ -57,55 +195,281 @@ func StartSession(sessionID string, deviceIndex int) error {
 	timestamp := time.Now().Format("20060102_150405")
 	filename := fmt.Sprintf("device_%d_%s", deviceIndex, timestamp)
 
-	expectedFilePath := filepath.Join(sessionDir, fmt.Sprintf("%s.%s", filename, audioTypeStr))
+	// A segmented session starts with the first segment
+	fileName := filename
+	if segmented {
+		fileName = audio.SegmentFileName(filename, 1)
+	}
+	expectedFilePath := filepath.Join(sessionDir, fmt.Sprintf("%s.%s", fileName, audioTypeStr))
 	session.SetFilePath(expectedFilePath)
 
 	// [STEP 7] Initialize recorder with device index
-	session.Recorder.Init(
+	err = session.Recorder.Init(
 		session.Control,
 		sessionDir,
 		filename,
-		int16(cfg.SYS_AUDIO_CHANNEL),
+		int16(session.Channels),
 		float64(cfg.SYS_AUDIO_SAMPLE_RATE),
 		int(cfg.SYS_AUDIO_INPUT_BUFFER_SIZE),
 	)
+	if err != nil {
+		sessionManager.RemoveSession(sessionID)
+		return fmt.Errorf("init recorder: %w", err)
+	}
+
+	// [STEP 7.1] Stop by itself if the backend never sends a stop
+	maxDuration := opts.MaxDuration
+	if maxDuration == 0 {
+		maxDuration = time.Duration(cfg.SYS_MAX_DURATION_S) * time.Second
+	}
+	if maxDuration > 0 {
+		session.StopAfter(maxDuration, func() { autoStop(session) })
+	}
 
 	// [STEP 8] Start recording in a separate goroutine
-	go session.Recorder.Record()
 	session.SetRecording(true)
+	go runRecorder(session)
+
+	return nil
+}
+
+// autoStop stops a session that reached its maximum duration. The
+// report then goes through the same post-processing and upload as a
+// stopped session, via the auto-stop handler.
+func autoStop(session *RecordingSession) {
+	// The timer may fire just as the session is replaced by a new one
+	// with the same id.
+	if current, err := sessionManager.GetSession(session.SessionID); err != nil || current != session {
+		return
+	}
+
+	log.Printf("⏱️ Session %s reached its maximum duration of %s", session.SessionID, session.GetMaxDuration())
+	report, err := StopSession(session.SessionID)
+	if err != nil {
+		log.Printf("Auto-stop of session %s: %v", session.SessionID, err)
+		return
+	}
+	report.AutoStopReason = AutoStopMaxDuration
+	notifyEnded(report)
+}
+
+// runRecorder records until the session is stopped. A recorder that ends
+// on its own takes only its session down: the session is stopped here
+// and reported as interrupted or failed.
+func runRecorder(session *RecordingSession) {
+	err := session.Recorder.Record()
+	session.Finish(err)
+	if err == nil {
+		return
+	}
+
+	report, stopErr := StopSession(session.SessionID)
+	if stopErr != nil {
+		// A stop command got there first; its report carries the error.
+		log.Printf("Session %s ended with %v: %v", session.SessionID, err, stopErr)
+		return
+	}
+	notifyEnded(report)
+}
+
+// notifyEnded hands the report of a session that was not stopped by a
+// command to the matching handler. A recorder error wins over an
+// auto-stop that raced with it.
+func notifyEnded(report *SessionReport) {
+	handlerMutex.RLock()
+	var handler func(report *SessionReport)
+	switch {
+	case report.Interrupted:
+		handler = interruptHandler
+	case report.Error != "":
+		handler = failureHandler
+	case report.AutoStopReason != "":
+		handler = autoStopHandler
+	}
+	handlerMutex.RUnlock()
+	if handler != nil {
+		handler(report)
+	}
+}
+
+// resolveChannels decides which device channels the session records and
+// how they are labelled. A channel map is validated against the device's
+// input channel count.
+func resolveChannels(session *RecordingSession, device *audio.AudioDevice, opts SessionOptions) error {
+	session.ChannelMap = opts.ChannelMap
+	session.ChannelLabels = opts.ChannelLabels
+	session.Channels = int(cfg.SYS_AUDIO_CHANNEL)
 
+	if len(session.ChannelMap) == 0 {
+		session.ChannelMap = cfg.ChannelMapFor(device.Name)
+	}
+	if len(session.ChannelLabels) == 0 {
+		session.ChannelLabels = cfg.ChannelLabelsFor(device.Name)
+	}
+
+	if len(session.ChannelMap) > 0 {
+		if err := audio.ValidateChannelMap(session.ChannelMap, device.MaxInputChannels); err != nil {
+			return fmt.Errorf("invalid channel map for %s: %w", device.Name, err)
+		}
+		session.Channels = len(session.ChannelMap)
+	}
 	return nil
 }
 
 // StopSession stops recording for a specific session
-func StopSession(sessionID string) (string, error) {
+func StopSession(sessionID string) (*SessionReport, error) {
 	session, err := sessionManager.GetSession(sessionID)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if !session.IsRecording() {
-		return "", fmt.Errorf("session %s is not recording", sessionID)
+		return nil, fmt.Errorf("session %s is not recording", sessionID)
 	}
-
-	// Send stop signal
-	session.Control.Sig <- audio.AUDIO_CTL_STOP_REC
-
-	// Wait for confirmation
-	<-session.Control.Sig
+	if !session.BeginStop() {
+		return nil, fmt.Errorf("session %s is already stopping", sessionID)
+	}
+	session.CancelAutoStop()
+
+	// Send stop signal, unless the recorder already ended on its own
+	select {
+	case session.Control.Sig <- audio.AUDIO_CTL_STOP_REC:
+		// Wait for confirmation
+		<-session.Control.Sig
+	case <-session.Done():
+	}
+	<-session.Done()
 
 	session.SetRecording(false)
 
-	// Get file path before removing session
-	filePath := session.FilePath
+	// Build the report before removing session
+	report := newSessionReport(session)
 
 	// Remove session from manager
 	sessionManager.RemoveSession(sessionID)
 
-	return filePath, nil
+	return report, nil
+}
+
+// PauseSession stops writing a session's audio until ResumeSession. The
+// device stays open, and the session still ends up as one file with the
+// pause listed in its report.
+func PauseSession(sessionID string) error {
+	return setPaused(sessionID, true)
+}
+
+// ResumeSession continues writing a paused session.
+func ResumeSession(sessionID string) error {
+	return setPaused(sessionID, false)
+}
+
+func setPaused(sessionID string, paused bool) error {
+	session, err := sessionManager.GetSession(sessionID)
+	if err != nil {
+		return err
+	}
+	if !session.IsRecording() {
+		return fmt.Errorf("session %s is not recording", sessionID)
+	}
+	if !session.SetPaused(paused) {
+		if paused {
+			return fmt.Errorf("session %s is already paused", sessionID)
+		}
+		return fmt.Errorf("session %s is not paused", sessionID)
+	}
+	session.Recorder.SetPaused(paused)
+	return nil
 }
 
-func StopAllSessions() (map[string]string, error) {
+// AddMarker marks the current position of a session's recording with a
+// label and an optional JSON payload.
+func AddMarker(sessionID, label string, payload json.RawMessage) (audio.Marker, error) {
+	session, err := sessionManager.GetSession(sessionID)
+	if err != nil {
+		return audio.Marker{}, err
+	}
+	if !session.IsRecording() {
+		return audio.Marker{}, fmt.Errorf("session %s is not recording", sessionID)
+	}
+	if label == "" {
+		return audio.Marker{}, fmt.Errorf("marker label is empty")
+	}
+	return session.Recorder.AddMarker(label, payload), nil
+}
+
+var interruptHandler func(report *SessionReport)
+var failureHandler func(report *SessionReport)
+var handlerMutex sync.RWMutex
+
+// SetInterruptHandler registers the function told about sessions that
+// ended because their device went away. It receives the report of the
+// already stopped session.
+func SetInterruptHandler(handler func(report *SessionReport)) {
+	handlerMutex.Lock()
+	defer handlerMutex.Unlock()
+	interruptHandler = handler
+}
+
+// SetFailureHandler registers the function told about sessions whose
+// recorder failed, e.g. because the device could not be opened or the
+// disk is full. Its report carries the error.
+func SetFailureHandler(handler func(report *SessionReport)) {
+	handlerMutex.Lock()
+	defer handlerMutex.Unlock()
+	failureHandler = handler
+}
+
+var autoStopHandler func(report *SessionReport)
+
+// SetAutoStopHandler registers the function told about sessions that
+// stopped by themselves, e.g. at their maximum duration. The report's
+// AutoStopReason says why.
+func SetAutoStopHandler(handler func(report *SessionReport)) {
+	handlerMutex.Lock()
+	defer handlerMutex.Unlock()
+	autoStopHandler = handler
+}
+
+var segmentHandler func(report *SegmentReport)
+
+// SetSegmentHandler registers the function told about each segment of a
+// segmented session as soon as its file is complete. It is called from
+// the recorder's disk writer and must not block.
+func SetSegmentHandler(handler func(report *SegmentReport)) {
+	handlerMutex.Lock()
+	defer handlerMutex.Unlock()
+	segmentHandler = handler
+}
+
+func notifySegment(report *SegmentReport) {
+	handlerMutex.RLock()
+	handler := segmentHandler
+	handlerMutex.RUnlock()
+	if handler != nil {
+		handler(report)
+	}
+}
+
+var reconnectHandler func(sessionID string, reconnect audio.Reconnect)
+
+// SetReconnectHandler registers the function told when a session's
+// device came back after a disconnect and recording resumed.
+func SetReconnectHandler(handler func(sessionID string, reconnect audio.Reconnect)) {
+	handlerMutex.Lock()
+	defer handlerMutex.Unlock()
+	reconnectHandler = handler
+}
+
+func notifyReconnect(sessionID string, reconnect audio.Reconnect) {
+	handlerMutex.RLock()
+	handler := reconnectHandler
+	handlerMutex.RUnlock()
+	if handler != nil {
+		handler(sessionID, reconnect)
+	}
+}
+
+func StopAllSessions() (map[string]*SessionReport, error) {
 	sm := GetSessionManager()
 
 	sm.mu.RLock()
@@ -115,16 +479,16 @@ func StopAllSessions() (map[string]string, error) {
 	}
 	sm.mu.RUnlock()
 
-	results := make(map[string]string)
+	results := make(map[string]*SessionReport)
 	var lastErr error
 
 	for _, id := range ids {
-		fp, err := StopSession(id)
+		report, err := StopSession(id)
 		if err != nil {
 			lastErr = fmt.Errorf("stop %s: %w", id, err)
 			continue
 		}
-		results[id] = fp
+		results[id] = report
 	}
 
 	return results, lastErr
@@ -134,6 +498,18 @@ func GetActiveSessionCount() int {
 	return sessionManager.GetActiveCount()
 }
 
+// GetSessionStatuses describes the sessions that are recording now.
+func GetSessionStatuses() []*SessionStatus {
+	sessions := sessionManager.GetAllSessions()
+	statuses := make([]*SessionStatus, 0, len(sessions))
+	for _, session := range sessions {
+		if session.IsRecording() {
+			statuses = append(statuses, newSessionStatus(session))
+		}
+	}
+	return statuses
+}
+
 // GetSessionInfo returns information about a specific session
 func GetSessionInfo(sessionID string) (*RecordingSession, error) {
 	return sessionManager.GetSession(sessionID)
@@ -0,0 +1,163 @@
+package recorder
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/otis-co-ltd/aihub-recorder/internal/audio"
+)
+
+// TestMain records from the fake backend into a temporary directory,
+// with post-processing steps that need external tools turned off.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "recorder-test")
+	if err != nil {
+		panic(err)
+	}
+	cfg.SYS_RECORD_PATH = dir
+	cfg.SYS_AUDIO_TYPE = 0
+	cfg.SYS_AUDIO_CHANNEL = 2
+	cfg.SYS_AUDIO_SAMPLE_RATE = 48000
+	cfg.SYS_CAPTURE_SAMPLE_RATE = 0
+	cfg.SYS_ENABLE_DENOISING = false
+	cfg.SYS_MAX_DURATION_S = 0
+	cfg.SYS_SEGMENT_SECONDS = 0
+	cfg.SYS_SEGMENT_MB = 0
+	audio.SetCaptureBackend(audio.NewFakeBackend(audio.FakeSource{Signal: "sine", Frequency: 1000, LevelDBFS: -12}))
+	audio.SetDeviceAliasFile(filepath.Join(dir, "device_aliases.json"))
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// verifyReport checks that the report's file is a valid recording of
+// every frame the session captured.
+func verifyReport(t *testing.T, report *SessionReport) *audio.FileInfo {
+	t.Helper()
+	info, err := audio.Verify(report.FilePath)
+	if err != nil {
+		t.Fatalf("verify %s: %v", report.FilePath, err)
+	}
+	if info.Format != "aiff" || info.Channels != 2 || info.SampleRate != 48000 {
+		t.Errorf("got %s, %d channels, %g Hz, want aiff, 2 channels, 48000 Hz", info.Format, info.Channels, info.SampleRate)
+	}
+	if info.Frames == 0 || info.Frames != report.Capture.Frames {
+		t.Errorf("file has %d frames, report captured %d", info.Frames, report.Capture.Frames)
+	}
+	return info
+}
+
+func TestSessionStartStop(t *testing.T) {
+	if err := StartSession("start-stop", 0, SessionOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := StartSession("start-stop", 0, SessionOptions{}); err == nil {
+		t.Error("starting a session twice succeeded")
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	report, err := StopSession("start-stop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Error != "" || report.Interrupted {
+		t.Fatalf("session ended with error %q, interrupted %v", report.Error, report.Interrupted)
+	}
+	if dir := filepath.Dir(report.FilePath); dir != filepath.Join(cfg.SYS_RECORD_PATH, "start-stop") {
+		t.Errorf("recorded into %s", dir)
+	}
+
+	info := verifyReport(t, report)
+	// The fake device is paced to real time.
+	if info.Seconds < 0.3 || info.Seconds > 1 {
+		t.Errorf("recorded %.2f s in about 0.5 s", info.Seconds)
+	}
+
+	PostProcess(report, func(step string, err error) {
+		t.Errorf("%s failed: %v", step, err)
+	})
+	verifyReport(t, report)
+
+	if _, err := StopSession("start-stop"); err == nil {
+		t.Error("stopping a stopped session succeeded")
+	}
+}
+
+func TestSessionAutoStop(t *testing.T) {
+	ended := make(chan *SessionReport, 1)
+	SetAutoStopHandler(func(report *SessionReport) { ended <- report })
+	defer SetAutoStopHandler(nil)
+
+	if err := StartSession("auto-stop", 0, SessionOptions{MaxDuration: 300 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case report := <-ended:
+		if report.AutoStopReason != AutoStopMaxDuration {
+			t.Errorf("auto-stop reason %q, want %q", report.AutoStopReason, AutoStopMaxDuration)
+		}
+		verifyReport(t, report)
+	case <-time.After(5 * time.Second):
+		t.Fatal("session did not stop by itself")
+	}
+
+	if _, err := GetSessionInfo("auto-stop"); err == nil {
+		t.Error("auto-stopped session is still registered")
+	}
+}
+
+func TestSessionInvalidDevice(t *testing.T) {
+	if err := StartSession("bad-device", 7, SessionOptions{}); err == nil {
+		StopSession("bad-device")
+		t.Fatal("started a session on a device that does not exist")
+	}
+	if _, err := GetSessionInfo("bad-device"); err == nil {
+		t.Error("failed session is still registered")
+	}
+}
+
+func TestResolveChannels(t *testing.T) {
+	channelMap, channelLabels := cfg.SYS_CHANNEL_MAP, cfg.SYS_CHANNEL_LABELS
+	cfg.SYS_CHANNEL_MAP = map[string][]int{"scarlett": {3, 1}}
+	cfg.SYS_CHANNEL_LABELS = map[string][]string{"scarlett": {"client", "practitioner"}}
+	defer func() { cfg.SYS_CHANNEL_MAP, cfg.SYS_CHANNEL_LABELS = channelMap, channelLabels }()
+
+	scarlett := &audio.AudioDevice{Name: "Focusrite Scarlett 4i4", MaxInputChannels: 4}
+	mic := &audio.AudioDevice{Name: "USB Microphone", MaxInputChannels: 1}
+	for _, test := range []struct {
+		name       string
+		device     *audio.AudioDevice
+		opts       SessionOptions
+		channels   int
+		channelMap []int
+		labels     []string
+		ok         bool
+	}{
+		{"configured", scarlett, SessionOptions{}, 2, []int{3, 1}, []string{"client", "practitioner"}, true},
+		{"requested", scarlett, SessionOptions{ChannelMap: []int{4}, ChannelLabels: []string{"room"}}, 1, []int{4}, []string{"room"}, true},
+		{"requested map only", scarlett, SessionOptions{ChannelMap: []int{2, 4}}, 2, []int{2, 4}, []string{"client", "practitioner"}, true},
+		{"no map", mic, SessionOptions{}, int(cfg.SYS_AUDIO_CHANNEL), nil, nil, true},
+		{"out of range", mic, SessionOptions{ChannelMap: []int{2}}, 0, nil, nil, false},
+		{"twice", scarlett, SessionOptions{ChannelMap: []int{1, 1}}, 0, nil, nil, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			session := &RecordingSession{}
+			err := resolveChannels(session, test.device, test.opts)
+			if (err == nil) != test.ok {
+				t.Fatalf("resolveChannels: %v", err)
+			}
+			if !test.ok {
+				return
+			}
+			if session.Channels != test.channels || !slices.Equal(session.ChannelMap, test.channelMap) || !slices.Equal(session.ChannelLabels, test.labels) {
+				t.Errorf("recording %d channels %v labelled %v, want %d channels %v labelled %v",
+					session.Channels, session.ChannelMap, session.ChannelLabels, test.channels, test.channelMap, test.labels)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package recorder
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"path/filepath"
+	"time"
+
+	"github.com/otis-co-ltd/aihub-recorder/internal/audio"
+)
+
+// PostProcess runs the configured processing steps on a stopped session
+// and points the report at the files that should be uploaded. A step
+// that fails is reported through onError and skipped, so the upload falls
+// back to the output of the last step that succeeded.
+//
+// Segmented sessions are left as recorded: their segments are uploaded
+// as they complete, and processing them one by one would break the
+// continuity between them. Every step writes its output in the format of
+// the recording, AIFF or WAV.
+func PostProcess(report *SessionReport, onError func(step string, err error)) {
+	if len(report.Segments) > 0 {
+		return
+	}
+
+	recording := report.FilePath
+
+	if cfg.SYS_SPLIT_CHANNELS && report.Channels > 1 {
+		if err := splitTracks(report); err != nil {
+			log.Printf("Channel split failed: %v, uploading interleaved file", err)
+			onError("split_channels", err)
+		}
+	}
+
+	for _, file := range report.uploadFiles() {
+		processFile(file, onError)
+		if report.Metadata != nil {
+			if err := applyMetadata(file, recording, *report.Metadata); err != nil {
+				log.Printf("Writing metadata failed: %v", err)
+				onError("metadata", err)
+			}
+		}
+		if len(report.Markers) > 0 {
+			if err := applyMarkers(file, recording, report.Markers); err != nil {
+				log.Printf("Writing markers failed: %v", err)
+				onError("markers", err)
+			}
+		}
+	}
+}
+
+// processFile runs the per-file steps on one uploadable file.
+func processFile(file *FileReport, onError func(step string, err error)) {
+	if cfg.SYS_ENABLE_DENOISING {
+		log.Printf("?? Applying RNNoise denoising to: %s", file.FilePath)
+		denoisedPath, err := audio.DenoiseAudioFile(file.FilePath)
+		if err != nil {
+			log.Printf("?? Denoising failed: %v, uploading original file", err)
+			onError("denoise", err)
+		} else {
+			log.Printf("? Denoised audio saved to: %s", denoisedPath)
+			file.FilePath = denoisedPath
+		}
+	}
+
+	if cfg.SYS_TRIM_SILENCE {
+		if err := applyTrim(file); err != nil {
+			log.Printf("Silence trimming failed: %v", err)
+			onError("trim", err)
+		}
+	}
+
+	if cfg.SYS_UPLOAD_SAMPLE_RATE > 0 {
+		if err := applyResample(file); err != nil {
+			log.Printf("Resampling failed: %v", err)
+			onError("resample", err)
+		}
+	}
+
+	if err := applyLoudness(file); err != nil {
+		log.Printf("Loudness processing failed: %v", err)
+		onError("loudness", err)
+	}
+}
+
+// splitTracks de-interleaves the recording into one mono file per channel.
+func splitTracks(report *SessionReport) error {
+	paths, err := audio.SplitChannels(report.FilePath, report.ChannelLabels)
+	if err != nil {
+		return fmt.Errorf("split %s: %w", report.FilePath, err)
+	}
+
+	for i, path := range paths {
+		channel := i + 1
+		if i < len(report.ChannelMap) {
+			channel = report.ChannelMap[i]
+		}
+		track := &TrackReport{
+			Channel: channel,
+			FileReport: FileReport{
+				FilePath:       path,
+				AudioStartTime: report.AudioStartTime,
+			},
+		}
+		if i < len(report.ChannelLabels) {
+			track.Label = report.ChannelLabels[i]
+		}
+		report.Tracks = append(report.Tracks, track)
+	}
+
+	log.Printf("Split %s into %d tracks", report.FilePath, len(paths))
+	return nil
+}
+
+// applyTrim cuts leading and trailing silence and records the offsets of
+// the kept audio relative to the original recording.
+func applyTrim(file *FileReport) error {
+	minSilence := time.Duration(cfg.SYS_TRIM_MIN_SILENCE_MS) * time.Millisecond
+	trimmedPath, trim, err := audio.TrimSilence(file.FilePath, cfg.SYS_TRIM_THRESHOLD_DBFS, minSilence)
+	if err != nil {
+		return fmt.Errorf("trim %s: %w", file.FilePath, err)
+	}
+
+	if trim.Trimmed {
+		log.Printf("Trimmed silence (%.1fs leading, %.1fs trailing): %s",
+			trim.StartOffsetSeconds, trim.TrailingTrimSeconds, trimmedPath)
+	}
+	file.Trim = trim
+	file.FilePath = trimmedPath
+	file.AudioStartTime = file.AudioStartTime.Add(time.Duration(trim.StartOffsetSeconds * float64(time.Second)))
+	return nil
+}
+
+// applyResample converts the file to the upload sample rate.
+func applyResample(file *FileReport) error {
+	resampledPath, err := audio.ResampleFile(file.FilePath, cfg.SYS_UPLOAD_SAMPLE_RATE)
+	if err != nil {
+		return fmt.Errorf("resample %s: %w", file.FilePath, err)
+	}
+	if resampledPath == file.FilePath {
+		return nil
+	}
+
+	log.Printf("Resampled to %g Hz: %s", cfg.SYS_UPLOAD_SAMPLE_RATE, resampledPath)
+	file.SampleRate = cfg.SYS_UPLOAD_SAMPLE_RATE
+	file.FilePath = resampledPath
+	return nil
+}
+
+// applyMetadata writes the session's metadata into a processed file,
+// which starts out without it. A processed Broadcast Wave file also gets
+// its bext and iXML chunks back, timed from its first frame.
+func applyMetadata(file *FileReport, recording string, meta audio.FileMetadata) error {
+	if file.FilePath == recording {
+		return nil
+	}
+	if err := audio.WriteFileMetadata(file.FilePath, meta); err != nil {
+		return fmt.Errorf("write metadata to %s: %w", file.FilePath, err)
+	}
+	if cfg.SYS_WAV_BROADCAST && filepath.Ext(file.FilePath) == ".wav" {
+		offset := file.AudioStartTime.Sub(meta.StartTime)
+		if err := audio.WriteBroadcastWave(file.FilePath, meta, offset); err != nil {
+			return fmt.Errorf("write broadcast chunks to %s: %w", file.FilePath, err)
+		}
+	}
+	return nil
+}
+
+// applyMarkers copies the session's markers into a processed file, moved
+// by the trimmed lead-in and scaled to its sample rate. The rate is read
+// from the file, since denoising changes it as well as resampling. The
+// recording itself got them when it was finalized.
+func applyMarkers(file *FileReport, recording string, markers []audio.Marker) error {
+	if file.FilePath == recording {
+		return nil
+	}
+
+	ar, err := audio.OpenReader(file.FilePath)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", file.FilePath, err)
+	}
+	rate := ar.SampleRate
+	ar.Close()
+
+	var offset float64
+	if file.Trim != nil && file.Trim.Trimmed {
+		offset = file.Trim.StartOffsetSeconds
+	}
+	shifted := make([]audio.Marker, 0, len(markers))
+	for _, marker := range markers {
+		seconds := float64(marker.Frame)/cfg.SYS_AUDIO_SAMPLE_RATE - offset
+		marker.Frame = int64(math.Round(seconds * rate))
+		if marker.Frame >= 0 {
+			shifted = append(shifted, marker)
+		}
+	}
+
+	if err := audio.WriteFileMarkers(file.FilePath, shifted); err != nil {
+		return fmt.Errorf("write markers to %s: %w", file.FilePath, err)
+	}
+	return nil
+}
+
+// applyLoudness measures the recording and, when enabled, normalizes it to
+// the configured target.
+func applyLoudness(file *FileReport) error {
+	if !cfg.SYS_LOUDNESS_NORMALIZE {
+		stats, err := audio.MeasureLoudness(file.FilePath)
+		if err != nil {
+			return err
+		}
+		file.Loudness = &audio.LoudnessReport{Measured: *stats}
+		return nil
+	}
+
+	normalizedPath, loudness, err := audio.NormalizeLoudness(
+		file.FilePath,
+		cfg.SYS_LOUDNESS_TARGET_LUFS,
+		cfg.SYS_LOUDNESS_TRUE_PEAK_DBTP,
+	)
+	if err != nil {
+		return fmt.Errorf("normalize %s: %w", file.FilePath, err)
+	}
+
+	log.Printf("Loudness %.1f LUFS -> %.1f LUFS (gain %.1f dB): %s",
+		loudness.Measured.IntegratedLUFS, cfg.SYS_LOUDNESS_TARGET_LUFS, loudness.GainDB, normalizedPath)
+	file.Loudness = loudness
+	file.FilePath = normalizedPath
+	return nil
+}
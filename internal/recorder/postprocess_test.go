@@ -0,0 +1,81 @@
+package recorder
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/otis-co-ltd/aihub-recorder/internal/audio"
+)
+
+// TestApplyMarkers writes markers into processed copies of a recording
+// whose rate differs from the capture rate, as after denoising (always
+// 48 kHz) or resampling for upload.
+func TestApplyMarkers(t *testing.T) {
+	if err := StartSession("apply-markers", 0, SessionOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	report, err := StopSession("apply-markers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resampled, err := audio.ResampleFile(report.FilePath, 16000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	markers := []audio.Marker{
+		{ID: 1, Frame: 0, Label: "start"},
+		{ID: 2, Frame: 4410, Label: "a"},
+		{ID: 3, Frame: 8820, Label: "b"},
+	}
+	trim := func(seconds float64) *audio.TrimReport {
+		return &audio.TrimReport{Trimmed: true, StartOffsetSeconds: seconds}
+	}
+	for _, test := range []struct {
+		name        string
+		captureRate float64
+		path        string
+		trim        *audio.TrimReport
+		want        []int64
+	}{
+		{"denoised 44.1 kHz", 44100, report.FilePath, nil, []int64{0, 4800, 9600}},
+		{"denoised and trimmed", 44100, report.FilePath, trim(0.05), []int64{2400, 7200}},
+		{"resampled", 48000, resampled, nil, []int64{0, 1470, 2940}},
+		{"resampled and trimmed", 48000, resampled, trim(0.1), []int64{1340}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			captureRate := cfg.SYS_AUDIO_SAMPLE_RATE
+			cfg.SYS_AUDIO_SAMPLE_RATE = test.captureRate
+			defer func() { cfg.SYS_AUDIO_SAMPLE_RATE = captureRate }()
+
+			path := filepath.Join(t.TempDir(), "processed.aiff")
+			if _, err := audio.Convert(test.path, path, audio.ConvertOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			file := &FileReport{FilePath: path, Trim: test.trim}
+			if err := applyMarkers(file, report.FilePath, markers); err != nil {
+				t.Fatal(err)
+			}
+
+			meta, err := audio.ReadAIFFMetadata(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int64
+			for _, marker := range meta.Markers {
+				got = append(got, marker.Frame)
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("marker frames %v, want %v", got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Errorf("marker frames %v, want %v", got, test.want)
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package recorder
+
+import (
+	"errors"
+	"time"
+
+	"github.com/otis-co-ltd/aihub-recorder/internal/audio"
+)
+
+// SessionReport describes a stopped session. It is returned to the
+// backend in the stop response and sent as the upload manifest.
+type SessionReport struct {
+	SessionID   string `json:"session_id"`
+	DeviceIndex int    `json:"device_index"`
+	// DeviceID and DeviceAlias identify the device independently of the
+	// index, see audio.AudioDevice.
+	DeviceID    string    `json:"device_id,omitempty"`
+	DeviceAlias string    `json:"device_alias,omitempty"`
+	StartTime   time.Time `json:"start_time"`
+	StopTime    time.Time `json:"stop_time"`
+	Channels    int       `json:"channels"`
+	// ChannelMap lists the 1-based device channels that were recorded,
+	// in file order, when only some channels were selected.
+	ChannelMap []int `json:"channel_map,omitempty"`
+	// ChannelLabels names the recorded channels in order, e.g. client
+	// and practitioner.
+	ChannelLabels []string         `json:"channel_labels,omitempty"`
+	AGC           *audio.AGCReport `json:"agc,omitempty"`
+	// CaptureSampleRate is the rate the device was read at when it
+	// differs from the recording's; the audio was resampled.
+	CaptureSampleRate float64 `json:"capture_sample_rate,omitempty"`
+	// Interrupted is set when the device failed or was unplugged before
+	// the session was stopped; the file holds the audio up to that point.
+	Interrupted     bool   `json:"interrupted,omitempty"`
+	InterruptReason string `json:"interrupt_reason,omitempty"`
+	// Error is set when the recorder failed; the file may be empty or
+	// end early.
+	Error string `json:"error,omitempty"`
+	// AutoStopReason is set when the session stopped by itself rather
+	// than on a stop command, e.g. "max_duration".
+	AutoStopReason     string  `json:"auto_stop_reason,omitempty"`
+	MaxDurationSeconds float64 `json:"max_duration_seconds,omitempty"`
+	// Capture counts the frames recorded and any lost to overflows or a
+	// slow disk.
+	Capture audio.CaptureStats `json:"capture"`
+	// Reconnects lists the device outages recording recovered from.
+	Reconnects []audio.Reconnect `json:"reconnects,omitempty"`
+	// Pauses lists the intervals in which recording was paused; they are
+	// not in the file.
+	Pauses []audio.Pause `json:"pauses,omitempty"`
+	// Markers lists the markers added while recording, including one
+	// labelled "pause" at each pause. Frames refer to the original
+	// recording, before any trim.
+	Markers []audio.Marker `json:"markers,omitempty"`
+	// Segments lists the files of a segmented session in order. They
+	// are uploaded as they complete, and FilePath is the first of them.
+	Segments []audio.Segment `json:"segments,omitempty"`
+	// Metadata is the description written into each file, see
+	// audio.FileMetadata.
+	Metadata *audio.FileMetadata `json:"metadata,omitempty"`
+	FileReport
+	// Tracks is set when the recording was split into one file per
+	// channel; the tracks are uploaded instead of the interleaved file.
+	Tracks []*TrackReport `json:"tracks,omitempty"`
+}
+
+// SegmentReport describes one segment of a session. It is sent as the
+// manifest of the segment's upload.
+type SegmentReport struct {
+	SessionID     string        `json:"session_id"`
+	DeviceIndex   int           `json:"device_index"`
+	DeviceID      string        `json:"device_id,omitempty"`
+	DeviceAlias   string        `json:"device_alias,omitempty"`
+	StartTime     time.Time     `json:"start_time"`
+	Channels      int           `json:"channels"`
+	ChannelLabels []string      `json:"channel_labels,omitempty"`
+	Segment       audio.Segment `json:"segment"`
+}
+
+func newSegmentReport(session *RecordingSession, segment audio.Segment) *SegmentReport {
+	return &SegmentReport{
+		SessionID:     session.SessionID,
+		DeviceIndex:   session.DeviceIndex,
+		DeviceID:      session.DeviceID,
+		DeviceAlias:   session.DeviceAlias,
+		StartTime:     session.StartTime,
+		Channels:      session.Channels,
+		ChannelLabels: session.ChannelLabels,
+		Segment:       segment,
+	}
+}
+
+// uploadFiles returns the files that are uploaded for the session: its
+// tracks when it was split, otherwise the recording.
+func (r *SessionReport) uploadFiles() []*FileReport {
+	if len(r.Tracks) == 0 {
+		return []*FileReport{&r.FileReport}
+	}
+	files := make([]*FileReport, len(r.Tracks))
+	for i, track := range r.Tracks {
+		files[i] = &track.FileReport
+	}
+	return files
+}
+
+// FileReport is the post-processing outcome of one uploaded file.
+type FileReport struct {
+	FilePath string `json:"file_path"`
+	// AudioStartTime is the wall-clock time of the first frame in the
+	// file; it moves forward when leading silence is trimmed.
+	AudioStartTime time.Time             `json:"audio_start_time"`
+	Trim           *audio.TrimReport     `json:"trim,omitempty"`
+	Loudness       *audio.LoudnessReport `json:"loudness,omitempty"`
+	// SampleRate is set when the file was resampled for upload.
+	SampleRate float64 `json:"sample_rate,omitempty"`
+}
+
+// TrackReport describes the mono file holding one channel of a session.
+type TrackReport struct {
+	// Channel is the 1-based device channel held by the track.
+	Channel int    `json:"channel"`
+	Label   string `json:"label,omitempty"`
+	FileReport
+}
+
+func newSessionReport(session *RecordingSession) *SessionReport {
+	report := &SessionReport{
+		SessionID:   session.SessionID,
+		DeviceIndex: session.DeviceIndex,
+		DeviceID:    session.DeviceID,
+		DeviceAlias: session.DeviceAlias,
+		StartTime:   session.StartTime,
+		StopTime:    time.Now(),
+		FileReport: FileReport{
+			FilePath:       session.GetFilePath(),
+			AudioStartTime: session.StartTime,
+		},
+		Channels:      session.Channels,
+		ChannelMap:    session.ChannelMap,
+		ChannelLabels: session.ChannelLabels,
+		Reconnects:    session.GetReconnects(),
+		Capture:       session.Recorder.Stats(),
+		Pauses:        session.Recorder.Pauses(),
+		Markers:       session.Recorder.Markers(),
+		Segments:      session.Recorder.Segments(),
+		Metadata:      session.Metadata,
+
+		CaptureSampleRate:  session.CaptureRate,
+		MaxDurationSeconds: session.GetMaxDuration().Seconds(),
+	}
+	if session.AGC != nil {
+		report.AGC = session.AGC.Report()
+	}
+	if err := session.Err(); err != nil {
+		if errors.Is(err, audio.ErrDeviceLost) {
+			report.Interrupted = true
+			report.InterruptReason = err.Error()
+		} else {
+			report.Error = err.Error()
+		}
+	}
+	return report
+}
+
+// SessionStatus describes a session that is still recording.
+type SessionStatus struct {
+	SessionID       string             `json:"session_id"`
+	DeviceIndex     int                `json:"device_index"`
+	DeviceID        string             `json:"device_id,omitempty"`
+	DeviceAlias     string             `json:"device_alias,omitempty"`
+	StartTime       time.Time          `json:"start_time"`
+	FilePath        string             `json:"file_path"`
+	Channels        int                `json:"channels"`
+	DurationSeconds float64            `json:"duration_seconds"`
+	Capture         audio.CaptureStats `json:"capture"`
+	Reconnects      []audio.Reconnect  `json:"reconnects,omitempty"`
+	Paused          bool               `json:"paused"`
+	Pauses          []audio.Pause      `json:"pauses,omitempty"`
+	// AutoStopTime is when the session stops by itself unless it is
+	// stopped before.
+	AutoStopTime *time.Time `json:"auto_stop_time,omitempty"`
+}
+
+func newSessionStatus(session *RecordingSession) *SessionStatus {
+	stats := session.Recorder.Stats()
+	status := &SessionStatus{
+		SessionID:       session.SessionID,
+		DeviceIndex:     session.DeviceIndex,
+		DeviceID:        session.DeviceID,
+		DeviceAlias:     session.DeviceAlias,
+		StartTime:       session.StartTime,
+		FilePath:        session.GetFilePath(),
+		Channels:        session.Channels,
+		DurationSeconds: float64(stats.Frames) / cfg.SYS_AUDIO_SAMPLE_RATE,
+		Capture:         stats,
+		Reconnects:      session.GetReconnects(),
+		Paused:          session.IsPaused(),
+		Pauses:          session.Recorder.Pauses(),
+	}
+	if maxDuration := session.GetMaxDuration(); maxDuration > 0 {
+		stopTime := session.StartTime.Add(maxDuration)
+		status.AutoStopTime = &stopTime
+	}
+	return status
+}
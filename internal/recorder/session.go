@@ -10,12 +10,27 @@ import (
 type RecordingSession struct {
 	SessionID string
 	DeviceIndex int 
+	DeviceID string
+	DeviceAlias string
 	Recorder audio.IAudioFormat
 	Control *audio.RecondControlSignal
+	AGC *audio.AutoGainControl
+	ChannelLabels []string
+	ChannelMap []int
+	Channels int
+	Reconnects []audio.Reconnect
+	Metadata *audio.FileMetadata
+	CaptureRate float64
+	MaxDuration time.Duration
 	StartTime time.Time
 	FilePath string
 	mu sync.Mutex
 	isRecording bool
+	isStopping bool
+	isPaused bool
+	done chan struct{}
+	err error
+	autoStop *time.Timer
 }
 
 func NewRecordingSession(sessionID string, deviceIndex int) *RecordingSession {
@@ -25,9 +40,31 @@ func NewRecordingSession(sessionID string, deviceIndex int) *RecordingSession {
 		Control: audio.NewRecControlSig(),
 		StartTime: time.Now(),
 		isRecording: false,
+		done: make(chan struct{}),
 	}
 }
 
+// Finish records how the recorder goroutine ended and wakes up anyone
+// waiting on Done.
+func (s *RecordingSession) Finish(err error) {
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+	close(s.done)
+}
+
+// Done is closed once the recorder goroutine has returned.
+func (s *RecordingSession) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err is the error the recorder ended with, nil after a normal stop.
+func (s *RecordingSession) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
 func (s *RecordingSession) IsRecording() bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -40,6 +77,70 @@ func (s *RecordingSession) SetRecording(state bool) {
 	s.isRecording = state
 }
 
+func (s *RecordingSession) AddReconnect(reconnect audio.Reconnect) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Reconnects = append(s.Reconnects, reconnect)
+}
+
+func (s *RecordingSession) GetReconnects() []audio.Reconnect {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]audio.Reconnect(nil), s.Reconnects...)
+}
+
+func (s *RecordingSession) IsPaused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.isPaused
+}
+
+// SetPaused changes the paused state and reports whether it changed.
+func (s *RecordingSession) SetPaused(paused bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.isPaused == paused {
+		return false
+	}
+	s.isPaused = paused
+	return true
+}
+
+// StopAfter runs stop once the session has been recording for d.
+func (s *RecordingSession) StopAfter(d time.Duration, stop func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.MaxDuration = d
+	s.autoStop = time.AfterFunc(d, stop)
+}
+
+// CancelAutoStop cancels the stop set up by StopAfter.
+func (s *RecordingSession) CancelAutoStop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.autoStop != nil {
+		s.autoStop.Stop()
+	}
+}
+
+func (s *RecordingSession) GetMaxDuration() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.MaxDuration
+}
+
+// BeginStop marks the session as stopping. It returns false when another
+// stop is already under way, since the recorder answers only one.
+func (s *RecordingSession) BeginStop() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.isStopping {
+		return false
+	}
+	s.isStopping = true
+	return true
+}
+
 func (s *RecordingSession) SetFilePath(path string) {
     s.mu.Lock()
     defer s.mu.Unlock()
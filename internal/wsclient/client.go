@@ -15,13 +15,17 @@ import (
 )
 
 const (
-	MSG_START_RECORDING = "start_recording"
-	MSG_STOP_RECORDING  = "stop_recording"
-	MSG_LIST_DEVICES    = "list_devices"
-	MSG_STOP_ALL        = "stop_all"
-	MSG_STATUS          = "status"
-	MSG_ERROR           = "error"
-	MSG_SUCCESS         = "success"
+	MSG_START_RECORDING  = "start_recording"
+	MSG_STOP_RECORDING   = "stop_recording"
+	MSG_LIST_DEVICES     = "list_devices"
+	MSG_STOP_ALL         = "stop_all"
+	MSG_SESSION_STATUS   = "session_status"
+	MSG_PAUSE_RECORDING  = "pause_recording"
+	MSG_RESUME_RECORDING = "resume_recording"
+	MSG_ADD_MARKER       = "add_marker"
+	MSG_STATUS           = "status"
+	MSG_ERROR            = "error"
+	MSG_SUCCESS          = "success"
 )
 
 type WSMessage struct {
@@ -38,6 +42,8 @@ type Client struct {
 }
 
 func Start(piID string) {
+	watchEvents()
+
 	for {
 		client, err := connect(piID)
 		if err != nil {
@@ -48,7 +54,9 @@ func Start(piID string) {
 
 		log.Println("[WS] Connected to:", client.serverURL)
 		go client.writePump()
+		setCurrentClient(client)
 		client.readPump()
+		setCurrentClient(nil)
 
 		log.Println("[WS] Disconnected. Reconnecting...")
 		time.Sleep(time.Duration(config.ReconnectSeconds) * time.Second)
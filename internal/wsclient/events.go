@@ -0,0 +1,142 @@
+package wsclient
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/otis-co-ltd/aihub-recorder/internal/audio"
+	"github.com/otis-co-ltd/aihub-recorder/internal/config"
+	"github.com/otis-co-ltd/aihub-recorder/internal/recorder"
+)
+
+// Events are pushed to the backend without a request, on whichever
+// connection is up at the time.
+
+var current *Client
+var currentMutex sync.RWMutex
+
+func setCurrentClient(c *Client) {
+	currentMutex.Lock()
+	defer currentMutex.Unlock()
+	current = c
+}
+
+func currentClient() *Client {
+	currentMutex.RLock()
+	defer currentMutex.RUnlock()
+	return current
+}
+
+// watchEvents starts the device watcher and subscribes to sessions that
+// end or resume without a command.
+func watchEvents() {
+	recorder.SetInterruptHandler(handleInterrupted)
+	recorder.SetFailureHandler(handleFailed)
+	recorder.SetAutoStopHandler(handleAutoStopped)
+	recorder.SetSegmentHandler(handleSegment)
+	recorder.SetReconnectHandler(handleReconnected)
+
+	events := audio.WatchDevices(time.Duration(config.DeviceWatchSeconds)*time.Second, nil)
+	go func() {
+		for event := range events {
+			handleDeviceEvent(event)
+		}
+	}()
+}
+
+func handleDeviceEvent(event audio.DeviceEvent) {
+	verb := "connected"
+	if event.Type == audio.DeviceRemoved {
+		verb = "disconnected"
+	}
+	log.Printf("🔌 Device %s: %s (%s)", verb, event.Device.Name, event.Device.ID)
+
+	c := currentClient()
+	if c == nil {
+		return
+	}
+	c.sendResponse(ResponseMessage{
+		Command: event.Type,
+		Status:  "success",
+		Message: fmt.Sprintf("Device %s: %s", verb, event.Device.Name),
+		Data:    event.Device,
+	})
+}
+
+// handleFailed reports a session whose recorder failed. Other sessions
+// are unaffected. The file is kept on disk but not uploaded, since it
+// may be empty or cut short.
+func handleFailed(report *recorder.SessionReport) {
+	log.Printf("❌ Session %s failed: %s", report.SessionID, report.Error)
+
+	c := currentClient()
+	if c == nil {
+		return
+	}
+	c.sendResponse(ResponseMessage{
+		Command: "recording_failed",
+		Status:  "error",
+		Message: fmt.Sprintf("Recording failed for session %s: %s", report.SessionID, report.Error),
+		Data:    report,
+	})
+}
+
+// handleInterrupted reports a session whose device failed, then handles
+// its partial recording like a stopped one.
+func handleInterrupted(report *recorder.SessionReport) {
+	log.Printf("⚠️ Session %s interrupted: %s", report.SessionID, report.InterruptReason)
+
+	c := currentClient()
+	if c == nil {
+		log.Printf("Not connected, partial recording of %s kept at %s", report.SessionID, report.FilePath)
+		return
+	}
+
+	c.sendResponse(ResponseMessage{
+		Command: "recording_interrupted",
+		Status:  "error",
+		Message: fmt.Sprintf("Recording interrupted for session %s: %s", report.SessionID, report.InterruptReason),
+		Data:    report,
+	})
+
+	c.postProcess(report)
+	c.uploadSession(report)
+}
+
+// handleAutoStopped uploads a session that stopped by itself, like a
+// stopped one, and tells the backend why it stopped.
+func handleAutoStopped(report *recorder.SessionReport) {
+	log.Printf("⏱️ Session %s stopped automatically: %s", report.SessionID, report.AutoStopReason)
+
+	c := currentClient()
+	if c == nil {
+		log.Printf("Not connected, recording of %s kept at %s", report.SessionID, report.FilePath)
+		return
+	}
+
+	c.postProcess(report)
+	c.sendResponse(ResponseMessage{
+		Command: "auto_stopped",
+		Status:  "success",
+		Message: fmt.Sprintf("Recording stopped automatically for session %s: %s", report.SessionID, report.AutoStopReason),
+		Data:    report,
+	})
+	c.uploadSession(report)
+}
+
+func handleReconnected(sessionID string, reconnect audio.Reconnect) {
+	log.Printf("🔌 Session %s resumed after %.1fs without its device", sessionID, reconnect.GapSeconds)
+
+	c := currentClient()
+	if c == nil {
+		return
+	}
+	c.sendResponse(ResponseMessage{
+		Command: "recording_reconnected",
+		Status:  "success",
+		Message: fmt.Sprintf("Recording resumed for session %s after %.1fs", sessionID, reconnect.GapSeconds),
+		Data:    ReconnectEvent{SessionID: sessionID, Reconnect: reconnect},
+	})
+}
@@ -10,7 +10,9 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/otis-co-ltd/aihub-recorder/internal/audio"
 	"github.com/otis-co-ltd/aihub-recorder/internal/config"
@@ -34,12 +36,33 @@ func (c *Client) handleMessage(msg WSMessage) {
 			c.handleStopRecordingSession(stopMsg)
 		}
 
+	case MSG_PAUSE_RECORDING:
+		var pauseMsg PauseRecordingMessage
+		if err := json.Unmarshal(msg.Data, &pauseMsg); err == nil && pauseMsg.SessionID != "" {
+			c.handlePauseRecording(pauseMsg)
+		}
+
+	case MSG_RESUME_RECORDING:
+		var resumeMsg ResumeRecordingMessage
+		if err := json.Unmarshal(msg.Data, &resumeMsg); err == nil && resumeMsg.SessionID != "" {
+			c.handleResumeRecording(resumeMsg)
+		}
+
+	case MSG_ADD_MARKER:
+		var markerMsg AddMarkerMessage
+		if err := json.Unmarshal(msg.Data, &markerMsg); err == nil && markerMsg.SessionID != "" {
+			c.handleAddMarker(markerMsg)
+		}
+
 	case MSG_LIST_DEVICES:
 		c.handleListDevices()
 
 	case MSG_STOP_ALL:
 		c.handleStopAll()
 
+	case MSG_SESSION_STATUS:
+		c.handleSessionStatus()
+
 	case MSG_STATUS:
 		log.Println("📊 Status from server:", string(msg.Data))
 
@@ -56,8 +79,16 @@ func (c *Client) handleMessage(msg WSMessage) {
 
 // handleStartRecordingMulti handles multi-device recording
 func (c *Client) handleStartRecordingMulti(msg StartRecordingMessage) {
-	// If a device name is provided, resolve it to an index
-	if msg.DeviceName != "" {
+	// A device id or alias is resolved first, then a device name
+	if msg.DeviceID != "" {
+		idx, err := audio.GetDeviceIndexByID(msg.DeviceID)
+		if err != nil {
+			c.sendErrorMessage("start_recording", fmt.Sprintf("Failed to find device by id: %v", err))
+			return
+		}
+		log.Printf("Resolved device id %q -> index %d", msg.DeviceID, idx)
+		msg.DeviceIndex = idx
+	} else if msg.DeviceName != "" {
 		idx, err := audio.GetDeviceIndexByName(msg.DeviceName)
 		if err != nil {
 			c.sendErrorMessage("start_recording", fmt.Sprintf("Failed to find device by name: %v", err))
@@ -69,20 +100,24 @@ func (c *Client) handleStartRecordingMulti(msg StartRecordingMessage) {
 
 	log.Printf("🎙️ Starting recording for session: %s, device: %d", msg.SessionID, msg.DeviceIndex)
 
-	err := recorder.StartSession(msg.SessionID, msg.DeviceIndex)
+	err := recorder.StartSession(msg.SessionID, msg.DeviceIndex, recorder.SessionOptions{
+		ChannelLabels: msg.ChannelLabels,
+		ChannelMap:    msg.ChannelMap,
+		MaxDuration:   time.Duration(msg.MaxDurationSeconds) * time.Second,
+	})
 	if err != nil {
 		c.sendErrorMessage("start_recording", fmt.Sprintf("Failed to start recording: %v", err))
 		return
 	}
 
-	c.sendSuccessMessage("start_recording", fmt.Sprintf("Recording started for session %s on device %d", msg.SessionID, msg.DeviceName))
+	c.sendSuccessMessage("start_recording", fmt.Sprintf("Recording started for session %s on device %d", msg.SessionID, msg.DeviceIndex))
 }
 
 // handleStopRecordingSession handles session-based stop
 func (c *Client) handleStopRecordingSession(msg StopRecordingMessage) {
 	log.Printf("?? Stopping recording for session: %s", msg.SessionID)
 
-	filePath, err := recorder.StopSession(msg.SessionID)
+	report, err := recorder.StopSession(msg.SessionID)
 	if err != nil {
 		lower := strings.ToLower(err.Error())
 		if strings.Contains(lower, "not found") || strings.Contains(lower, "no such") || strings.Contains(lower, "no session") || strings.Contains(lower, "does not exist") {
@@ -94,29 +129,105 @@ func (c *Client) handleStopRecordingSession(msg StopRecordingMessage) {
 	}
 
 	go func() {
-		finalPath := filePath
-		if config.Load().SYS_ENABLE_DENOISING {
-			log.Printf("?? Applying RNNoise denoising to: %s", filePath)
-			denoisedPath, err := audio.DenoiseAudioFile(filePath)
-			if err != nil {
-				log.Printf("?? Denoising failed: %v, uploading original file", err)
-				c.sendErrorMessage("denoise", fmt.Sprintf("Denoising failed: %v", err))
-			} else {
-				log.Printf("? Denoised audio saved to: %s", denoisedPath)
-				finalPath = denoisedPath
-			}
-		}
+		c.postProcess(report)
+
+		// The report describes the processed files, so it follows the
+		// stop acknowledgement once processing is done.
+		c.sendResponse(ResponseMessage{
+			Command: "recording_processed",
+			Status:  "success",
+			Message: fmt.Sprintf("Recording processed for session %s", msg.SessionID),
+			Data:    report,
+		})
+
+		// Upload the final file (processed or original)
+		c.uploadSession(report)
+	}()
 
-		// Upload the final file (denoised or original)
-		err := c.sendFile(finalPath, msg.SessionID)
-		if err != nil {
-			c.sendErrorMessage("upload_file", fmt.Sprintf("Failed to upload: %v", err))
+	c.sendSuccessMessage("stop_recording", fmt.Sprintf("Recording stopped for session %s", msg.SessionID))
+}
+
+func (c *Client) handlePauseRecording(msg PauseRecordingMessage) {
+	log.Printf("⏸️ Pausing recording for session: %s", msg.SessionID)
+
+	if err := recorder.PauseSession(msg.SessionID); err != nil {
+		c.sendErrorMessage("pause_recording", fmt.Sprintf("Failed to pause recording: %v", err))
+		return
+	}
+	c.sendSuccessMessage("pause_recording", fmt.Sprintf("Recording paused for session %s", msg.SessionID))
+}
+
+func (c *Client) handleResumeRecording(msg ResumeRecordingMessage) {
+	log.Printf("▶️ Resuming recording for session: %s", msg.SessionID)
+
+	if err := recorder.ResumeSession(msg.SessionID); err != nil {
+		c.sendErrorMessage("resume_recording", fmt.Sprintf("Failed to resume recording: %v", err))
+		return
+	}
+	c.sendSuccessMessage("resume_recording", fmt.Sprintf("Recording resumed for session %s", msg.SessionID))
+}
+
+// handleAddMarker marks the session's recording at the moment the
+// command arrives and returns the marker with its frame.
+func (c *Client) handleAddMarker(msg AddMarkerMessage) {
+	marker, err := recorder.AddMarker(msg.SessionID, msg.Label, msg.Payload)
+	if err != nil {
+		c.sendErrorMessage("add_marker", fmt.Sprintf("Failed to add marker: %v", err))
+		return
+	}
+	log.Printf("📍 Marker %d %q for session %s at frame %d", marker.ID, marker.Label, msg.SessionID, marker.Frame)
+
+	c.sendResponse(ResponseMessage{
+		Command: "add_marker_response",
+		Status:  "success",
+		Message: fmt.Sprintf("Marker added for session %s", msg.SessionID),
+		Data:    marker,
+	})
+}
+
+// postProcess runs the recorder's post-processing steps, reporting each
+// failed step to the backend.
+func (c *Client) postProcess(report *recorder.SessionReport) {
+	recorder.PostProcess(report, func(step string, err error) {
+		c.sendErrorMessage(step, fmt.Sprintf("%s failed: %v", step, err))
+	})
+}
+
+// uploadSession uploads the session's final file with its report as
+// manifest. A session split per channel uploads each track separately,
+// tagged with its channel so the backend can relate the tracks. The
+// segments of a segmented session were uploaded as they completed; only
+// their index is sent.
+func (c *Client) uploadSession(report *recorder.SessionReport) {
+	if len(report.Segments) > 0 {
+		c.sendSegmentIndex(report)
+		return
+	}
+
+	if len(report.Tracks) == 0 {
+		fields := map[string]string{"session_id": report.SessionID}
+		if err := UploadFile(report.FilePath, fields, report); err != nil {
+			c.sendErrorMessage("upload_file", fmt.Sprintf("Failed to upload for %s: %v", report.SessionID, err))
 		} else {
-			c.sendSuccessMessage("upload_file", fmt.Sprintf("File uploaded for session %s", msg.SessionID))
+			c.sendSuccessMessage("upload_file", fmt.Sprintf("File uploaded for session %s", report.SessionID))
 		}
-	}()
+		return
+	}
 
-	c.sendSuccessMessage("stop_recording", fmt.Sprintf("Recording stopped for session %s", msg.SessionID))
+	for _, track := range report.Tracks {
+		fields := map[string]string{
+			"session_id":    report.SessionID,
+			"track_channel": strconv.Itoa(track.Channel),
+			"track_label":   track.Label,
+			"track_count":   strconv.Itoa(len(report.Tracks)),
+		}
+		manifest := TrackManifest{SessionReport: report, Track: track}
+		if err := UploadFile(track.FilePath, fields, manifest); err != nil {
+			c.sendErrorMessage("upload_file", fmt.Sprintf("Failed to upload channel %d for %s: %v", track.Channel, report.SessionID, err))
+		} else {
+			c.sendSuccessMessage("upload_file", fmt.Sprintf("Channel %d uploaded for session %s", track.Channel, report.SessionID))
+		}
+	}
 }
 
 // handleListDevices lists all available audio devices
@@ -133,6 +244,17 @@ func (c *Client) handleListDevices() {
 	c.sendResponse(response)
 }
 
+// handleSessionStatus reports every active session with its capture
+// counters, so gaps show up while a consultation is still running.
+func (c *Client) handleSessionStatus() {
+	c.sendResponse(ResponseMessage{
+		Command: "session_status_response",
+		Status:  "success",
+		Message: fmt.Sprintf("%d active sessions", recorder.GetActiveSessionCount()),
+		Data:    recorder.GetSessionStatuses(),
+	})
+}
+
 // handleStopAll stops all active recording sessions
 func (c *Client) handleStopAll() {
 	fileMap, err := recorder.StopAllSessions()
@@ -145,25 +267,29 @@ func (c *Client) handleStopAll() {
 		c.sendErrorMessage("stop_all", fmt.Sprintf("Some sessions failed to stop: %v", err))
 	}
 
-	for sessionID, filePath := range fileMap {
-		if filePath == "" {
+	for sessionID, report := range fileMap {
+		if report.FilePath == "" {
 			c.sendErrorMessage("upload_file", fmt.Sprintf("no file produced for session %s", sessionID))
 			continue
 		}
-		go func(sid, fp string) {
-			if err := c.sendFile(fp, sid); err != nil {
-				c.sendErrorMessage("upload_file", fmt.Sprintf("Failed to upload for %s: %v", sid, err))
-			} else {
-				c.sendSuccessMessage("upload_file", fmt.Sprintf("File uploaded for session %s", sid))
-			}
-		}(sessionID, filePath)
+		go func(report *recorder.SessionReport) {
+			c.postProcess(report)
+			c.uploadSession(report)
+		}(report)
 	}
 
 	c.sendSuccessMessage("stop_all", "All recording sessions stopped")
 }
 
-// sendFile uploads a file to the backend with session information
-func (c *Client) sendFile(filePath string, sessionID string) error {
+// UploadFile verifies a file and uploads it to the backend with the given
+// form fields and a JSON manifest describing the recording. It needs no
+// connection to the backend's WebSocket.
+func UploadFile(filePath string, fields map[string]string, manifest interface{}) error {
+	// A broken file is kept on disk for repair rather than uploaded.
+	if _, err := audio.Verify(filePath); err != nil {
+		return err
+	}
+
 	file, err := os.Open(filePath)
 	if err != nil {
 		return err
@@ -183,15 +309,25 @@ func (c *Client) sendFile(filePath string, sessionID string) error {
 		return err
 	}
 
-	// Add session_id field
-	if err := writer.WriteField("session_id", sessionID); err != nil {
+	// Add session_id and other form fields
+	for name, value := range fields {
+		if err := writer.WriteField(name, value); err != nil {
+			return err
+		}
+	}
+
+	// Add manifest field
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if err := writer.WriteField("manifest", string(manifestJSON)); err != nil {
 		return err
 	}
 
 	writer.Close()
 
-	url := "http://aeronsarondo.site/db/audio"
-	req, err := http.NewRequest("POST", url, &requestBody)
+	req, err := http.NewRequest("POST", config.UploadURL, &requestBody)
 	if err != nil {
 		return err
 	}
@@ -209,6 +345,6 @@ func (c *Client) sendFile(filePath string, sessionID string) error {
 		return fmt.Errorf("upload failed: %s", resp.Status)
 	}
 
-	log.Println("📤 Sent audio file to backend:", filePath, "Session:", sessionID)
+	log.Println("📤 Sent audio file to backend:", filePath, "Session:", fields["session_id"])
 	return nil
 }
@@ -0,0 +1,194 @@
+package wsclient
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/otis-co-ltd/aihub-recorder/internal/audio"
+	"github.com/otis-co-ltd/aihub-recorder/internal/config"
+	"github.com/otis-co-ltd/aihub-recorder/internal/recorder"
+)
+
+// TestMain records from the fake backend into a temporary directory,
+// with post-processing steps that need external tools turned off.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "wsclient-test")
+	if err != nil {
+		panic(err)
+	}
+	cfg := recorder.GetConfig()
+	cfg.SYS_RECORD_PATH = dir
+	cfg.SYS_AUDIO_TYPE = 0
+	cfg.SYS_AUDIO_CHANNEL = 1
+	cfg.SYS_AUDIO_SAMPLE_RATE = 48000
+	cfg.SYS_CAPTURE_SAMPLE_RATE = 0
+	cfg.SYS_ENABLE_DENOISING = false
+	cfg.SYS_SEGMENT_SECONDS = 0
+	cfg.SYS_SEGMENT_MB = 0
+	audio.SetCaptureBackend(audio.NewFakeBackend(audio.FakeSource{Signal: "sine", Frequency: 440, LevelDBFS: -12}))
+	audio.SetDeviceAliasFile(filepath.Join(dir, "device_aliases.json"))
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// upload is what the test backend received in one upload request.
+type upload struct {
+	sessionID string
+	manifest  recorder.SessionReport
+	// rawManifest is the manifest as sent, for segment reports.
+	rawManifest string
+	file        string
+}
+
+// newUploadServer starts a backend that stores each uploaded file in
+// dir and points config.UploadURL at it.
+func newUploadServer(t *testing.T, dir string) <-chan upload {
+	t.Helper()
+	uploads := make(chan upload, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		u := upload{
+			sessionID:   r.FormValue("session_id"),
+			rawManifest: r.FormValue("manifest"),
+			file:        filepath.Join(dir, header.Filename),
+		}
+		if err := json.Unmarshal([]byte(u.rawManifest), &u.manifest); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		out, err := os.Create(u.file)
+		if err == nil {
+			_, err = io.Copy(out, file)
+			out.Close()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		uploads <- u
+		w.WriteHeader(http.StatusCreated)
+	}))
+	t.Cleanup(srv.Close)
+
+	uploadURL := config.UploadURL
+	config.UploadURL = srv.URL
+	t.Cleanup(func() { config.UploadURL = uploadURL })
+	return uploads
+}
+
+// nextResponse returns the next message the client sent to the backend.
+func nextResponse(t *testing.T, c *Client) ResponseMessage {
+	t.Helper()
+	select {
+	case data := <-c.send:
+		var response ResponseMessage
+		if err := json.Unmarshal(data, &response); err != nil {
+			t.Fatalf("invalid response %s: %v", data, err)
+		}
+		return response
+	case <-time.After(10 * time.Second):
+		t.Fatal("no response from the client")
+		return ResponseMessage{}
+	}
+}
+
+func expectResponse(t *testing.T, c *Client, command, status string) ResponseMessage {
+	t.Helper()
+	response := nextResponse(t, c)
+	if response.Command != command || response.Status != status {
+		t.Fatalf("got %s %s (%s), want %s %s", response.Command, response.Status, response.Message, command, status)
+	}
+	return response
+}
+
+func TestStartStopUpload(t *testing.T) {
+	received := t.TempDir()
+	uploads := newUploadServer(t, received)
+	c := &Client{send: make(chan []byte, 16), piID: "test-pi"}
+
+	c.handleMessage(WSMessage{
+		Type: MSG_START_RECORDING,
+		Data: json.RawMessage(`{"command":"start_recording","session_id":"e2e","device_index":0}`),
+	})
+	expectResponse(t, c, "start_recording_response", "success")
+	time.Sleep(500 * time.Millisecond)
+
+	c.handleMessage(WSMessage{
+		Type: MSG_STOP_RECORDING,
+		Data: json.RawMessage(`{"command":"stop_recording","session_id":"e2e"}`),
+	})
+	// The stop is acknowledged before post-processing and upload.
+	expectResponse(t, c, "stop_recording_response", "success")
+	processed := expectResponse(t, c, "recording_processed", "success")
+	expectResponse(t, c, "upload_file_response", "success")
+
+	var report recorder.SessionReport
+	data, _ := json.Marshal(processed.Data)
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+
+	u := <-uploads
+	if u.sessionID != "e2e" || u.manifest.SessionID != "e2e" {
+		t.Errorf("uploaded for session %q with manifest for %q", u.sessionID, u.manifest.SessionID)
+	}
+	if u.manifest.FilePath != report.FilePath {
+		t.Errorf("manifest names %s, report %s", u.manifest.FilePath, report.FilePath)
+	}
+	info, err := audio.Verify(u.file)
+	if err != nil {
+		t.Fatalf("uploaded file: %v", err)
+	}
+	if info.Frames == 0 || info.Frames != u.manifest.Capture.Frames {
+		t.Errorf("uploaded %d frames, manifest captured %d", info.Frames, u.manifest.Capture.Frames)
+	}
+}
+
+func TestStopUnknownSession(t *testing.T) {
+	c := &Client{send: make(chan []byte, 16), piID: "test-pi"}
+	c.handleMessage(WSMessage{
+		Type: MSG_STOP_RECORDING,
+		Data: json.RawMessage(`{"command":"stop_recording","session_id":"missing"}`),
+	})
+	expectResponse(t, c, "stop_recording_response", "error")
+}
+
+func TestUploadFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "disk full", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	uploadURL := config.UploadURL
+	config.UploadURL = srv.URL
+	defer func() { config.UploadURL = uploadURL }()
+
+	if err := recorder.StartSession("upload-failure", 0, recorder.SessionOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	report, err := recorder.StopSession("upload-failure")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := UploadFile(report.FilePath, map[string]string{"session_id": report.SessionID}, report); err == nil {
+		t.Fatal("upload to a failing backend succeeded")
+	}
+	if _, err := os.Stat(report.FilePath); err != nil {
+		t.Errorf("recording is gone after a failed upload: %v", err)
+	}
+}
@@ -1,5 +1,12 @@
 package wsclient
 
+import (
+	"encoding/json"
+
+	"github.com/otis-co-ltd/aihub-recorder/internal/audio"
+	"github.com/otis-co-ltd/aihub-recorder/internal/recorder"
+)
+
 type BaseMessage struct {
 	Command string `json:"command"`
 }
@@ -9,6 +16,15 @@ type StartRecordingMessage struct {
 	SessionID   string `json:"session_id"`
 	DeviceIndex int    `json:"device_index"`
 	DeviceName  string `json:"device_name,omitempty"`
+	// DeviceID selects the device by the id or alias from list_devices.
+	// It takes precedence over DeviceName and DeviceIndex.
+	DeviceID string `json:"device_id,omitempty"`
+	// ChannelLabels overrides the configured per-channel labels.
+	ChannelLabels []string `json:"channel_labels,omitempty"`
+	// ChannelMap selects 1-based device channels to record, e.g. [3,4].
+	ChannelMap []int `json:"channel_map,omitempty"`
+	// MaxDurationSeconds overrides SYS_MAX_DURATION_S for this session.
+	MaxDurationSeconds int `json:"max_duration_seconds,omitempty"`
 }
 
 type StopRecordingMessage struct {
@@ -16,6 +32,24 @@ type StopRecordingMessage struct {
 	SessionID string `json:"session_id"`
 }
 
+type PauseRecordingMessage struct {
+	Command   string `json:"command"`
+	SessionID string `json:"session_id"`
+}
+
+type ResumeRecordingMessage struct {
+	Command   string `json:"command"`
+	SessionID string `json:"session_id"`
+}
+
+type AddMarkerMessage struct {
+	Command   string `json:"command"`
+	SessionID string `json:"session_id"`
+	Label     string `json:"label"`
+	// Payload is passed through to the manifest as is.
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
 type ListDevicesMessage struct {
 	Command string `json:"command"`
 }
@@ -30,3 +64,16 @@ type ResponseMessage struct {
 	Message string      `json:"message"`
 	Data    interface{} `json:"data,omitempty"`
 }
+
+// TrackManifest is the manifest uploaded with one track of a session that
+// was split per channel.
+type TrackManifest struct {
+	*recorder.SessionReport
+	Track *recorder.TrackReport `json:"track"`
+}
+
+// ReconnectEvent is the data of a recording_reconnected message.
+type ReconnectEvent struct {
+	SessionID string `json:"session_id"`
+	audio.Reconnect
+}
@@ -0,0 +1,122 @@
+package wsclient
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+
+	"github.com/otis-co-ltd/aihub-recorder/internal/audio"
+	"github.com/otis-co-ltd/aihub-recorder/internal/recorder"
+)
+
+// Segments are uploaded one at a time in the order they complete. The
+// segment index of a session is queued behind its last segment, so the
+// backend gets the index after every segment was sent.
+
+type uploadQueue struct {
+	mu   sync.Mutex
+	jobs []func()
+	wake chan struct{}
+}
+
+var segmentUploads = newUploadQueue()
+
+// segmentLoudness keeps the loudness of each uploaded segment until the
+// segment index that lists it is sent. Only queue jobs use it.
+var segmentLoudness = map[string]*audio.LoudnessStats{}
+
+func newUploadQueue() *uploadQueue {
+	q := &uploadQueue{wake: make(chan struct{}, 1)}
+	go q.run()
+	return q
+}
+
+// push queues job without blocking; segments are queued from the
+// recorder's disk writer.
+func (q *uploadQueue) push(job func()) {
+	q.mu.Lock()
+	q.jobs = append(q.jobs, job)
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *uploadQueue) run() {
+	for range q.wake {
+		for {
+			q.mu.Lock()
+			if len(q.jobs) == 0 {
+				q.mu.Unlock()
+				break
+			}
+			job := q.jobs[0]
+			q.jobs = q.jobs[1:]
+			q.mu.Unlock()
+
+			job()
+		}
+	}
+}
+
+// handleSegment queues the upload of a segment that just completed.
+func handleSegment(report *recorder.SegmentReport) {
+	segment := report.Segment
+	log.Printf("📼 Segment %d of session %s complete: %s", segment.Index, report.SessionID, segment.FilePath)
+
+	segmentUploads.push(func() {
+		measureSegment(&report.Segment)
+		c := currentClient()
+		if c == nil {
+			log.Printf("Not connected, segment %d of %s kept at %s", segment.Index, report.SessionID, segment.FilePath)
+			return
+		}
+
+		fields := map[string]string{
+			"session_id":    report.SessionID,
+			"segment_index": strconv.Itoa(segment.Index),
+			"segment_final": strconv.FormatBool(segment.Final),
+		}
+		if err := UploadFile(segment.FilePath, fields, report); err != nil {
+			c.sendErrorMessage("upload_segment", fmt.Sprintf("Failed to upload segment %d for %s: %v", segment.Index, report.SessionID, err))
+		} else {
+			c.sendSuccessMessage("upload_segment", fmt.Sprintf("Segment %d uploaded for session %s", segment.Index, report.SessionID))
+		}
+	})
+}
+
+// sendSegmentIndex sends the list of all segments of a stopped session
+// once its segments are uploaded.
+func (c *Client) sendSegmentIndex(report *recorder.SessionReport) {
+	segmentUploads.push(func() {
+		for i := range report.Segments {
+			measureSegment(&report.Segments[i])
+			delete(segmentLoudness, report.Segments[i].FilePath)
+		}
+		c.sendResponse(ResponseMessage{
+			Command: "segment_index",
+			Status:  "success",
+			Message: fmt.Sprintf("%d segments recorded for session %s", len(report.Segments), report.SessionID),
+			Data:    report,
+		})
+	})
+}
+
+// measureSegment sets the loudness of a complete segment, measuring it
+// only the first time.
+func measureSegment(segment *audio.Segment) {
+	stats, ok := segmentLoudness[segment.FilePath]
+	if !ok {
+		var err error
+		stats, err = audio.MeasureLoudness(segment.FilePath)
+		if err != nil {
+			log.Printf("Measuring loudness of segment %d failed: %v", segment.Index, err)
+			return
+		}
+		segmentLoudness[segment.FilePath] = stats
+	}
+	segment.Loudness = stats
+}
@@ -0,0 +1,79 @@
+package wsclient
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/otis-co-ltd/aihub-recorder/internal/recorder"
+)
+
+// TestSegmentLoudness records three one-second segments and checks that
+// each upload and the segment index carry the segment's loudness.
+func TestSegmentLoudness(t *testing.T) {
+	cfg := recorder.GetConfig()
+	cfg.SYS_SEGMENT_SECONDS = 1
+	defer func() { cfg.SYS_SEGMENT_SECONDS = 0 }()
+
+	uploads := newUploadServer(t, t.TempDir())
+	c := &Client{send: make(chan []byte, 16), piID: "test-pi"}
+	setCurrentClient(c)
+	recorder.SetSegmentHandler(handleSegment)
+	defer func() {
+		recorder.SetSegmentHandler(nil)
+		setCurrentClient(nil)
+	}()
+
+	if err := recorder.StartSession("segments", 0, recorder.SessionOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2500 * time.Millisecond)
+	report, err := recorder.StopSession("segments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.uploadSession(report)
+
+	// A 440 Hz sine peaking at -12 dBFS in one channel.
+	const wantLUFS = -15.7
+	uploaded := map[int]float64{}
+	for range report.Segments {
+		expectResponse(t, c, "upload_segment_response", "success")
+		u := <-uploads
+		var manifest recorder.SegmentReport
+		if err := json.Unmarshal([]byte(u.rawManifest), &manifest); err != nil {
+			t.Fatal(err)
+		}
+		segment := manifest.Segment
+		if segment.Loudness == nil {
+			t.Fatalf("segment %d uploaded without loudness", segment.Index)
+		}
+		uploaded[segment.Index] = segment.Loudness.IntegratedLUFS
+	}
+
+	response := expectResponse(t, c, "segment_index", "success")
+	var index recorder.SessionReport
+	data, _ := json.Marshal(response.Data)
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Segments) < 3 {
+		t.Fatalf("%d segments recorded, want at least 3", len(index.Segments))
+	}
+	for _, segment := range index.Segments {
+		if segment.Loudness == nil {
+			t.Fatalf("segment %d listed without loudness", segment.Index)
+		}
+		lufs := segment.Loudness.IntegratedLUFS
+		if lufs != uploaded[segment.Index] {
+			t.Errorf("segment %d listed at %.2f LUFS, uploaded with %.2f", segment.Index, lufs, uploaded[segment.Index])
+		}
+		if !segment.Final && math.Abs(lufs-wantLUFS) > 0.3 {
+			t.Errorf("segment %d measures %.2f LUFS, want %.1f", segment.Index, lufs, wantLUFS)
+		}
+	}
+	if len(segmentLoudness) != 0 {
+		t.Errorf("%d segment measurements kept after the index was sent", len(segmentLoudness))
+	}
+}
@@ -1,7 +0,0 @@
-package main
-
-import "github.com/otis-co-ltd/aihub-recorder/internal/audio"
-
-func main() {
-	audio.PrintAvailableDevicesJSON()
-}